@@ -0,0 +1,118 @@
+package embedspicedb
+
+import "time"
+
+// ReloadTrigger identifies what caused a schema reload.
+type ReloadTrigger string
+
+const (
+	// ReloadTriggerStartup is the initial schema load performed by Start.
+	ReloadTriggerStartup ReloadTrigger = "startup"
+
+	// ReloadTriggerWatcher is a reload caused by a change to a watched schema file.
+	ReloadTriggerWatcher ReloadTrigger = "watcher"
+
+	// ReloadTriggerManual is a reload requested through ReloadSchema.
+	ReloadTriggerManual ReloadTrigger = "manual"
+
+	// ReloadTriggerRollback is a schema written by RollbackSchema.
+	ReloadTriggerRollback ReloadTrigger = "rollback"
+
+	// ReloadTriggerURL is a reload caused by a change to the schema served at one of the schema URLs.
+	ReloadTriggerURL ReloadTrigger = "url"
+
+	// ReloadTriggerSchemaFiles is a reload caused by adding, removing or replacing schema files with
+	// AddSchemaFiles, RemoveSchemaFiles or SetSchemaFiles.
+	ReloadTriggerSchemaFiles ReloadTrigger = "schema_files"
+)
+
+// ReloadEvent describes a single schema reload, whether or not it succeeded.
+type ReloadEvent struct {
+	// Trigger is what caused the reload.
+	Trigger ReloadTrigger
+
+	// ChangedFiles are the absolute paths of the schema files, or the schema URLs, whose changes
+	// triggered the reload, or the schema file entries which were added or removed. Only set for
+	// ReloadTriggerWatcher, ReloadTriggerURL and ReloadTriggerSchemaFiles.
+	ChangedFiles []string
+
+	// Files are the schema files the schema was read from, followed by the schema URLs.
+	Files []string
+
+	// StartedAt is when the reload started.
+	StartedAt time.Time
+
+	// Duration is how long the reload took, including relationship seeding and assertions.
+	Duration time.Duration
+
+	// SchemaHash is the hex-encoded SHA-256 hash of the schema text.
+	// Empty if the reload failed before the schema files were read.
+	SchemaHash string
+
+	// Revision is the ZedToken returned by WriteSchema. Empty if the schema was not written.
+	Revision string
+
+	// Version is the schema history version of the written schema. Zero if the schema was not written.
+	Version int
+
+	// Diff lists the differences between the previously stored schema and the reloaded schema.
+	// Nil for rollbacks and for reloads which failed before the schemas could be compared.
+	Diff *SchemaDiff
+
+	// Validation holds the results of the assertions and expected relations in the validation files.
+	Validation *ValidationReport
+
+	// Warnings lists problems which did not fail the reload, such as destructive changes written
+	// under DestructiveChangesWarn.
+	Warnings []string
+
+	// Err is the error the reload failed with, or nil if it succeeded.
+	Err error
+}
+
+// newReloadEvent returns the event describing a reload which started at startedAt, produced result
+// and was recorded as version of the schema history.
+func newReloadEvent(trigger ReloadTrigger, changed []string, startedAt time.Time, result *ReloadResult, version int, err error) ReloadEvent {
+	event := ReloadEvent{
+		Trigger:      trigger,
+		ChangedFiles: changed,
+		StartedAt:    startedAt,
+		Duration:     time.Since(startedAt),
+		Version:      version,
+		Err:          err,
+	}
+	if result != nil {
+		event.Files = result.Files
+		event.Revision = result.Revision
+		event.Diff = result.Diff
+		event.Validation = result.Validation
+		event.Warnings = result.Warnings
+		if result.Schema != "" {
+			event.SchemaHash = schemaHash(result.Schema)
+		}
+	}
+	return event
+}
+
+// OnSchemaReloadEvent registers a callback function that will be called after every schema load:
+// the initial load on Start, reloads caused by file changes or ReloadSchema, and rollbacks.
+// Callbacks are invoked synchronously, in registration order, and must not block.
+func (es *EmbeddedServer) OnSchemaReloadEvent(callback func(ReloadEvent)) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.eventCallbacks = append(es.eventCallbacks, callback)
+}
+
+// emitReloadEvent invokes the callbacks registered with OnSchemaReloadEvent.
+// It must not be called while holding es.mu.
+func (es *EmbeddedServer) emitReloadEvent(event ReloadEvent) {
+	es.mu.RLock()
+	callbacks := make([]func(ReloadEvent), len(es.eventCallbacks))
+	copy(callbacks, es.eventCallbacks)
+	es.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(event)
+	}
+}
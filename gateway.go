@@ -0,0 +1,32 @@
+package embedspicedb
+
+import (
+	"context"
+
+	"github.com/akoserwal/embedspicedb/internal/gateway"
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// startGateway starts the HTTP gateway, if enabled. The gateway calls the gRPC server over the
+// server's client connection, so it is served however gRPC is: over TCP, a unix domain socket or
+// in memory.
+func (es *EmbeddedServer) startGateway(ctx context.Context) error {
+	if !es.config.HTTPEnabled {
+		return nil
+	}
+
+	handler, err := gateway.NewHandler(es.ctx, es.conn)
+	if err != nil {
+		return err
+	}
+	srv, err := gateway.Start(es.config.HTTPAddress, es.config.SocketMode, es.listenerTLSConfig(), handler)
+	if err != nil {
+		return err
+	}
+	es.gatewaySrv = srv
+	log.Ctx(ctx).Info().
+		Str("address", srv.Addr()).
+		Msg("HTTP gateway started")
+
+	return nil
+}
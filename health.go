@@ -22,6 +22,12 @@ type HealthStatus struct {
 	Version   string            `json:"version,omitempty"`
 	Uptime    string            `json:"uptime,omitempty"`
 	StartTime *time.Time        `json:"start_time,omitempty"`
+
+	// Assertions holds the per-assertion results of the last reload, if the validation files declare any.
+	Assertions *ValidationReport `json:"assertions,omitempty"`
+
+	// Watcher holds the circuit breaker state of the schema file watcher, if schema files are watched.
+	Watcher *WatcherStatus `json:"watcher,omitempty"`
 }
 
 // HealthCheck performs a comprehensive health check of the embedded server.
@@ -29,7 +35,9 @@ type HealthStatus struct {
 // - Server status (started/stopped)
 // - gRPC connection health
 // - Datastore connectivity
-// - Schema availability (if schema files were provided)
+// - Schema availability (if schema files or URLs were provided)
+// - Assertions declared in YAML validation files (if any)
+// - The file watcher's circuit breaker (if schema files are watched)
 func (es *EmbeddedServer) HealthCheck(ctx context.Context) (*HealthStatus, error) {
 	status := &HealthStatus{
 		Status:    "", // Start with empty status, will be determined based on checks
@@ -44,7 +52,8 @@ func (es *EmbeddedServer) HealthCheck(ctx context.Context) (*HealthStatus, error
 	conn := es.conn
 	ds := es.datastore
 	reloader := es.reloader
-	schemaFiles := es.config.SchemaFiles
+	watcher := es.watcher
+	schemaConfigured := len(es.config.SchemaFiles) > 0 || len(es.config.SchemaURLs) > 0
 	es.mu.RUnlock()
 
 	// Check if server is started
@@ -76,7 +85,7 @@ func (es *EmbeddedServer) HealthCheck(ctx context.Context) (*HealthStatus, error
 		if schemaErr != nil {
 			// If no schema files are configured, treat "no schema defined" as still healthy:
 			// the server is up and can accept schema writes programmatically.
-			if len(schemaFiles) == 0 {
+			if !schemaConfigured {
 				if st, ok := grpcstatus.FromError(schemaErr); ok && st.Code() == codes.NotFound {
 					status.Checks["grpc_connection"] = "healthy (no schema defined)"
 				} else {
@@ -115,9 +124,9 @@ func (es *EmbeddedServer) HealthCheck(ctx context.Context) (*HealthStatus, error
 		}
 	}
 
-	// Check schema availability (if schema files were configured)
+	// Check schema availability (if schema files or URLs were configured)
 	// Reuse the schema response from the gRPC check above
-	if len(schemaFiles) > 0 {
+	if schemaConfigured {
 		if reloader == nil {
 			status.Checks["schema"] = "reloader_not_available"
 			status.Status = "degraded"
@@ -134,6 +143,39 @@ func (es *EmbeddedServer) HealthCheck(ctx context.Context) (*HealthStatus, error
 		status.Checks["schema"] = "not_configured"
 	}
 
+	// Report the assertions evaluated by the last reload
+	if reloader != nil {
+		if report := reloader.LastValidationReport(); report != nil {
+			status.Assertions = report
+			total := len(report.Results)
+			if report.Failed > 0 {
+				status.Checks["assertions"] = fmt.Sprintf("failed (%d/%d passed)", report.Passed, total)
+				if status.Status != "unhealthy" {
+					status.Status = "degraded"
+				}
+			} else {
+				status.Checks["assertions"] = fmt.Sprintf("passed (%d/%d)", report.Passed, total)
+			}
+		}
+	}
+
+	// Report whether hot reload is holding back reloads after consecutive failures
+	if watcher != nil {
+		watcherStatus := watcher.Status()
+		status.Watcher = &watcherStatus
+		switch watcherStatus.Circuit {
+		case CircuitClosed:
+			status.Checks["watcher"] = string(CircuitClosed)
+		case CircuitOpen:
+			status.Checks["watcher"] = fmt.Sprintf("open (%d consecutive failures, retry at %s)", watcherStatus.ConsecutiveFailures, watcherStatus.RetryAt.Format(time.RFC3339))
+		default:
+			status.Checks["watcher"] = fmt.Sprintf("%s (%d consecutive failures)", watcherStatus.Circuit, watcherStatus.ConsecutiveFailures)
+		}
+		if watcherStatus.Circuit != CircuitClosed && status.Status != "unhealthy" {
+			status.Status = "degraded"
+		}
+	}
+
 	// Determine overall status
 	if status.Status == "unhealthy" {
 		// Already set
@@ -176,8 +218,11 @@ func (es *EmbeddedServer) startHealthCheckServer(ctx context.Context) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", es.healthCheckHandler)
 	mux.HandleFunc("/health", es.healthCheckHandler) // Alias for /healthz
+	// The schema endpoints expose and change the schema, so they require the preshared key
+	mux.HandleFunc("GET /schema/history", es.requirePresharedKey(es.schemaHistoryHandler))
+	mux.HandleFunc("POST /schema/rollback", es.requirePresharedKey(es.schemaRollbackHandler))
 
-	srv, err := healthhttp.Start(es.config.HealthCheckAddress, mux)
+	srv, err := healthhttp.Start(es.config.HealthCheckAddress, es.config.SocketMode, es.listenerTLSConfig(), mux)
 	if err != nil {
 		return err
 	}
@@ -188,22 +233,3 @@ func (es *EmbeddedServer) startHealthCheckServer(ctx context.Context) error {
 
 	return nil
 }
-
-// stopHealthCheckServer stops the health check HTTP server.
-func (es *EmbeddedServer) stopHealthCheckServer(ctx context.Context) error {
-	if es.healthSrv == nil {
-		return nil
-	}
-
-	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	if err := es.healthSrv.Shutdown(shutdownCtx); err != nil {
-		log.Ctx(ctx).Warn().Err(err).Msg("error shutting down health check server")
-		return err
-	}
-	es.healthSrv = nil
-
-	log.Ctx(ctx).Info().Msg("health check server stopped")
-	return nil
-}
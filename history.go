@@ -0,0 +1,237 @@
+package embedspicedb
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// ErrSchemaVersionNotFound is returned by RollbackSchema when the requested version is not in the
+// schema history, either because it never existed or because it has been dropped from the history.
+var ErrSchemaVersionNotFound = errors.New("schema version not found in history")
+
+// SchemaVersion is a schema which was successfully written to SpiceDB.
+type SchemaVersion struct {
+	// Version numbers applied schemas in order, starting at 1.
+	Version int `json:"version"`
+
+	// Hash is the hex-encoded SHA-256 hash of Schema.
+	Hash string `json:"hash"`
+
+	// Schema is the schema text as written.
+	Schema string `json:"schema"`
+
+	// Files are the schema files the schema was read from.
+	Files []string `json:"files,omitempty"`
+
+	// AppliedAt is when the schema was written.
+	AppliedAt time.Time `json:"applied_at"`
+
+	// Revision is the ZedToken returned by WriteSchema.
+	Revision string `json:"revision"`
+
+	// RollbackOf is the version this version restored, or zero if it was loaded from the schema files.
+	RollbackOf int `json:"rollback_of,omitempty"`
+}
+
+// schemaHistory is a bounded, in-memory list of applied schemas, oldest first.
+type schemaHistory struct {
+	mu       sync.RWMutex
+	limit    int
+	next     int             // GUARDED_BY(mu)
+	versions []SchemaVersion // GUARDED_BY(mu)
+}
+
+func newSchemaHistory(limit int) *schemaHistory {
+	return &schemaHistory{limit: limit, next: 1}
+}
+
+// record adds an applied schema to the history and returns its entry. Writing the same schema as the
+// latest version does not create a new version; the latest version is returned instead.
+func (h *schemaHistory) record(v SchemaVersion) SchemaVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	v.Hash = schemaHash(v.Schema)
+	if n := len(h.versions); n > 0 && h.versions[n-1].Hash == v.Hash {
+		return h.versions[n-1]
+	}
+
+	v.Version = h.next
+	h.next++
+	h.versions = append(h.versions, v)
+	if len(h.versions) > h.limit {
+		h.versions = append([]SchemaVersion(nil), h.versions[len(h.versions)-h.limit:]...)
+	}
+	return v
+}
+
+func (h *schemaHistory) list() []SchemaVersion {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	versions := make([]SchemaVersion, len(h.versions))
+	copy(versions, h.versions)
+	return versions
+}
+
+func (h *schemaHistory) get(version int) (SchemaVersion, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, v := range h.versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return SchemaVersion{}, false
+}
+
+func schemaHash(schema string) string {
+	sum := sha256.Sum256([]byte(schema))
+	return hex.EncodeToString(sum[:])
+}
+
+// recordReload adds the schema written by a reload to the history and returns its version.
+// Reloads which did not write the schema are ignored and return zero.
+func (es *EmbeddedServer) recordReload(ctx context.Context, result *ReloadResult) int {
+	if result == nil || result.Revision == "" {
+		return 0
+	}
+
+	v := es.history.record(SchemaVersion{
+		Schema:    result.Schema,
+		Files:     result.Files,
+		AppliedAt: time.Now(),
+		Revision:  result.Revision,
+	})
+	log.Ctx(ctx).Debug().Int("version", v.Version).Str("hash", v.Hash).Msg("recorded schema version")
+	return v.Version
+}
+
+// SchemaHistory returns the schemas applied since the server was started, oldest first.
+// At most Config.SchemaHistorySize versions are kept.
+func (es *EmbeddedServer) SchemaHistory() []SchemaVersion {
+	return es.history.list()
+}
+
+// RollbackSchema writes the schema of a previous version from the history and records it as a new
+// version. Like reloads, rollbacks are subject to the destructive change policy: under
+// DestructiveChangesBlock, rolling back to a version lacking elements of the current schema fails
+// with a *DestructiveChangeError.
+// The rollback lasts until the next reload: when schema files are watched, the next change to them
+// is applied on top of the restored schema.
+func (es *EmbeddedServer) RollbackSchema(ctx context.Context, version int) (*SchemaVersion, error) {
+	es.mu.RLock()
+	if !es.started {
+		es.mu.RUnlock()
+		return nil, fmt.Errorf("server is not started")
+	}
+	if es.stopping {
+		es.mu.RUnlock()
+		return nil, fmt.Errorf("server is stopping")
+	}
+
+	if es.reloader == nil {
+		es.mu.RUnlock()
+		return nil, fmt.Errorf("no schema reloader available")
+	}
+
+	reloader := es.reloader
+	es.mu.RUnlock()
+
+	target, ok := es.history.get(version)
+	if !ok {
+		return nil, fmt.Errorf("version %d: %w", version, ErrSchemaVersionNotFound)
+	}
+
+	// Serialize with reloads so the history reflects the order in which schemas were written
+	es.schemaMu.Lock()
+	startedAt := time.Now()
+	result, err := reloader.ApplySchema(ctx, target.Schema)
+	result.Files = target.Files
+	if err != nil {
+		es.schemaMu.Unlock()
+		err = fmt.Errorf("failed to roll back to version %d: %w", version, err)
+		es.emitReloadEvent(newReloadEvent(ReloadTriggerRollback, nil, startedAt, result, 0, err))
+		return nil, err
+	}
+
+	v := es.history.record(SchemaVersion{
+		Schema:     target.Schema,
+		Files:      target.Files,
+		AppliedAt:  time.Now(),
+		Revision:   result.Revision,
+		RollbackOf: version,
+	})
+	es.schemaMu.Unlock()
+	log.Ctx(ctx).Info().Int("version", v.Version).Int("rollback_of", version).Msg("rolled back schema")
+
+	es.emitReloadEvent(newReloadEvent(ReloadTriggerRollback, nil, startedAt, result, v.Version, nil))
+
+	return &v, nil
+}
+
+// schemaHistoryHandler is an HTTP handler listing the schema history.
+func (es *EmbeddedServer) schemaHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(r.Context(), w, http.StatusOK, es.SchemaHistory())
+}
+
+// schemaRollbackHandler is an HTTP handler rolling back to the version given by the `version`
+// query parameter.
+func (es *EmbeddedServer) schemaRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil || version <= 0 {
+		writeJSON(ctx, w, http.StatusBadRequest, map[string]string{"error": "version must be a positive integer"})
+		return
+	}
+
+	v, err := es.RollbackSchema(ctx, version)
+	var destructiveErr *DestructiveChangeError
+	switch {
+	case errors.Is(err, ErrSchemaVersionNotFound):
+		writeJSON(ctx, w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.As(err, &destructiveErr):
+		writeJSON(ctx, w, http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(ctx, w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(ctx, w, http.StatusOK, v)
+	}
+}
+
+// requirePresharedKey wraps next so that it only serves requests authenticated, like API
+// requests, with the preshared key as a bearer token.
+func (es *EmbeddedServer) requirePresharedKey(next http.HandlerFunc) http.HandlerFunc {
+	want := []byte("Bearer " + es.config.PresharedKey)
+	return func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(r.Context(), w, http.StatusUnauthorized, map[string]string{"error": "a valid preshared key is required"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(ctx context.Context, w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("failed to encode response")
+	}
+}
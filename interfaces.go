@@ -12,6 +12,9 @@ type Server interface {
 	Start(ctx context.Context) error
 	Stop() error
 
+	// Shutdown stops the server, draining in-flight calls until ctx is done and then terminating them.
+	Shutdown(ctx context.Context) (*ShutdownReport, error)
+
 	// Client returns a gRPC connection to the embedded SpiceDB API.
 	Client(ctx context.Context) (*grpc.ClientConn, error)
 
@@ -26,4 +29,10 @@ type Server interface {
 
 	// HealthCheckHTTPAddr returns the bound address for the HTTP health endpoint, if enabled.
 	HealthCheckHTTPAddr() string
+
+	// GRPCAddr returns the bound address of the gRPC server, unless it is served in memory.
+	GRPCAddr() string
+
+	// HTTPAddr returns the bound address of the HTTP gateway, if enabled.
+	HTTPAddr() string
 }
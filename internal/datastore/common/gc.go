@@ -65,6 +65,7 @@ func RegisterGCMetrics() ([]prometheus.Collector, error) {
 	collectors := []prometheus.Collector{
 		gcDurationHistogram,
 		gcRelationshipsCounter,
+		gcExpiredRelationshipsCounter,
 		gcTransactionsCounter,
 		gcNamespacesCounter,
 		gcFailureCounter,
@@ -0,0 +1,182 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-memdb"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	"github.com/authzed/spicedb/pkg/datastore"
+)
+
+// BuildGarbageCollector returns a garbage collector which prunes revision snapshots and changelog
+// entries that have fallen out of the GC window, and deletes expired relationships.
+func (mdb *memdbDatastore) BuildGarbageCollector(_ context.Context) (common.GarbageCollector, error) {
+	mdb.RLock()
+	defer mdb.RUnlock()
+	if err := mdb.checkNotClosed(); err != nil {
+		return nil, err
+	}
+
+	return &memdbGarbageCollector{mdb: mdb}, nil
+}
+
+func (mdb *memdbDatastore) HasGCRun() bool {
+	return mdb.gcHasRun.Load()
+}
+
+func (mdb *memdbDatastore) MarkGCCompleted() {
+	mdb.gcHasRun.Store(true)
+}
+
+func (mdb *memdbDatastore) ResetGCCompleted() {
+	mdb.gcHasRun.Store(false)
+}
+
+// memdbGarbageCollector implements common.GarbageCollector for a single memdb datastore.
+type memdbGarbageCollector struct {
+	mdb *memdbDatastore
+}
+
+func (gc *memdbGarbageCollector) LockForGCRun(_ context.Context) (bool, error) {
+	return gc.mdb.gcRunLock.TryLock(), nil
+}
+
+func (gc *memdbGarbageCollector) UnlockAfterGCRun() error {
+	gc.mdb.gcRunLock.Unlock()
+	return nil
+}
+
+func (gc *memdbGarbageCollector) Now(_ context.Context) (time.Time, error) {
+	return time.Now().UTC(), nil
+}
+
+func (gc *memdbGarbageCollector) TxIDBefore(_ context.Context, before time.Time) (datastore.Revision, error) {
+	return revisions.NewForTime(before), nil
+}
+
+// DeleteBeforeTx drops revision snapshots and changelog entries older than txID. The most recent
+// snapshot is always retained so that the head revision remains readable.
+func (gc *memdbGarbageCollector) DeleteBeforeTx(ctx context.Context, txID datastore.Revision) (common.DeletionCounts, error) {
+	watermark, ok := txID.(revisions.TimestampRevision)
+	if !ok {
+		return common.DeletionCounts{}, fmt.Errorf("expected timestamp revision, got %T", txID)
+	}
+
+	var counts common.DeletionCounts
+	err := gc.mdb.withGCWriteTxn(ctx, func(tx *memdb.Txn) error {
+		keep := 0
+		for keep < len(gc.mdb.revisions)-1 && gc.mdb.revisions[keep].revision.LessThan(watermark) {
+			keep++
+		}
+		if keep > 0 {
+			gc.mdb.revisions = append([]snapshot(nil), gc.mdb.revisions[keep:]...)
+		}
+
+		var stale []*changelog
+		it, err := tx.Get(tableChangelog, indexRevision)
+		if err != nil {
+			return err
+		}
+		for raw := it.Next(); raw != nil; raw = it.Next() {
+			change := raw.(*changelog)
+			if change.revisionNanos < watermark.TimestampNanoSec() {
+				stale = append(stale, change)
+			}
+		}
+
+		for _, change := range stale {
+			if err := tx.Delete(tableChangelog, change); err != nil {
+				return fmt.Errorf("error deleting changelog entry: %w", err)
+			}
+		}
+
+		counts.Transactions = int64(len(stale))
+		return nil
+	})
+	return counts, err
+}
+
+// DeleteExpiredRels deletes relationships whose expiration is older than the GC window.
+func (gc *memdbGarbageCollector) DeleteExpiredRels(ctx context.Context) (int64, error) {
+	cutoff := time.Now().UTC().Add(time.Duration(gc.mdb.negativeGCWindow))
+
+	var deleted int64
+	err := gc.mdb.withGCWriteTxn(ctx, func(tx *memdb.Txn) error {
+		var expired []*relationship
+		it, err := tx.Get(tableRelationship, indexID)
+		if err != nil {
+			return err
+		}
+		for raw := it.Next(); raw != nil; raw = it.Next() {
+			rel := raw.(*relationship)
+			if rel.expiration != nil && rel.expiration.Before(cutoff) {
+				expired = append(expired, rel)
+			}
+		}
+
+		for _, rel := range expired {
+			if err := tx.Delete(tableRelationship, rel); err != nil {
+				return fmt.Errorf("error deleting expired relationship: %w", err)
+			}
+		}
+
+		deleted = int64(len(expired))
+		return nil
+	})
+	return deleted, err
+}
+
+func (gc *memdbGarbageCollector) Close() {}
+
+// withGCWriteTxn runs f in a write transaction against the live database while holding the
+// datastore lock. If a user transaction is in progress, it waits for it to complete first, since
+// memdb only allows a single writer.
+func (mdb *memdbDatastore) withGCWriteTxn(ctx context.Context, f func(tx *memdb.Txn) error) error {
+	for {
+		mdb.Lock()
+		if err := mdb.checkNotClosed(); err != nil {
+			mdb.Unlock()
+			return err
+		}
+		if mdb.activeWriteTxn == nil {
+			break
+		}
+		mdb.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Millisecond):
+		}
+	}
+	defer mdb.Unlock()
+
+	tx := mdb.db.Txn(true)
+	tx.TrackChanges()
+	if err := f(tx); err != nil {
+		tx.Abort()
+		return err
+	}
+
+	changes := tx.Changes()
+	if len(changes) == 0 {
+		tx.Abort()
+		return nil
+	}
+
+	if mdb.persist != nil {
+		if err := mdb.persist.appendCommit(mdb.headRevisionNoLock().TimestampNanoSec(), changes); err != nil {
+			tx.Abort()
+			return fmt.Errorf("error writing to write-ahead log: %w", err)
+		}
+	}
+
+	tx.Commit()
+	return nil
+}
+
+var _ common.GarbageCollectableDatastore = &memdbDatastore{}
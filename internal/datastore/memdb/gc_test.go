@@ -0,0 +1,88 @@
+package memdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/authzed/spicedb/pkg/datastore"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+func countChangelog(t *testing.T, mdb *memdbDatastore) int {
+	t.Helper()
+
+	mdb.RLock()
+	defer mdb.RUnlock()
+
+	txn := mdb.db.Txn(false)
+	defer txn.Abort()
+
+	it, err := txn.Get(tableChangelog, indexRevision)
+	require.NoError(t, err)
+
+	count := 0
+	for raw := it.Next(); raw != nil; raw = it.Next() {
+		count++
+	}
+	return count
+}
+
+func TestGarbageCollectionPrunesRevisionsAndChangelog(t *testing.T) {
+	ds, err := NewMemdbDatastore(0, 1*time.Millisecond, 50*time.Millisecond)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ds.Close() })
+
+	mdb := ds.(*memdbDatastore)
+	for i := 0; i < 5; i++ {
+		writeTestData(t, ds, "document:doc1#reader@user:alice")
+	}
+	require.Equal(t, 5, countChangelog(t, mdb))
+
+	time.Sleep(100 * time.Millisecond)
+
+	head := writeTestData(t, ds, "document:doc2#reader@user:bob")
+
+	require.NoError(t, common.RunGarbageCollection(t.Context(), mdb, 50*time.Millisecond))
+	require.True(t, mdb.HasGCRun())
+
+	mdb.RLock()
+	require.Len(t, mdb.revisions, 1)
+	require.True(t, mdb.revisions[0].revision.Equal(head))
+	mdb.RUnlock()
+	require.Equal(t, 1, countChangelog(t, mdb))
+
+	require.ElementsMatch(t, []string{
+		"document:doc1#reader@user:alice",
+		"document:doc2#reader@user:bob",
+	}, readTestRelationships(t, ds))
+}
+
+func TestGarbageCollectionDeletesExpiredRelationships(t *testing.T) {
+	ds, err := NewMemdbDatastore(0, 1*time.Millisecond, 50*time.Millisecond)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ds.Close() })
+
+	writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	expired := tuple.MustParse("document:doc2#reader@user:bob")
+	expiration := time.Now().Add(-1 * time.Hour)
+	expired.OptionalExpiration = &expiration
+	_, err = ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		return rwt.WriteRelationships(ctx, []tuple.RelationshipUpdate{tuple.Touch(expired)})
+	})
+	require.NoError(t, err)
+
+	gc, err := ds.(*memdbDatastore).BuildGarbageCollector(t.Context())
+	require.NoError(t, err)
+	defer gc.Close()
+
+	deleted, err := gc.DeleteExpiredRels(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	require.Equal(t, []string{"document:doc1#reader@user:alice"}, readTestRelationships(t, ds))
+}
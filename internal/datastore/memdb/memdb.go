@@ -7,6 +7,7 @@ import (
 	"math"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/akoserwal/embedspicedb/internal/datastore/common"
 	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	log "github.com/akoserwal/embedspicedb/internal/logging"
 	"github.com/authzed/spicedb/pkg/datastore"
 	"github.com/authzed/spicedb/pkg/datastore/options"
 	corev1 "github.com/authzed/spicedb/pkg/proto/core/v1"
@@ -48,6 +50,60 @@ func NewMemdbDatastore(
 		return nil, errors.New("gc window must be larger than quantization interval")
 	}
 
+	mdb, err := newMemdbDatastore(watchBufferLength, revisionQuantization, gcWindow)
+	if err != nil {
+		return nil, err
+	}
+	return mdb, nil
+}
+
+// NewPersistentMemdbDatastore creates a new memdb datastore whose contents survive restarts.
+//
+// Every committed transaction is appended to a write-ahead log in dataDir and a full snapshot of
+// all tables is periodically written, after which the log is truncated. On creation, any existing
+// snapshot and log in dataDir are loaded before the datastore is returned.
+func NewPersistentMemdbDatastore(
+	dataDir string,
+	watchBufferLength uint16,
+	revisionQuantization,
+	gcWindow time.Duration,
+) (datastore.Datastore, error) {
+	if revisionQuantization > gcWindow {
+		return nil, errors.New("gc window must be larger than quantization interval")
+	}
+
+	mdb, err := newMemdbDatastore(watchBufferLength, revisionQuantization, gcWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := openPersister(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveredNanos, err := p.restore(mdb.db)
+	if err != nil {
+		return nil, fmt.Errorf("unable to recover memdb datastore from %s: %w", dataDir, err)
+	}
+
+	// Ensure the head revision never moves backwards relative to recovered data, even if the
+	// clock has since been adjusted.
+	head := nowRevision()
+	if recoveredNanos >= head.TimestampNanoSec() {
+		head = revisions.NewForTimestamp(recoveredNanos + 1)
+	}
+	mdb.revisions[0].revision = head
+	mdb.persist = p
+
+	return mdb, nil
+}
+
+func newMemdbDatastore(
+	watchBufferLength uint16,
+	revisionQuantization,
+	gcWindow time.Duration,
+) (*memdbDatastore, error) {
 	if revisionQuantization <= 1 {
 		revisionQuantization = 1
 	}
@@ -91,6 +147,12 @@ type memdbDatastore struct {
 	revisions      []snapshot   // GUARDED_BY(RWMutex)
 	activeWriteTxn *memdb.Txn   // GUARDED_BY(RWMutex)
 
+	// persist is nil unless the datastore was created with NewPersistentMemdbDatastore.
+	persist *persister // GUARDED_BY(RWMutex)
+
+	gcRunLock sync.Mutex
+	gcHasRun  atomic.Bool
+
 	negativeGCWindow        int64
 	quantizationPeriod      int64
 	watchBufferLength       uint16
@@ -313,6 +375,14 @@ func (mdb *memdbDatastore) ReadWriteTx(
 				return datastore.NoRevision, fmt.Errorf("error writing changelog: %w", err)
 			}
 
+			if mdb.persist != nil {
+				if err := mdb.persist.appendCommit(newRevision.TimestampNanoSec(), tx.Changes()); err != nil {
+					tx.Abort()
+					mdb.activeWriteTxn = nil
+					return datastore.NoRevision, fmt.Errorf("error writing to write-ahead log: %w", err)
+				}
+			}
+
 			tx.Commit()
 		}
 		mdb.activeWriteTxn = nil
@@ -324,6 +394,15 @@ func (mdb *memdbDatastore) ReadWriteTx(
 		// Create a snapshot and add it to the revisions slice
 		snap := mdb.db.Snapshot()
 		mdb.revisions = append(mdb.revisions, snapshot{newRevision, snap})
+
+		if mdb.persist != nil && mdb.persist.shouldSnapshot() {
+			// The commit is already durable in the write-ahead log, so a failed snapshot only
+			// delays compaction of the log.
+			if err := mdb.persist.writeSnapshot(mdb.db, newRevision.TimestampNanoSec()); err != nil {
+				log.Ctx(ctx).Warn().Err(err).Msg("failed to write memdb snapshot")
+			}
+		}
+
 		return newRevision, nil
 	}
 
@@ -365,6 +444,16 @@ func (mdb *memdbDatastore) Close() error {
 	mdb.Lock()
 	defer mdb.Unlock()
 
+	var persistErr error
+	if mdb.persist != nil {
+		var head int64
+		if len(mdb.revisions) > 0 {
+			head = mdb.headRevisionNoLock().TimestampNanoSec()
+		}
+		persistErr = mdb.persist.close(mdb.db, head)
+		mdb.persist = nil
+	}
+
 	if db := mdb.db; db != nil {
 		mdb.revisions = []snapshot{
 			{
@@ -378,7 +467,7 @@ func (mdb *memdbDatastore) Close() error {
 
 	mdb.db = nil
 
-	return nil
+	return persistErr
 }
 
 // This code assumes that the RWMutex has been acquired.
@@ -0,0 +1,811 @@
+package memdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/go-memdb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+	"github.com/authzed/spicedb/pkg/datastore"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+const (
+	snapshotFileName = "memdb.snapshot"
+	walFileName      = "memdb.wal"
+
+	// defaultSnapshotThreshold is the number of write-ahead log records after which
+	// a full snapshot is written and the log is truncated.
+	defaultSnapshotThreshold = 1000
+
+	// walRecordHeaderSize is the size of the length + CRC32 prefix of each log record.
+	walRecordHeaderSize = 8
+)
+
+// persister stores the contents of a memdb datastore on disk as a full snapshot
+// plus a write-ahead log of every transaction committed since that snapshot.
+//
+// NOTE: all methods must be called with the datastore lock held.
+type persister struct {
+	dir               string
+	wal               walWriter
+	walRecords        int
+	snapshotThreshold int
+
+	// broken is set when a failed append could not be rolled back, leaving a record in the log
+	// which must not be followed by others. Appends fail until a snapshot truncates the log.
+	broken error
+}
+
+// walWriter is the write-ahead log file, an *os.File outside of tests.
+type walWriter interface {
+	io.WriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// walRecord is a single committed transaction.
+type walRecord struct {
+	RevisionNanos int64
+	Mutations     []walMutation
+}
+
+type walMutation struct {
+	Table  string
+	Delete bool
+	Row    persistedRow
+}
+
+// persistedSnapshot is the full contents of all memdb tables at a revision.
+type persistedSnapshot struct {
+	RevisionNanos int64
+	Namespaces    []persistedNamespace
+	Relationships []persistedRelationship
+	Caveats       []persistedCaveat
+	Counters      []persistedCounter
+	Changelog     []persistedChangelog
+}
+
+// persistedRow holds exactly one row of any of the memdb tables.
+type persistedRow struct {
+	Namespace    *persistedNamespace
+	Relationship *persistedRelationship
+	Caveat       *persistedCaveat
+	Counter      *persistedCounter
+	Changelog    *persistedChangelog
+}
+
+type persistedNamespace struct {
+	Name         string
+	ConfigBytes  []byte
+	UpdatedNanos int64
+}
+
+type persistedRelationship struct {
+	Namespace        string
+	ResourceID       string
+	Relation         string
+	SubjectNamespace string
+	SubjectObjectID  string
+	SubjectRelation  string
+	HasCaveat        bool
+	CaveatName       string
+	CaveatContext    []byte
+	HasIntegrity     bool
+	IntegrityKeyID   string
+	IntegrityHash    []byte
+	IntegrityTime    time.Time
+	Expiration       *time.Time
+}
+
+type persistedCaveat struct {
+	Name          string
+	Definition    []byte
+	RevisionNanos int64
+}
+
+type persistedCounter struct {
+	Name         string
+	FilterBytes  []byte
+	Count        int
+	UpdatedNanos int64
+}
+
+type persistedChangelog struct {
+	RevisionNanos       int64
+	IsCheckpoint        bool
+	RelationshipChanges []persistedRelationshipUpdate
+	ChangedNamespaces   [][]byte
+	ChangedCaveats      [][]byte
+	DeletedNamespaces   []string
+	DeletedCaveats      []string
+	Metadatas           [][]byte
+}
+
+type persistedRelationshipUpdate struct {
+	Operation    tuple.UpdateOperation
+	Relationship persistedRelationship
+}
+
+// openPersister creates the data directory if necessary and returns a persister for it.
+// restore must be called before any other method.
+func openPersister(dir string) (*persister, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create memdb data directory %s: %w", dir, err)
+	}
+
+	return &persister{
+		dir:               dir,
+		snapshotThreshold: defaultSnapshotThreshold,
+	}, nil
+}
+
+func (p *persister) snapshotPath() string {
+	return filepath.Join(p.dir, snapshotFileName)
+}
+
+func (p *persister) walPath() string {
+	return filepath.Join(p.dir, walFileName)
+}
+
+// restore loads the latest snapshot and replays the write-ahead log into db, returning the
+// highest recovered revision (or zero if there was nothing to recover). A torn or corrupt
+// record at the end of the log, as left behind by a crash mid-write, is discarded.
+func (p *persister) restore(db *memdb.MemDB) (int64, error) {
+	tx := db.Txn(true)
+	defer tx.Abort()
+
+	var lastRevision int64
+
+	snapshotBytes, err := os.ReadFile(p.snapshotPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Nothing to load.
+	case err != nil:
+		return 0, fmt.Errorf("unable to read memdb snapshot: %w", err)
+	default:
+		var snap persistedSnapshot
+		if err := gob.NewDecoder(bytes.NewReader(snapshotBytes)).Decode(&snap); err != nil {
+			return 0, fmt.Errorf("unable to decode memdb snapshot: %w", err)
+		}
+		if err := loadSnapshot(tx, snap); err != nil {
+			return 0, fmt.Errorf("unable to load memdb snapshot: %w", err)
+		}
+		lastRevision = snap.RevisionNanos
+	}
+
+	walFile, err := os.OpenFile(p.walPath(), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open memdb write-ahead log: %w", err)
+	}
+
+	validOffset, records, walRevision, err := replayWAL(tx, walFile)
+	if err != nil {
+		_ = walFile.Close()
+		return 0, err
+	}
+
+	info, err := walFile.Stat()
+	if err != nil {
+		_ = walFile.Close()
+		return 0, fmt.Errorf("unable to stat memdb write-ahead log: %w", err)
+	}
+	if info.Size() > validOffset {
+		log.Warn().
+			Int64("offset", validOffset).
+			Int64("size", info.Size()).
+			Msg("discarding incomplete trailing record in memdb write-ahead log")
+		if err := walFile.Truncate(validOffset); err != nil {
+			_ = walFile.Close()
+			return 0, fmt.Errorf("unable to truncate memdb write-ahead log: %w", err)
+		}
+	}
+	if _, err := walFile.Seek(validOffset, io.SeekStart); err != nil {
+		_ = walFile.Close()
+		return 0, fmt.Errorf("unable to seek memdb write-ahead log: %w", err)
+	}
+
+	tx.Commit()
+
+	p.wal = walFile
+	p.walRecords = records
+	return max(lastRevision, walRevision), nil
+}
+
+// replayWAL applies every intact record of the log to tx, returning the offset just past the
+// last intact record.
+func replayWAL(tx *memdb.Txn, walFile *os.File) (int64, int, int64, error) {
+	reader := bufio.NewReader(walFile)
+	header := make([]byte, walRecordHeaderSize)
+
+	var offset int64
+	var records int
+	var lastRevision int64
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			// io.EOF is a clean end of log, anything else is a torn header.
+			return offset, records, lastRevision, nil
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		checksum := binary.BigEndian.Uint32(header[4:8])
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return offset, records, lastRevision, nil
+		}
+		if crc32.ChecksumIEEE(payload) != checksum {
+			return offset, records, lastRevision, nil
+		}
+
+		var record walRecord
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			return offset, records, lastRevision, nil
+		}
+
+		for _, mutation := range record.Mutations {
+			if err := applyMutation(tx, mutation); err != nil {
+				return 0, 0, 0, fmt.Errorf("unable to replay memdb write-ahead log at offset %d: %w", offset, err)
+			}
+		}
+
+		offset += int64(walRecordHeaderSize) + int64(length)
+		records++
+		lastRevision = record.RevisionNanos
+	}
+}
+
+// appendCommit durably appends the changes of a transaction to the write-ahead log.
+// It must be called before the transaction is committed. If it fails, the log is rolled back, so
+// neither the failed commit nor a torn record of it is replayed on recovery.
+func (p *persister) appendCommit(revisionNanos int64, changes memdb.Changes) error {
+	if p.broken != nil {
+		return fmt.Errorf("memdb write-ahead log could not be rolled back after a failed write: %w", p.broken)
+	}
+
+	record := walRecord{
+		RevisionNanos: revisionNanos,
+		Mutations:     make([]walMutation, 0, len(changes)),
+	}
+
+	for _, change := range changes {
+		mutation := walMutation{Table: change.Table}
+
+		obj := change.After
+		if obj == nil {
+			mutation.Delete = true
+			obj = change.Before
+		}
+
+		row, err := toPersistedRow(obj)
+		if err != nil {
+			return err
+		}
+		mutation.Row = row
+		record.Mutations = append(record.Mutations, mutation)
+	}
+
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(record); err != nil {
+		return fmt.Errorf("unable to encode write-ahead log record: %w", err)
+	}
+
+	buf := make([]byte, walRecordHeaderSize, walRecordHeaderSize+payload.Len())
+	binary.BigEndian.PutUint32(buf[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	buf = append(buf, payload.Bytes()...)
+
+	offset, err := p.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("unable to seek memdb write-ahead log: %w", err)
+	}
+	if err := p.writeRecord(buf); err != nil {
+		if rollbackErr := p.truncateWAL(offset); rollbackErr != nil {
+			log.Error().Err(rollbackErr).Int64("offset", offset).Msg("unable to roll back memdb write-ahead log; failing writes until the next snapshot")
+			p.broken = rollbackErr
+		}
+		return err
+	}
+
+	p.walRecords++
+	return nil
+}
+
+// writeRecord writes and syncs an encoded record at the end of the write-ahead log.
+func (p *persister) writeRecord(buf []byte) error {
+	if _, err := p.wal.Write(buf); err != nil {
+		return err
+	}
+	return p.wal.Sync()
+}
+
+// truncateWAL discards the write-ahead log past offset, where the next record is then written.
+func (p *persister) truncateWAL(offset int64) error {
+	if err := p.wal.Truncate(offset); err != nil {
+		return fmt.Errorf("unable to truncate memdb write-ahead log: %w", err)
+	}
+	if _, err := p.wal.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("unable to seek memdb write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// shouldSnapshot returns true if the write-ahead log has grown enough to warrant compaction.
+func (p *persister) shouldSnapshot() bool {
+	return p.walRecords >= p.snapshotThreshold
+}
+
+// writeSnapshot writes the full contents of db atomically and then truncates the write-ahead log.
+func (p *persister) writeSnapshot(db *memdb.MemDB, revisionNanos int64) error {
+	snap, err := buildSnapshot(db, revisionNanos)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := p.snapshotPath() + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to create memdb snapshot: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmpFile)
+	if err := gob.NewEncoder(writer).Encode(snap); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to encode memdb snapshot: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to write memdb snapshot: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("unable to sync memdb snapshot: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("unable to close memdb snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, p.snapshotPath()); err != nil {
+		return fmt.Errorf("unable to replace memdb snapshot: %w", err)
+	}
+	syncDir(p.dir)
+
+	// Everything in the log is now covered by the snapshot.
+	if err := p.truncateWAL(0); err != nil {
+		return err
+	}
+	p.walRecords = 0
+	p.broken = nil
+
+	return nil
+}
+
+// close writes a final snapshot and releases the write-ahead log.
+func (p *persister) close(db *memdb.MemDB, revisionNanos int64) error {
+	if p.wal == nil {
+		return nil
+	}
+
+	var snapErr error
+	if db != nil {
+		snapErr = p.writeSnapshot(db, revisionNanos)
+	}
+
+	closeErr := p.wal.Close()
+	p.wal = nil
+
+	return errors.Join(snapErr, closeErr)
+}
+
+// syncDir makes a rename within dir durable. Not all platforms support syncing
+// directories, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+func buildSnapshot(db *memdb.MemDB, revisionNanos int64) (persistedSnapshot, error) {
+	tx := db.Txn(false)
+	defer tx.Abort()
+
+	snap := persistedSnapshot{RevisionNanos: revisionNanos}
+	for _, table := range []string{tableNamespace, tableRelationship, tableCaveats, tableCounters, tableChangelog} {
+		it, err := tx.Get(table, indexID)
+		if err != nil {
+			return persistedSnapshot{}, fmt.Errorf("unable to read table %s: %w", table, err)
+		}
+
+		for raw := it.Next(); raw != nil; raw = it.Next() {
+			row, err := toPersistedRow(raw)
+			if err != nil {
+				return persistedSnapshot{}, err
+			}
+
+			switch {
+			case row.Namespace != nil:
+				snap.Namespaces = append(snap.Namespaces, *row.Namespace)
+			case row.Relationship != nil:
+				snap.Relationships = append(snap.Relationships, *row.Relationship)
+			case row.Caveat != nil:
+				snap.Caveats = append(snap.Caveats, *row.Caveat)
+			case row.Counter != nil:
+				snap.Counters = append(snap.Counters, *row.Counter)
+			case row.Changelog != nil:
+				snap.Changelog = append(snap.Changelog, *row.Changelog)
+			}
+		}
+	}
+
+	return snap, nil
+}
+
+func loadSnapshot(tx *memdb.Txn, snap persistedSnapshot) error {
+	for i := range snap.Namespaces {
+		if err := tx.Insert(tableNamespace, snap.Namespaces[i].namespace()); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Relationships {
+		rel, err := snap.Relationships[i].relationship()
+		if err != nil {
+			return err
+		}
+		if err := tx.Insert(tableRelationship, rel); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Caveats {
+		if err := tx.Insert(tableCaveats, snap.Caveats[i].caveat()); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Counters {
+		if err := tx.Insert(tableCounters, snap.Counters[i].counter()); err != nil {
+			return err
+		}
+	}
+	for i := range snap.Changelog {
+		cl, err := snap.Changelog[i].changelog()
+		if err != nil {
+			return err
+		}
+		if err := tx.Insert(tableChangelog, cl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMutation(tx *memdb.Txn, mutation walMutation) error {
+	obj, err := mutation.Row.object()
+	if err != nil {
+		return err
+	}
+
+	if mutation.Delete {
+		err := tx.Delete(mutation.Table, obj)
+		if errors.Is(err, memdb.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	return tx.Insert(mutation.Table, obj)
+}
+
+func toPersistedRow(obj any) (persistedRow, error) {
+	switch row := obj.(type) {
+	case *namespace:
+		return persistedRow{Namespace: &persistedNamespace{
+			Name:         row.name,
+			ConfigBytes:  row.configBytes,
+			UpdatedNanos: revisionNanos(row.updated),
+		}}, nil
+
+	case *relationship:
+		rel, err := persistRelationship(row)
+		if err != nil {
+			return persistedRow{}, err
+		}
+		return persistedRow{Relationship: &rel}, nil
+
+	case *caveat:
+		return persistedRow{Caveat: &persistedCaveat{
+			Name:          row.name,
+			Definition:    row.definition,
+			RevisionNanos: revisionNanos(row.revision),
+		}}, nil
+
+	case *counter:
+		return persistedRow{Counter: &persistedCounter{
+			Name:         row.name,
+			FilterBytes:  row.filterBytes,
+			Count:        row.count,
+			UpdatedNanos: revisionNanos(row.updated),
+		}}, nil
+
+	case *changelog:
+		cl, err := persistChangelog(row)
+		if err != nil {
+			return persistedRow{}, err
+		}
+		return persistedRow{Changelog: &cl}, nil
+
+	default:
+		return persistedRow{}, fmt.Errorf("unable to persist unknown memdb row type %T", obj)
+	}
+}
+
+func (r persistedRow) object() (any, error) {
+	switch {
+	case r.Namespace != nil:
+		return r.Namespace.namespace(), nil
+	case r.Relationship != nil:
+		return r.Relationship.relationship()
+	case r.Caveat != nil:
+		return r.Caveat.caveat(), nil
+	case r.Counter != nil:
+		return r.Counter.counter(), nil
+	case r.Changelog != nil:
+		return r.Changelog.changelog()
+	default:
+		return nil, errors.New("empty memdb row in write-ahead log")
+	}
+}
+
+func (pn persistedNamespace) namespace() *namespace {
+	return &namespace{
+		name:        pn.Name,
+		configBytes: pn.ConfigBytes,
+		updated:     revisionFromNanos(pn.UpdatedNanos),
+	}
+}
+
+func (pc persistedCaveat) caveat() *caveat {
+	return &caveat{
+		name:       pc.Name,
+		definition: pc.Definition,
+		revision:   revisionFromNanos(pc.RevisionNanos),
+	}
+}
+
+func (pc persistedCounter) counter() *counter {
+	return &counter{
+		name:        pc.Name,
+		filterBytes: pc.FilterBytes,
+		count:       pc.Count,
+		updated:     revisionFromNanos(pc.UpdatedNanos),
+	}
+}
+
+func persistRelationship(rel *relationship) (persistedRelationship, error) {
+	persisted := persistedRelationship{
+		Namespace:        rel.namespace,
+		ResourceID:       rel.resourceID,
+		Relation:         rel.relation,
+		SubjectNamespace: rel.subjectNamespace,
+		SubjectObjectID:  rel.subjectObjectID,
+		SubjectRelation:  rel.subjectRelation,
+		Expiration:       rel.expiration,
+	}
+
+	if rel.caveat != nil {
+		caveatContext, err := structpb.NewStruct(rel.caveat.context)
+		if err != nil {
+			return persistedRelationship{}, fmt.Errorf("unable to persist caveat context: %w", err)
+		}
+		contextBytes, err := proto.Marshal(caveatContext)
+		if err != nil {
+			return persistedRelationship{}, fmt.Errorf("unable to persist caveat context: %w", err)
+		}
+
+		persisted.HasCaveat = true
+		persisted.CaveatName = rel.caveat.caveatName
+		persisted.CaveatContext = contextBytes
+	}
+
+	if rel.integrity != nil {
+		persisted.HasIntegrity = true
+		persisted.IntegrityKeyID = rel.integrity.keyID
+		persisted.IntegrityHash = rel.integrity.hash
+		persisted.IntegrityTime = rel.integrity.timestamp
+	}
+
+	return persisted, nil
+}
+
+func (pr persistedRelationship) relationship() (*relationship, error) {
+	rel := &relationship{
+		namespace:        pr.Namespace,
+		resourceID:       pr.ResourceID,
+		relation:         pr.Relation,
+		subjectNamespace: pr.SubjectNamespace,
+		subjectObjectID:  pr.SubjectObjectID,
+		subjectRelation:  pr.SubjectRelation,
+		expiration:       pr.Expiration,
+	}
+
+	if pr.HasCaveat {
+		caveatContext := &structpb.Struct{}
+		if err := proto.Unmarshal(pr.CaveatContext, caveatContext); err != nil {
+			return nil, fmt.Errorf("unable to load caveat context: %w", err)
+		}
+		rel.caveat = &contextualizedCaveat{
+			caveatName: pr.CaveatName,
+			context:    caveatContext.AsMap(),
+		}
+	}
+
+	if pr.HasIntegrity {
+		rel.integrity = &relationshipIntegrity{
+			keyID:     pr.IntegrityKeyID,
+			hash:      pr.IntegrityHash,
+			timestamp: pr.IntegrityTime,
+		}
+	}
+
+	return rel, nil
+}
+
+func persistRelationshipUpdate(update tuple.RelationshipUpdate) (persistedRelationshipUpdate, error) {
+	rel := &relationship{
+		namespace:        update.Relationship.Resource.ObjectType,
+		resourceID:       update.Relationship.Resource.ObjectID,
+		relation:         update.Relationship.Resource.Relation,
+		subjectNamespace: update.Relationship.Subject.ObjectType,
+		subjectObjectID:  update.Relationship.Subject.ObjectID,
+		subjectRelation:  update.Relationship.Subject.Relation,
+		expiration:       update.Relationship.OptionalExpiration,
+	}
+	if update.Relationship.OptionalCaveat != nil {
+		rel.caveat = &contextualizedCaveat{
+			caveatName: update.Relationship.OptionalCaveat.CaveatName,
+			context:    update.Relationship.OptionalCaveat.Context.AsMap(),
+		}
+	}
+	if ig := update.Relationship.OptionalIntegrity; ig != nil {
+		rel.integrity = &relationshipIntegrity{
+			keyID:     ig.KeyId,
+			hash:      ig.Hash,
+			timestamp: ig.HashedAt.AsTime(),
+		}
+	}
+
+	persisted, err := persistRelationship(rel)
+	if err != nil {
+		return persistedRelationshipUpdate{}, err
+	}
+	return persistedRelationshipUpdate{Operation: update.Operation, Relationship: persisted}, nil
+}
+
+func persistChangelog(cl *changelog) (persistedChangelog, error) {
+	persisted := persistedChangelog{
+		RevisionNanos:     cl.revisionNanos,
+		IsCheckpoint:      cl.changes.IsCheckpoint,
+		DeletedNamespaces: cl.changes.DeletedNamespaces,
+		DeletedCaveats:    cl.changes.DeletedCaveats,
+	}
+
+	for _, update := range cl.changes.RelationshipChanges {
+		pu, err := persistRelationshipUpdate(update)
+		if err != nil {
+			return persistedChangelog{}, err
+		}
+		persisted.RelationshipChanges = append(persisted.RelationshipChanges, pu)
+	}
+
+	for _, def := range cl.changes.ChangedDefinitions {
+		switch typed := def.(type) {
+		case *core.NamespaceDefinition:
+			serialized, err := typed.MarshalVT()
+			if err != nil {
+				return persistedChangelog{}, err
+			}
+			persisted.ChangedNamespaces = append(persisted.ChangedNamespaces, serialized)
+		case *core.CaveatDefinition:
+			serialized, err := typed.MarshalVT()
+			if err != nil {
+				return persistedChangelog{}, err
+			}
+			persisted.ChangedCaveats = append(persisted.ChangedCaveats, serialized)
+		default:
+			return persistedChangelog{}, fmt.Errorf("unable to persist unknown schema definition type %T", def)
+		}
+	}
+
+	for _, metadata := range cl.changes.Metadatas {
+		serialized, err := proto.Marshal(metadata)
+		if err != nil {
+			return persistedChangelog{}, err
+		}
+		persisted.Metadatas = append(persisted.Metadatas, serialized)
+	}
+
+	return persisted, nil
+}
+
+func (pc persistedChangelog) changelog() (*changelog, error) {
+	changes := datastore.RevisionChanges{
+		Revision:          revisions.NewForTimestamp(pc.RevisionNanos),
+		IsCheckpoint:      pc.IsCheckpoint,
+		DeletedNamespaces: pc.DeletedNamespaces,
+		DeletedCaveats:    pc.DeletedCaveats,
+	}
+
+	for _, pu := range pc.RelationshipChanges {
+		rel, err := pu.Relationship.relationship()
+		if err != nil {
+			return nil, err
+		}
+		rt, err := rel.Relationship()
+		if err != nil {
+			return nil, err
+		}
+		changes.RelationshipChanges = append(changes.RelationshipChanges, tuple.RelationshipUpdate{
+			Operation:    pu.Operation,
+			Relationship: rt,
+		})
+	}
+
+	for _, serialized := range pc.ChangedNamespaces {
+		loaded := &core.NamespaceDefinition{}
+		if err := loaded.UnmarshalVT(serialized); err != nil {
+			return nil, err
+		}
+		changes.ChangedDefinitions = append(changes.ChangedDefinitions, loaded)
+	}
+
+	for _, serialized := range pc.ChangedCaveats {
+		loaded := &core.CaveatDefinition{}
+		if err := loaded.UnmarshalVT(serialized); err != nil {
+			return nil, err
+		}
+		changes.ChangedDefinitions = append(changes.ChangedDefinitions, loaded)
+	}
+
+	for _, serialized := range pc.Metadatas {
+		loaded := &structpb.Struct{}
+		if err := proto.Unmarshal(serialized, loaded); err != nil {
+			return nil, err
+		}
+		changes.Metadatas = append(changes.Metadatas, loaded)
+	}
+
+	return &changelog{
+		revisionNanos: pc.RevisionNanos,
+		changes:       changes,
+	}, nil
+}
+
+// revisionNanos returns the timestamp of a memdb revision, or zero for datastore.NoRevision.
+func revisionNanos(rev datastore.Revision) int64 {
+	if tr, ok := rev.(revisions.TimestampRevision); ok {
+		return tr.TimestampNanoSec()
+	}
+	return 0
+}
+
+func revisionFromNanos(nanos int64) datastore.Revision {
+	if nanos == 0 {
+		return datastore.NoRevision
+	}
+	return revisions.NewForTimestamp(nanos)
+}
@@ -0,0 +1,244 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/authzed/spicedb/pkg/datastore"
+	ns "github.com/authzed/spicedb/pkg/namespace"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+func writeTestData(t *testing.T, ds datastore.Datastore, rels ...string) datastore.Revision {
+	t.Helper()
+
+	rev, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		if err := rwt.WriteNamespaces(ctx,
+			ns.Namespace("user"),
+			ns.Namespace("document", ns.MustRelation("reader", nil)),
+		); err != nil {
+			return err
+		}
+
+		updates := make([]tuple.RelationshipUpdate, 0, len(rels))
+		for _, rel := range rels {
+			updates = append(updates, tuple.Touch(tuple.MustParse(rel)))
+		}
+		return rwt.WriteRelationships(ctx, updates)
+	})
+	require.NoError(t, err)
+	return rev
+}
+
+func readTestRelationships(t *testing.T, ds datastore.Datastore) []string {
+	t.Helper()
+
+	head, err := ds.HeadRevision(t.Context())
+	require.NoError(t, err)
+
+	iter, err := ds.SnapshotReader(head).QueryRelationships(t.Context(), datastore.RelationshipsFilter{
+		OptionalResourceType: "document",
+	})
+	require.NoError(t, err)
+
+	var found []string
+	for rel, err := range iter {
+		require.NoError(t, err)
+		found = append(found, tuple.MustString(rel))
+	}
+	return found
+}
+
+func TestPersistentMemdbSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	ds, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+
+	written := writeTestData(t, ds, "document:doc1#reader@user:alice", "document:doc2#reader@user:bob")
+	require.NoError(t, ds.Close())
+
+	reopened, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = reopened.Close() })
+
+	head, err := reopened.HeadRevision(t.Context())
+	require.NoError(t, err)
+	require.True(t, head.GreaterThan(written))
+
+	require.ElementsMatch(t, []string{
+		"document:doc1#reader@user:alice",
+		"document:doc2#reader@user:bob",
+	}, readTestRelationships(t, reopened))
+
+	nsDef, _, err := reopened.SnapshotReader(head).ReadNamespaceByName(t.Context(), "document")
+	require.NoError(t, err)
+	require.Equal(t, "document", nsDef.Name)
+}
+
+func TestPersistentMemdbReplaysWriteAheadLog(t *testing.T) {
+	dir := t.TempDir()
+
+	ds, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	// Simulate a crash: reopen without calling Close, so no final snapshot is written.
+	crashed := ds.(*memdbDatastore)
+	crashed.Lock()
+	require.NoError(t, crashed.persist.wal.Close())
+	crashed.persist = nil
+	crashed.Unlock()
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	reopened, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = reopened.Close() })
+
+	require.Equal(t, []string{"document:doc1#reader@user:alice"}, readTestRelationships(t, reopened))
+}
+
+func TestPersistentMemdbDiscardsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	ds, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	crashed := ds.(*memdbDatastore)
+	crashed.Lock()
+	require.NoError(t, crashed.persist.wal.Close())
+	crashed.persist = nil
+	crashed.Unlock()
+
+	// Append a partial record, as left behind by a crash mid-write.
+	walFile, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = walFile.Write([]byte{0, 0, 1, 0, 0xde, 0xad})
+	require.NoError(t, err)
+	require.NoError(t, walFile.Close())
+
+	reopened, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = reopened.Close() })
+
+	require.Equal(t, []string{"document:doc1#reader@user:alice"}, readTestRelationships(t, reopened))
+
+	// New writes must still be readable after the torn record was discarded.
+	writeTestData(t, reopened, "document:doc2#reader@user:bob")
+	require.NoError(t, reopened.Close())
+
+	again, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = again.Close() })
+
+	require.ElementsMatch(t, []string{
+		"document:doc1#reader@user:alice",
+		"document:doc2#reader@user:bob",
+	}, readTestRelationships(t, again))
+}
+
+// failingWAL fails writes to the write-ahead log it wraps, after writing the first partial bytes
+// of them, or fails syncing them if partial is negative.
+type failingWAL struct {
+	walWriter
+	partial int
+}
+
+func (f *failingWAL) Write(b []byte) (int, error) {
+	if f.partial < 0 {
+		return f.walWriter.Write(b)
+	}
+	n, _ := f.walWriter.Write(b[:min(f.partial, len(b))])
+	return n, errors.New("injected write failure")
+}
+
+func (f *failingWAL) Sync() error {
+	if f.partial < 0 {
+		return errors.New("injected sync failure")
+	}
+	return f.walWriter.Sync()
+}
+
+func TestPersistentMemdbRollsBackFailedAppend(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		partial int
+	}{
+		{name: "torn write", partial: 10},
+		{name: "failed sync", partial: -1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			ds, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+			require.NoError(t, err)
+			writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+			mdb := ds.(*memdbDatastore)
+			mdb.Lock()
+			wal := mdb.persist.wal
+			mdb.persist.wal = &failingWAL{walWriter: wal, partial: tc.partial}
+			mdb.Unlock()
+
+			_, err = ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+				return rwt.WriteRelationships(ctx, []tuple.RelationshipUpdate{
+					tuple.Touch(tuple.MustParse("document:doc2#reader@user:bob")),
+				})
+			})
+			require.Error(t, err)
+
+			mdb.Lock()
+			mdb.persist.wal = wal
+			mdb.Unlock()
+			writeTestData(t, ds, "document:doc3#reader@user:carol")
+
+			// Recover from the log alone: the failed commit must not come back, and the commit
+			// after it must not be lost behind a torn record.
+			mdb.Lock()
+			require.NoError(t, mdb.persist.wal.Close())
+			mdb.persist = nil
+			mdb.Unlock()
+
+			reopened, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = reopened.Close() })
+
+			require.ElementsMatch(t, []string{
+				"document:doc1#reader@user:alice",
+				"document:doc3#reader@user:carol",
+			}, readTestRelationships(t, reopened))
+		})
+	}
+}
+
+func TestPersistentMemdbCompactsLog(t *testing.T) {
+	dir := t.TempDir()
+
+	ds, err := NewPersistentMemdbDatastore(dir, 0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ds.Close() })
+
+	mdb := ds.(*memdbDatastore)
+	mdb.Lock()
+	mdb.persist.snapshotThreshold = 2
+	mdb.Unlock()
+
+	writeTestData(t, ds, "document:doc1#reader@user:alice")
+	writeTestData(t, ds, "document:doc2#reader@user:bob")
+
+	_, err = os.Stat(filepath.Join(dir, snapshotFileName))
+	require.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	require.NoError(t, err)
+	require.Zero(t, info.Size())
+}
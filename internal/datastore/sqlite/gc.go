@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	"github.com/authzed/spicedb/pkg/datastore"
+)
+
+// BuildGarbageCollector returns a garbage collector which removes tombstoned rows and transactions
+// that have fallen out of the GC window, and deletes expired relationships.
+func (sds *sqliteDatastore) BuildGarbageCollector(_ context.Context) (common.GarbageCollector, error) {
+	return &sqliteGarbageCollector{sds: sds}, nil
+}
+
+func (sds *sqliteDatastore) HasGCRun() bool {
+	return sds.gcHasRun.Load()
+}
+
+func (sds *sqliteDatastore) MarkGCCompleted() {
+	sds.gcHasRun.Store(true)
+}
+
+func (sds *sqliteDatastore) ResetGCCompleted() {
+	sds.gcHasRun.Store(false)
+}
+
+// sqliteGarbageCollector implements common.GarbageCollector for a single SQLite datastore.
+type sqliteGarbageCollector struct {
+	sds *sqliteDatastore
+}
+
+func (gc *sqliteGarbageCollector) LockForGCRun(_ context.Context) (bool, error) {
+	return gc.sds.gcRunLock.TryLock(), nil
+}
+
+func (gc *sqliteGarbageCollector) UnlockAfterGCRun() error {
+	gc.sds.gcRunLock.Unlock()
+	return nil
+}
+
+func (gc *sqliteGarbageCollector) Now(_ context.Context) (time.Time, error) {
+	return time.Now().UTC(), nil
+}
+
+// TxIDBefore returns the most recent transaction committed before the given time, or a zero
+// revision if there is none.
+func (gc *sqliteGarbageCollector) TxIDBefore(ctx context.Context, before time.Time) (datastore.Revision, error) {
+	var txID sql.NullInt64
+	if err := gc.sds.db.QueryRowContext(ctx,
+		"SELECT MAX("+colID+") FROM "+tableTransaction+" WHERE "+colTimestamp+" < ?",
+		formatTime(before),
+	).Scan(&txID); err != nil {
+		return datastore.NoRevision, fmt.Errorf("unable to find transaction before %s: %w", before, err)
+	}
+
+	return revisions.NewForTransactionID(uint64(txID.Int64)), nil
+}
+
+// DeleteBeforeTx deletes rows which were deleted before txID, along with the transactions older
+// than it. The transaction txID itself is kept so that it remains a valid revision.
+func (gc *sqliteGarbageCollector) DeleteBeforeTx(ctx context.Context, txID datastore.Revision) (common.DeletionCounts, error) {
+	watermark, err := transactionID(txID)
+	if err != nil {
+		return common.DeletionCounts{}, err
+	}
+
+	var counts common.DeletionCounts
+	err = gc.sds.withGCWriteTxn(ctx, func(tx *sql.Tx) error {
+		deleted, err := execCount(ctx, tx,
+			"DELETE FROM "+tableRelationship+" WHERE "+colDeletedTxn+" < ?", watermark)
+		if err != nil {
+			return fmt.Errorf("error deleting relationships: %w", err)
+		}
+		counts.Relationships = deleted
+
+		deleted, err = execCount(ctx, tx,
+			"DELETE FROM "+tableSchema+" WHERE "+colDeletedTxn+" < ?", watermark)
+		if err != nil {
+			return fmt.Errorf("error deleting schema definitions: %w", err)
+		}
+		counts.Namespaces = deleted
+
+		if _, err := execCount(ctx, tx,
+			"DELETE FROM "+tableCounters+" WHERE "+colDeletedTxn+" < ?", watermark); err != nil {
+			return fmt.Errorf("error deleting relationship counters: %w", err)
+		}
+
+		deleted, err = execCount(ctx, tx,
+			"DELETE FROM "+tableTransaction+" WHERE "+colID+" < ?", watermark)
+		if err != nil {
+			return fmt.Errorf("error deleting transactions: %w", err)
+		}
+		counts.Transactions = deleted
+
+		return nil
+	})
+	return counts, err
+}
+
+// DeleteExpiredRels deletes relationships whose expiration is older than the GC window.
+func (gc *sqliteGarbageCollector) DeleteExpiredRels(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-gc.sds.gcWindow)
+
+	var deleted int64
+	err := gc.sds.withGCWriteTxn(ctx, func(tx *sql.Tx) error {
+		var err error
+		deleted, err = execCount(ctx, tx,
+			"DELETE FROM "+tableRelationship+" WHERE "+colExpiration+" < ?", formatTime(cutoff))
+		return err
+	})
+	return deleted, err
+}
+
+func (gc *sqliteGarbageCollector) Close() {}
+
+// withGCWriteTxn runs f in a write transaction, serialized with user transactions.
+func (sds *sqliteDatastore) withGCWriteTxn(ctx context.Context, f func(tx *sql.Tx) error) error {
+	sds.writeLock.Lock()
+	defer sds.writeLock.Unlock()
+
+	tx, err := sds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func execCount(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+var _ common.GarbageCollectableDatastore = &sqliteDatastore{}
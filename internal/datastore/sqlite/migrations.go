@@ -0,0 +1,189 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// migration is a single, named step in the evolution of the SQLite schema. Migrations are applied
+// in order, each in its own transaction, and the name of the last applied migration is recorded in
+// the migration version table.
+type migration struct {
+	name       string
+	statements []string
+	apply      func(ctx context.Context, tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{
+		name: "add-initial-schema",
+		statements: []string{
+			`CREATE TABLE ` + tableTransaction + ` (
+				` + colID + ` INTEGER PRIMARY KEY AUTOINCREMENT,
+				` + colTimestamp + ` TEXT NOT NULL,
+				` + colMetadata + ` BLOB
+			)`,
+			`CREATE INDEX ix_transaction_by_timestamp ON ` + tableTransaction + ` (` + colTimestamp + `)`,
+
+			`CREATE TABLE ` + tableRelationship + ` (
+				` + colNamespace + ` TEXT NOT NULL,
+				` + colObjectID + ` TEXT NOT NULL,
+				` + colRelation + ` TEXT NOT NULL,
+				` + colUsersetNamespace + ` TEXT NOT NULL,
+				` + colUsersetObjectID + ` TEXT NOT NULL,
+				` + colUsersetRelation + ` TEXT NOT NULL,
+				` + colCaveatName + ` TEXT,
+				` + colCaveatContext + ` BLOB,
+				` + colExpiration + ` DATETIME,
+				` + colCreatedTxn + ` INTEGER NOT NULL,
+				` + colDeletedTxn + ` INTEGER NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX uq_relation_tuple_living ON ` + tableRelationship + ` (
+				` + colNamespace + `, ` + colObjectID + `, ` + colRelation + `,
+				` + colUsersetNamespace + `, ` + colUsersetObjectID + `, ` + colUsersetRelation + `,
+				` + colDeletedTxn + `
+			)`,
+			`CREATE INDEX ix_relation_tuple_by_subject ON ` + tableRelationship + ` (
+				` + colUsersetNamespace + `, ` + colUsersetObjectID + `, ` + colUsersetRelation + `,
+				` + colNamespace + `, ` + colRelation + `
+			)`,
+			`CREATE INDEX ix_relation_tuple_by_created ON ` + tableRelationship + ` (` + colCreatedTxn + `)`,
+			`CREATE INDEX ix_relation_tuple_by_deleted ON ` + tableRelationship + ` (` + colDeletedTxn + `)`,
+			`CREATE INDEX ix_relation_tuple_by_expiration ON ` + tableRelationship + ` (` + colExpiration + `)`,
+
+			`CREATE TABLE ` + tableSchema + ` (
+				` + colName + ` TEXT NOT NULL,
+				` + colChunkIndex + ` INTEGER NOT NULL,
+				` + colChunkData + ` BLOB NOT NULL,
+				` + colCreatedTxn + ` INTEGER NOT NULL,
+				` + colDeletedTxn + ` INTEGER NOT NULL
+			)`,
+			`CREATE INDEX ix_schema_chunk_by_name ON ` + tableSchema + ` (` + colName + `, ` + colDeletedTxn + `)`,
+			`CREATE INDEX ix_schema_chunk_by_created ON ` + tableSchema + ` (` + colCreatedTxn + `)`,
+			`CREATE INDEX ix_schema_chunk_by_deleted ON ` + tableSchema + ` (` + colDeletedTxn + `)`,
+
+			`CREATE TABLE ` + tableCounters + ` (
+				` + colName + ` TEXT NOT NULL,
+				` + colFilter + ` BLOB NOT NULL,
+				` + colCount + ` INTEGER NOT NULL DEFAULT 0,
+				` + colComputedAt + ` INTEGER NOT NULL DEFAULT 0,
+				` + colCreatedTxn + ` INTEGER NOT NULL,
+				` + colDeletedTxn + ` INTEGER NOT NULL
+			)`,
+			`CREATE UNIQUE INDEX uq_relationship_counter_living ON ` + tableCounters + ` (` + colName + `, ` + colDeletedTxn + `)`,
+
+			`CREATE TABLE ` + tableMetadata + ` (
+				` + colUniqueID + ` TEXT NOT NULL
+			)`,
+		},
+		apply: func(ctx context.Context, tx *sql.Tx) error {
+			// Seed the first transaction so that the datastore always has a head revision.
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO "+tableTransaction+" ("+colTimestamp+") VALUES ("+nowFunction+"())",
+			); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx,
+				"INSERT INTO "+tableMetadata+" ("+colUniqueID+") VALUES (?)",
+				uuid.NewString(),
+			)
+			return err
+		},
+	},
+}
+
+// headMigration is the name of the latest migration, which the datastore must be at to be ready.
+var headMigration = migrations[len(migrations)-1].name
+
+// migrate brings the database up to the head migration and returns the unique ID of the datastore.
+func migrate(ctx context.Context, db *sql.DB) (string, error) {
+	if _, err := db.ExecContext(ctx,
+		"CREATE TABLE IF NOT EXISTS "+tableMigrationVersion+" ("+colVersion+" TEXT NOT NULL)",
+	); err != nil {
+		return "", err
+	}
+
+	current, err := currentMigration(ctx, db)
+	if err != nil {
+		return "", err
+	}
+
+	pending := migrations
+	if current != "" {
+		found := false
+		for index, m := range migrations {
+			if m.name == current {
+				pending = migrations[index+1:]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("unknown migration %q; the database was created by a newer version", current)
+		}
+	}
+
+	for _, m := range pending {
+		if err := runMigration(ctx, db, m); err != nil {
+			return "", fmt.Errorf("migration %q failed: %w", m.name, err)
+		}
+	}
+
+	var uniqueID string
+	if err := db.QueryRowContext(ctx, "SELECT "+colUniqueID+" FROM "+tableMetadata).Scan(&uniqueID); err != nil {
+		return "", fmt.Errorf("unable to read datastore unique ID: %w", err)
+	}
+	return uniqueID, nil
+}
+
+func runMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, statement := range m.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if m.apply != nil {
+		if err := m.apply(ctx, tx); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM "+tableMigrationVersion); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO "+tableMigrationVersion+" ("+colVersion+") VALUES (?)", m.name,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// currentMigration returns the name of the last applied migration, or an empty string if the
+// database has not been migrated.
+func currentMigration(ctx context.Context, db *sql.DB) (string, error) {
+	var version string
+	err := db.QueryRowContext(ctx, "SELECT "+colVersion+" FROM "+tableMigrationVersion).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to read migration version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,620 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	"github.com/authzed/spicedb/pkg/datastore"
+	"github.com/authzed/spicedb/pkg/datastore/options"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+)
+
+const (
+	errUnableToReadConfig   = "unable to read namespace config: %w"
+	errUnableToListConfigs  = "unable to list namespaces: %w"
+	errUnableToReadCaveat   = "unable to read caveat: %w"
+	errUnableToListCaveats  = "unable to list caveats: %w"
+	errUnableToReadCounters = "unable to read relationship counters: %w"
+)
+
+// queryable is the subset of *sql.DB and *sql.Tx used to run queries.
+type queryable interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// queryFilterer restricts a query to the rows visible to a reader.
+type queryFilterer func(original sq.SelectBuilder) sq.SelectBuilder
+
+type sqliteReader struct {
+	db       queryable
+	filterer queryFilterer
+	executor common.QueryRelationshipsExecutor
+	chunker  *common.SQLByteChunker[int64]
+	initErr  error
+}
+
+// newSQLiteReader creates a reader over db, seeing only the rows allowed by filterer. tx is the
+// enclosing write transaction, if any, and is required to write schema chunks.
+func newSQLiteReader(db queryable, tx *sql.Tx, filterer queryFilterer) sqliteReader {
+	return sqliteReader{
+		db:       db,
+		filterer: filterer,
+		executor: common.QueryRelationshipsExecutor{
+			Executor: func(ctx context.Context, builder common.RelationshipsQueryBuilder) (datastore.RelationshipIterator, error) {
+				return common.QueryRelationships[*sql.Rows, caveatContextWrapper](ctx, builder, querier{db}, explainable{})
+			},
+		},
+		chunker: common.MustNewSQLByteChunker(common.SQLByteChunkerConfig[int64]{
+			TableName:         tableSchema,
+			NameColumn:        colName,
+			ChunkIndexColumn:  colChunkIndex,
+			ChunkDataColumn:   colChunkData,
+			MaxChunkSize:      schemaChunkSize,
+			PlaceholderFormat: sq.Question,
+			Executor:          chunkExecutor{db: db, tx: tx, filterer: filterer},
+			WriteMode:         common.WriteModeInsertWithTombstones,
+			CreatedAtColumn:   colCreatedTxn,
+			DeletedAtColumn:   colDeletedTxn,
+			AliveValue:        liveDeletedTxnID,
+		}),
+	}
+}
+
+func (r *sqliteReader) CountRelationships(ctx context.Context, name string) (int, error) {
+	counters, err := r.LookupCounters(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var found *core.RelationshipFilter
+	for _, counter := range counters {
+		if counter.Name == name {
+			found = counter.Filter
+			break
+		}
+	}
+
+	if found == nil {
+		return 0, datastore.NewCounterNotRegisteredErr(name)
+	}
+
+	coreFilter, err := datastore.RelationshipsFilterFromCoreFilter(found)
+	if err != nil {
+		return 0, err
+	}
+
+	iter, err := r.QueryRelationships(ctx, coreFilter)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, err := range iter {
+		if err != nil {
+			return 0, err
+		}
+
+		count++
+	}
+	return count, nil
+}
+
+func (r *sqliteReader) LookupCounters(ctx context.Context) ([]datastore.RelationshipCounter, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	query, args, err := r.filterer(
+		sq.Select(colName, colFilter, colCount, colComputedAt).
+			From(tableCounters).
+			OrderBy(colName),
+	).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf(errUnableToReadCounters, err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf(errUnableToReadCounters, err)
+	}
+	defer rows.Close()
+
+	var counters []datastore.RelationshipCounter
+	for rows.Next() {
+		var name string
+		var filterBytes []byte
+		var count int
+		var computedAt int64
+		if err := rows.Scan(&name, &filterBytes, &count, &computedAt); err != nil {
+			return nil, fmt.Errorf(errUnableToReadCounters, err)
+		}
+
+		loaded := &core.RelationshipFilter{}
+		if err := loaded.UnmarshalVT(filterBytes); err != nil {
+			return nil, fmt.Errorf(errUnableToReadCounters, err)
+		}
+
+		var computedAtRevision datastore.Revision = datastore.NoRevision
+		if computedAt > 0 {
+			computedAtRevision = revisions.NewForTransactionID(uint64(computedAt))
+		}
+
+		counters = append(counters, datastore.RelationshipCounter{
+			Name:               name,
+			Filter:             loaded,
+			Count:              count,
+			ComputedAtRevision: computedAtRevision,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf(errUnableToReadCounters, err)
+	}
+
+	return counters, nil
+}
+
+// QueryRelationships reads relationships starting from the resource side.
+func (r *sqliteReader) QueryRelationships(
+	ctx context.Context,
+	filter datastore.RelationshipsFilter,
+	opts ...options.QueryOptionsOption,
+) (datastore.RelationshipIterator, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	qBuilder, err := r.relationshipsQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.executor.ExecuteQuery(ctx, qBuilder, opts...)
+}
+
+// relationshipsQuery builds a query for the visible relationships matching filter.
+func (r *sqliteReader) relationshipsQuery(filter datastore.RelationshipsFilter) (common.SchemaQueryFilterer, error) {
+	// The common LIKE clause for resource ID prefixes relies on backslash escapes, which SQLite
+	// does not apply by default, so compare the prefix directly instead.
+	prefix := filter.OptionalResourceIDPrefix
+	filter.OptionalResourceIDPrefix = ""
+
+	qBuilder, err := common.NewSchemaQueryFiltererForRelationshipsSelect(schema, maxIDsPerFilter).
+		WithAdditionalFilter(r.filterer).
+		FilterWithRelationshipsFilter(filter)
+	if err != nil {
+		return qBuilder, err
+	}
+
+	if prefix != "" {
+		qBuilder = qBuilder.WithAdditionalFilter(func(original sq.SelectBuilder) sq.SelectBuilder {
+			return original.Where(
+				"substr("+colObjectID+", 1, ?) = ?",
+				utf8.RuneCountInString(prefix), prefix,
+			)
+		})
+	}
+
+	return qBuilder, nil
+}
+
+// ReverseQueryRelationships reads relationships starting from the subject.
+func (r *sqliteReader) ReverseQueryRelationships(
+	ctx context.Context,
+	subjectsFilter datastore.SubjectsFilter,
+	opts ...options.ReverseQueryOptionsOption,
+) (datastore.RelationshipIterator, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	qBuilder, err := common.NewSchemaQueryFiltererForRelationshipsSelect(schema, maxIDsPerFilter).
+		WithAdditionalFilter(r.filterer).
+		FilterWithSubjectsSelectors(subjectsFilter.AsSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	queryOpts := options.NewReverseQueryOptionsWithOptions(opts...)
+
+	if queryOpts.ResRelation != nil {
+		qBuilder = qBuilder.
+			FilterToResourceType(queryOpts.ResRelation.Namespace).
+			FilterToRelation(queryOpts.ResRelation.Relation)
+	}
+
+	return r.executor.ExecuteQuery(ctx,
+		qBuilder,
+		options.WithLimit(queryOpts.LimitForReverse),
+		options.WithAfter(queryOpts.AfterForReverse),
+		options.WithSort(queryOpts.SortForReverse),
+		options.WithSkipCaveats(queryOpts.SkipCaveatsForReverse),
+		options.WithSkipExpiration(queryOpts.SkipExpirationForReverse),
+	)
+}
+
+func (r *sqliteReader) ReadNamespaceByName(ctx context.Context, nsName string) (*core.NamespaceDefinition, datastore.Revision, error) {
+	if r.initErr != nil {
+		return nil, datastore.NoRevision, r.initErr
+	}
+
+	serialized, lastWritten, err := r.readDefinition(ctx, namespacePrefix+nsName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, datastore.NoRevision, datastore.NewNamespaceNotFoundErr(nsName)
+	}
+	if err != nil {
+		return nil, datastore.NoRevision, fmt.Errorf(errUnableToReadConfig, err)
+	}
+
+	loaded := &core.NamespaceDefinition{}
+	if err := loaded.UnmarshalVT(serialized); err != nil {
+		return nil, datastore.NoRevision, fmt.Errorf(errUnableToReadConfig, err)
+	}
+
+	return loaded, lastWritten, nil
+}
+
+func (r *sqliteReader) ListAllNamespaces(ctx context.Context) ([]datastore.RevisionedNamespace, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	definitions, err := r.listDefinitions(ctx, sq.Like{colName: namespacePrefix + "%"})
+	if err != nil {
+		return nil, fmt.Errorf(errUnableToListConfigs, err)
+	}
+
+	return toRevisionedNamespaces(definitions)
+}
+
+func (r *sqliteReader) LookupNamespacesWithNames(ctx context.Context, nsNames []string) ([]datastore.RevisionedNamespace, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	if len(nsNames) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(nsNames))
+	for _, nsName := range nsNames {
+		names = append(names, namespacePrefix+nsName)
+	}
+
+	definitions, err := r.listDefinitions(ctx, sq.Eq{colName: names})
+	if err != nil {
+		return nil, fmt.Errorf(errUnableToListConfigs, err)
+	}
+
+	return toRevisionedNamespaces(definitions)
+}
+
+func (r *sqliteReader) ReadCaveatByName(ctx context.Context, name string) (*core.CaveatDefinition, datastore.Revision, error) {
+	if r.initErr != nil {
+		return nil, datastore.NoRevision, r.initErr
+	}
+
+	serialized, lastWritten, err := r.readDefinition(ctx, caveatPrefix+name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, datastore.NoRevision, datastore.NewCaveatNameNotFoundErr(name)
+	}
+	if err != nil {
+		return nil, datastore.NoRevision, fmt.Errorf(errUnableToReadCaveat, err)
+	}
+
+	loaded := &core.CaveatDefinition{}
+	if err := loaded.UnmarshalVT(serialized); err != nil {
+		return nil, datastore.NoRevision, fmt.Errorf(errUnableToReadCaveat, err)
+	}
+
+	return loaded, lastWritten, nil
+}
+
+func (r *sqliteReader) ListAllCaveats(ctx context.Context) ([]datastore.RevisionedCaveat, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	definitions, err := r.listDefinitions(ctx, sq.Like{colName: caveatPrefix + "%"})
+	if err != nil {
+		return nil, fmt.Errorf(errUnableToListCaveats, err)
+	}
+
+	return toRevisionedCaveats(definitions)
+}
+
+func (r *sqliteReader) LookupCaveatsWithNames(ctx context.Context, caveatNames []string) ([]datastore.RevisionedCaveat, error) {
+	if r.initErr != nil {
+		return nil, r.initErr
+	}
+
+	if len(caveatNames) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(caveatNames))
+	for _, caveatName := range caveatNames {
+		names = append(names, caveatPrefix+caveatName)
+	}
+
+	definitions, err := r.listDefinitions(ctx, sq.Eq{colName: names})
+	if err != nil {
+		return nil, fmt.Errorf(errUnableToListCaveats, err)
+	}
+
+	return toRevisionedCaveats(definitions)
+}
+
+// readDefinition reads the serialized schema definition stored under name, along with the
+// revision at which it was last written. It returns sql.ErrNoRows if no such definition is visible.
+func (r *sqliteReader) readDefinition(ctx context.Context, name string) ([]byte, datastore.Revision, error) {
+	query, args, err := r.filterer(
+		sq.Select(colCreatedTxn).
+			From(tableSchema).
+			Where(sq.Eq{colName: name}).
+			Limit(1),
+	).ToSql()
+	if err != nil {
+		return nil, datastore.NoRevision, err
+	}
+
+	var createdTxn int64
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&createdTxn); err != nil {
+		return nil, datastore.NoRevision, err
+	}
+
+	serialized, err := r.chunker.ReadChunkedBytes(ctx, name)
+	if err != nil {
+		return nil, datastore.NoRevision, err
+	}
+
+	return serialized, revisions.NewForTransactionID(uint64(createdTxn)), nil
+}
+
+type storedDefinition struct {
+	name        string
+	serialized  []byte
+	lastWritten datastore.Revision
+}
+
+// listDefinitions reads all visible schema definitions whose name matches the where clause,
+// reassembling their chunks in order.
+func (r *sqliteReader) listDefinitions(ctx context.Context, where sq.Sqlizer) ([]storedDefinition, error) {
+	query, args, err := r.filterer(
+		sq.Select(colName, colChunkIndex, colChunkData, colCreatedTxn).
+			From(tableSchema).
+			Where(where).
+			OrderBy(colName, colChunkIndex),
+	).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var definitions []storedDefinition
+	for rows.Next() {
+		var name string
+		var chunkIndex int
+		var chunk []byte
+		var createdTxn int64
+		if err := rows.Scan(&name, &chunkIndex, &chunk, &createdTxn); err != nil {
+			return nil, err
+		}
+
+		if chunkIndex == 0 {
+			definitions = append(definitions, storedDefinition{
+				name:        name,
+				lastWritten: revisions.NewForTransactionID(uint64(createdTxn)),
+			})
+		}
+
+		if len(definitions) == 0 || definitions[len(definitions)-1].name != name {
+			return nil, fmt.Errorf("missing first chunk of schema definition %q", name)
+		}
+
+		current := &definitions[len(definitions)-1]
+		current.serialized = append(current.serialized, chunk...)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return definitions, nil
+}
+
+func toRevisionedNamespaces(definitions []storedDefinition) ([]datastore.RevisionedNamespace, error) {
+	nsDefs := make([]datastore.RevisionedNamespace, 0, len(definitions))
+	for _, definition := range definitions {
+		loaded := &core.NamespaceDefinition{}
+		if err := loaded.UnmarshalVT(definition.serialized); err != nil {
+			return nil, fmt.Errorf(errUnableToReadConfig, err)
+		}
+
+		nsDefs = append(nsDefs, datastore.RevisionedNamespace{
+			Definition:          loaded,
+			LastWrittenRevision: definition.lastWritten,
+		})
+	}
+	return nsDefs, nil
+}
+
+func toRevisionedCaveats(definitions []storedDefinition) ([]datastore.RevisionedCaveat, error) {
+	caveats := make([]datastore.RevisionedCaveat, 0, len(definitions))
+	for _, definition := range definitions {
+		loaded := &core.CaveatDefinition{}
+		if err := loaded.UnmarshalVT(definition.serialized); err != nil {
+			return nil, fmt.Errorf(errUnableToReadCaveat, err)
+		}
+
+		caveats = append(caveats, datastore.RevisionedCaveat{
+			Definition:          loaded,
+			LastWrittenRevision: definition.lastWritten,
+		})
+	}
+	return caveats, nil
+}
+
+// querier adapts a queryable to the common.Querier interface used by the shared relationship
+// query code.
+type querier struct {
+	db queryable
+}
+
+func (q querier) QueryFunc(ctx context.Context, f func(context.Context, *sql.Rows) error, query string, args ...any) error {
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return f(ctx, rows)
+}
+
+// chunkExecutor runs the queries of the schema chunker. Reads are restricted to the rows visible
+// to the reader; writes require an enclosing write transaction.
+type chunkExecutor struct {
+	db       queryable
+	tx       *sql.Tx
+	filterer queryFilterer
+}
+
+func (ce chunkExecutor) BeginTransaction(_ context.Context) (common.ChunkedBytesTransaction, error) {
+	if ce.tx == nil {
+		return nil, errors.New("cannot write schema outside of a read-write transaction")
+	}
+	return chunkTransaction{ce.tx}, nil
+}
+
+func (ce chunkExecutor) ExecuteRead(ctx context.Context, builder sq.SelectBuilder) (map[int][]byte, error) {
+	query, args, err := ce.filterer(builder).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := ce.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := make(map[int][]byte)
+	for rows.Next() {
+		var chunkIndex int
+		var chunk []byte
+		if err := rows.Scan(&chunkIndex, &chunk); err != nil {
+			return nil, err
+		}
+		chunks[chunkIndex] = chunk
+	}
+	return chunks, rows.Err()
+}
+
+type chunkTransaction struct {
+	tx *sql.Tx
+}
+
+func (ct chunkTransaction) ExecuteWrite(ctx context.Context, builder sq.InsertBuilder) error {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = ct.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (ct chunkTransaction) ExecuteDelete(ctx context.Context, builder sq.DeleteBuilder) error {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = ct.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (ct chunkTransaction) ExecuteUpdate(ctx context.Context, builder sq.UpdateBuilder) error {
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = ct.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// caveatContextWrapper stores a caveat context as JSON.
+type caveatContextWrapper map[string]any
+
+func (cc *caveatContextWrapper) Scan(val any) error {
+	var serialized []byte
+	switch v := val.(type) {
+	case nil:
+		*cc = nil
+		return nil
+	case []byte:
+		serialized = v
+	case string:
+		serialized = []byte(v)
+	default:
+		return fmt.Errorf("unsupported caveat context type: %T", val)
+	}
+
+	if len(serialized) == 0 {
+		*cc = nil
+		return nil
+	}
+
+	*cc = nil
+	return json.Unmarshal(serialized, cc)
+}
+
+// explainable is required by the shared relationship query code. SQLite query plans are not
+// parsed, so only the explain statement itself is supported.
+type explainable struct{}
+
+func (explainable) PreExplainStatements() []string {
+	return nil
+}
+
+func (explainable) BuildExplainQuery(sql string, args []any) (string, []any, error) {
+	return "EXPLAIN QUERY PLAN " + sql, args, nil
+}
+
+func (explainable) ParseExplain(explain string) (datastore.ParsedExplain, error) {
+	var indexes []string
+	for _, line := range strings.Split(explain, "\n") {
+		if _, index, found := strings.Cut(line, " USING INDEX "); found {
+			name, _, _ := strings.Cut(index, " ")
+			indexes = append(indexes, name)
+		}
+	}
+
+	return datastore.ParsedExplain{IndexesUsed: indexes}, nil
+}
+
+func transactionID(rev datastore.Revision) (int64, error) {
+	txIDRev, ok := rev.(revisions.TransactionIDRevision)
+	if !ok {
+		return 0, fmt.Errorf("expected transaction ID revision, got %T", rev)
+	}
+	return int64(txIDRev.TransactionID()), nil
+}
+
+var (
+	_ datastore.Reader          = &sqliteReader{}
+	_ datastore.Explainable     = explainable{}
+	_ common.Querier[*sql.Rows] = querier{}
+)
@@ -0,0 +1,471 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/authzed/spicedb/pkg/datastore"
+	"github.com/authzed/spicedb/pkg/datastore/options"
+	"github.com/authzed/spicedb/pkg/genutil/mapz"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	"github.com/authzed/spicedb/pkg/spiceerrors"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+const (
+	errUnableToDeleteRelationships = "unable to delete relationships: %w"
+	errUnableToWriteConfig         = "unable to write namespace config: %w"
+	errUnableToDeleteConfig        = "unable to delete namespace config: %w"
+	errUnableToWriteCaveat         = "unable to write caveat: %w"
+	errUnableToDeleteCaveat        = "unable to delete caveat: %w"
+	errUnableToWriteCounter        = "unable to write relationship counter: %w"
+)
+
+type sqliteReadWriteTx struct {
+	sqliteReader
+	tx   *sql.Tx
+	txID int64
+}
+
+func (rwt *sqliteReadWriteTx) WriteRelationships(ctx context.Context, mutations []tuple.RelationshipUpdate) error {
+	return rwt.write(ctx, mutations...)
+}
+
+func (rwt *sqliteReadWriteTx) write(ctx context.Context, mutations ...tuple.RelationshipUpdate) error {
+	for _, mutation := range mutations {
+		existing, createdTxn, err := rwt.loadLiveRelationship(ctx, mutation.Relationship.RelationshipReference)
+		if err != nil {
+			return fmt.Errorf("error loading existing relationship: %w", err)
+		}
+
+		switch mutation.Operation {
+		case tuple.UpdateOperationCreate:
+			if existing != nil {
+				return common.NewCreateRelationshipExistsError(existing)
+			}
+			if err := rwt.insertRelationship(ctx, mutation.Relationship); err != nil {
+				return fmt.Errorf("error inserting relationship: %w", err)
+			}
+
+		case tuple.UpdateOperationTouch:
+			if existing != nil {
+				if tuple.MustString(*existing) == tuple.MustString(mutation.Relationship) {
+					continue
+				}
+				if err := rwt.tombstoneRelationship(ctx, *existing, createdTxn); err != nil {
+					return fmt.Errorf("error deleting relationship: %w", err)
+				}
+			}
+
+			if err := rwt.insertRelationship(ctx, mutation.Relationship); err != nil {
+				return fmt.Errorf("error inserting relationship: %w", err)
+			}
+
+		case tuple.UpdateOperationDelete:
+			if existing != nil {
+				if err := rwt.tombstoneRelationship(ctx, *existing, createdTxn); err != nil {
+					return fmt.Errorf("error deleting relationship: %w", err)
+				}
+			}
+
+		default:
+			return spiceerrors.MustBugf("unknown tuple mutation operation type: %v", mutation.Operation)
+		}
+	}
+
+	return nil
+}
+
+func relationshipKey(ref tuple.RelationshipReference) sq.Eq {
+	return sq.Eq{
+		colNamespace:        ref.Resource.ObjectType,
+		colObjectID:         ref.Resource.ObjectID,
+		colRelation:         ref.Resource.Relation,
+		colUsersetNamespace: ref.Subject.ObjectType,
+		colUsersetObjectID:  ref.Subject.ObjectID,
+		colUsersetRelation:  ref.Subject.Relation,
+	}
+}
+
+// loadLiveRelationship returns the live relationship with the given reference, including if it has
+// expired, along with the transaction that created it. It returns nil if there is no such
+// relationship.
+func (rwt *sqliteReadWriteTx) loadLiveRelationship(ctx context.Context, ref tuple.RelationshipReference) (*tuple.Relationship, int64, error) {
+	query, args, err := sq.Select(colCaveatName, colCaveatContext, colExpiration, colCreatedTxn).
+		From(tableRelationship).
+		Where(relationshipKey(ref)).
+		Where(sq.Eq{colDeletedTxn: liveDeletedTxnID}).
+		ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var caveatName sql.NullString
+	var caveatCtx caveatContextWrapper
+	var expiration *time.Time
+	var createdTxn int64
+	err = rwt.tx.QueryRowContext(ctx, query, args...).Scan(&caveatName, &caveatCtx, &expiration, &createdTxn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	caveat, err := common.ContextualizedCaveatFrom(caveatName.String, caveatCtx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if expiration != nil {
+		t := expiration.UTC()
+		expiration = &t
+	}
+
+	return &tuple.Relationship{
+		RelationshipReference: ref,
+		OptionalCaveat:        caveat,
+		OptionalExpiration:    expiration,
+	}, createdTxn, nil
+}
+
+func (rwt *sqliteReadWriteTx) insertRelationship(ctx context.Context, rel tuple.Relationship) error {
+	var caveatName, caveatContext any
+	if rel.OptionalCaveat != nil && rel.OptionalCaveat.CaveatName != "" {
+		caveatName = rel.OptionalCaveat.CaveatName
+
+		serialized, err := json.Marshal(rel.OptionalCaveat.Context.AsMap())
+		if err != nil {
+			return fmt.Errorf("unable to serialize caveat context: %w", err)
+		}
+		caveatContext = serialized
+	}
+
+	var expiration any
+	if rel.OptionalExpiration != nil {
+		expiration = formatTime(*rel.OptionalExpiration)
+	}
+
+	query, args, err := sq.Insert(tableRelationship).
+		Columns(
+			colNamespace, colObjectID, colRelation,
+			colUsersetNamespace, colUsersetObjectID, colUsersetRelation,
+			colCaveatName, colCaveatContext, colExpiration,
+			colCreatedTxn, colDeletedTxn,
+		).
+		Values(
+			rel.Resource.ObjectType, rel.Resource.ObjectID, rel.Resource.Relation,
+			rel.Subject.ObjectType, rel.Subject.ObjectID, rel.Subject.Relation,
+			caveatName, caveatContext, expiration,
+			rwt.txID, liveDeletedTxnID,
+		).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = rwt.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// tombstoneRelationship marks the live relationship as deleted by this transaction. A relationship
+// which was created by this same transaction was never visible to readers, so it is removed.
+func (rwt *sqliteReadWriteTx) tombstoneRelationship(ctx context.Context, rel tuple.Relationship, createdTxn int64) error {
+	var builder sq.Sqlizer
+	if createdTxn == rwt.txID {
+		builder = sq.Delete(tableRelationship).
+			Where(relationshipKey(rel.RelationshipReference)).
+			Where(sq.Eq{colCreatedTxn: rwt.txID})
+	} else {
+		builder = sq.Update(tableRelationship).
+			Set(colDeletedTxn, rwt.txID).
+			Where(relationshipKey(rel.RelationshipReference)).
+			Where(sq.Eq{colDeletedTxn: liveDeletedTxnID})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = rwt.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (rwt *sqliteReadWriteTx) DeleteRelationships(ctx context.Context, filter *v1.RelationshipFilter, opts ...options.DeleteOptionsOption) (uint64, bool, error) {
+	delOpts := options.NewDeleteOptionsWithOptionsAndDefaults(opts...)
+	var delLimit uint64
+	if delOpts.DeleteLimit != nil && *delOpts.DeleteLimit > 0 {
+		delLimit = *delOpts.DeleteLimit
+	}
+
+	count, metLimit, err := rwt.deleteMatching(ctx, filter, delLimit)
+	if err != nil {
+		return 0, false, fmt.Errorf(errUnableToDeleteRelationships, err)
+	}
+	return count, metLimit, nil
+}
+
+// deleteMatching deletes up to limit live relationships matching the filter, or all of them if
+// limit is zero.
+func (rwt *sqliteReadWriteTx) deleteMatching(ctx context.Context, filter *v1.RelationshipFilter, limit uint64) (uint64, bool, error) {
+	dsFilter, err := datastore.RelationshipsFilterFromPublicFilter(filter)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var queryOpts []options.QueryOptionsOption
+	if limit > 0 {
+		queryOpts = append(queryOpts, options.WithLimit(&limit))
+	}
+
+	iter, err := rwt.QueryRelationships(ctx, dsFilter, queryOpts...)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// Collect the relationships before deleting, as the query holds the transaction's connection.
+	var mutations []tuple.RelationshipUpdate
+	for rel, err := range iter {
+		if err != nil {
+			return 0, false, err
+		}
+		mutations = append(mutations, tuple.Delete(rel))
+	}
+
+	counter := uint64(len(mutations))
+	return counter, limit > 0 && counter == limit, rwt.write(ctx, mutations...)
+}
+
+func (rwt *sqliteReadWriteTx) RegisterCounter(ctx context.Context, name string, filter *core.RelationshipFilter) error {
+	exists, _, err := rwt.liveCounter(ctx, name)
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	if exists {
+		return datastore.NewCounterAlreadyRegisteredErr(name, filter)
+	}
+
+	filterBytes, err := filter.MarshalVT()
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	query, args, err := sq.Insert(tableCounters).
+		Columns(colName, colFilter, colCreatedTxn, colDeletedTxn).
+		Values(name, filterBytes, rwt.txID, liveDeletedTxnID).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	if _, err := rwt.tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+	return nil
+}
+
+func (rwt *sqliteReadWriteTx) UnregisterCounter(ctx context.Context, name string) error {
+	exists, createdTxn, err := rwt.liveCounter(ctx, name)
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	if !exists {
+		return datastore.NewCounterNotRegisteredErr(name)
+	}
+
+	var builder sq.Sqlizer
+	if createdTxn == rwt.txID {
+		builder = sq.Delete(tableCounters).
+			Where(sq.Eq{colName: name, colCreatedTxn: rwt.txID})
+	} else {
+		builder = sq.Update(tableCounters).
+			Set(colDeletedTxn, rwt.txID).
+			Where(sq.Eq{colName: name, colDeletedTxn: liveDeletedTxnID})
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	if _, err := rwt.tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+	return nil
+}
+
+func (rwt *sqliteReadWriteTx) StoreCounterValue(ctx context.Context, name string, value int, computedAtRevision datastore.Revision) error {
+	exists, _, err := rwt.liveCounter(ctx, name)
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	if !exists {
+		return datastore.NewCounterNotRegisteredErr(name)
+	}
+
+	computedAt, err := transactionID(computedAtRevision)
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	query, args, err := sq.Update(tableCounters).
+		Set(colCount, value).
+		Set(colComputedAt, computedAt).
+		Where(sq.Eq{colName: name, colDeletedTxn: liveDeletedTxnID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+
+	if _, err := rwt.tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf(errUnableToWriteCounter, err)
+	}
+	return nil
+}
+
+// liveCounter returns whether a live counter with the given name exists, and the transaction that
+// created it.
+func (rwt *sqliteReadWriteTx) liveCounter(ctx context.Context, name string) (bool, int64, error) {
+	var createdTxn int64
+	err := rwt.tx.QueryRowContext(ctx,
+		"SELECT "+colCreatedTxn+" FROM "+tableCounters+" WHERE "+colName+" = ? AND "+colDeletedTxn+" = ?",
+		name, liveDeletedTxnID,
+	).Scan(&createdTxn)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return true, createdTxn, nil
+}
+
+func (rwt *sqliteReadWriteTx) WriteNamespaces(ctx context.Context, newConfigs ...*core.NamespaceDefinition) error {
+	for _, newConfig := range newConfigs {
+		serialized, err := newConfig.MarshalVT()
+		if err != nil {
+			return fmt.Errorf(errUnableToWriteConfig, err)
+		}
+
+		if err := rwt.writeDefinition(ctx, namespacePrefix+newConfig.Name, serialized); err != nil {
+			return fmt.Errorf(errUnableToWriteConfig, err)
+		}
+	}
+
+	return nil
+}
+
+func (rwt *sqliteReadWriteTx) DeleteNamespaces(ctx context.Context, nsNames []string, delOption datastore.DeleteNamespacesRelationshipsOption) error {
+	for _, nsName := range nsNames {
+		if _, _, err := rwt.ReadNamespaceByName(ctx, nsName); err != nil {
+			return err
+		}
+
+		if err := rwt.deleteDefinition(ctx, namespacePrefix+nsName); err != nil {
+			return fmt.Errorf(errUnableToDeleteConfig, err)
+		}
+
+		if delOption == datastore.DeleteNamespacesAndRelationships {
+			if _, _, err := rwt.deleteMatching(ctx, &v1.RelationshipFilter{
+				ResourceType: nsName,
+			}, 0); err != nil {
+				return fmt.Errorf("unable to delete relationships from deleted namespace: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (rwt *sqliteReadWriteTx) WriteCaveats(ctx context.Context, caveats []*core.CaveatDefinition) error {
+	caveatNames := mapz.NewSet[string]()
+	for _, coreCaveat := range caveats {
+		if !caveatNames.Add(coreCaveat.Name) {
+			return fmt.Errorf("duplicate caveat %s", coreCaveat.Name)
+		}
+
+		serialized, err := coreCaveat.MarshalVT()
+		if err != nil {
+			return fmt.Errorf(errUnableToWriteCaveat, err)
+		}
+
+		if err := rwt.writeDefinition(ctx, caveatPrefix+coreCaveat.Name, serialized); err != nil {
+			return fmt.Errorf(errUnableToWriteCaveat, err)
+		}
+	}
+
+	return nil
+}
+
+func (rwt *sqliteReadWriteTx) DeleteCaveats(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if err := rwt.deleteDefinition(ctx, caveatPrefix+name); err != nil {
+			return fmt.Errorf(errUnableToDeleteCaveat, err)
+		}
+	}
+
+	return nil
+}
+
+// writeDefinition replaces the schema definition stored under name.
+func (rwt *sqliteReadWriteTx) writeDefinition(ctx context.Context, name string, serialized []byte) error {
+	// Definitions written earlier in this same transaction were never visible, so remove them
+	// rather than leaving tombstones behind.
+	if err := rwt.removeUncommittedDefinition(ctx, name); err != nil {
+		return err
+	}
+
+	return rwt.chunker.WriteChunkedBytes(ctx, name, serialized, rwt.txID)
+}
+
+// deleteDefinition deletes the schema definition stored under name.
+func (rwt *sqliteReadWriteTx) deleteDefinition(ctx context.Context, name string) error {
+	if err := rwt.removeUncommittedDefinition(ctx, name); err != nil {
+		return err
+	}
+
+	return rwt.chunker.DeleteChunkedBytes(ctx, name, rwt.txID)
+}
+
+func (rwt *sqliteReadWriteTx) removeUncommittedDefinition(ctx context.Context, name string) error {
+	_, err := rwt.tx.ExecContext(ctx,
+		"DELETE FROM "+tableSchema+" WHERE "+colName+" = ? AND "+colCreatedTxn+" = ?",
+		name, rwt.txID,
+	)
+	return err
+}
+
+func (rwt *sqliteReadWriteTx) BulkLoad(ctx context.Context, iter datastore.BulkWriteRelationshipSource) (uint64, error) {
+	var numCopied uint64
+	var next *tuple.Relationship
+	var err error
+
+	updates := []tuple.RelationshipUpdate{{
+		Operation: tuple.UpdateOperationCreate,
+	}}
+
+	for next, err = iter.Next(ctx); next != nil && err == nil; next, err = iter.Next(ctx) {
+		updates[0].Relationship = *next
+		if err := rwt.WriteRelationships(ctx, updates); err != nil {
+			return 0, err
+		}
+		numCopied++
+	}
+
+	return numCopied, err
+}
+
+var _ datastore.ReadWriteTransaction = &sqliteReadWriteTx{}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	"github.com/authzed/spicedb/pkg/datastore"
+)
+
+const errRevision = "unable to find revision: %w"
+
+var ParseRevisionString = revisions.RevisionParser(revisions.TransactionID)
+
+func (sds *sqliteDatastore) HeadRevision(ctx context.Context) (datastore.Revision, error) {
+	var head int64
+	if err := sds.db.QueryRowContext(ctx, "SELECT MAX("+colID+") FROM "+tableTransaction).Scan(&head); err != nil {
+		return datastore.NoRevision, fmt.Errorf(errRevision, err)
+	}
+
+	return revisions.NewForTransactionID(uint64(head)), nil
+}
+
+// OptimizedRevision returns the head revision: reads are served from a single local file, so there
+// is no benefit to quantizing revisions.
+func (sds *sqliteDatastore) OptimizedRevision(ctx context.Context) (datastore.Revision, error) {
+	return sds.HeadRevision(ctx)
+}
+
+func (sds *sqliteDatastore) CheckRevision(ctx context.Context, rev datastore.Revision) error {
+	txID, err := transactionID(rev)
+	if err != nil {
+		return datastore.NewInvalidRevisionErr(rev, datastore.CouldNotDetermineRevision)
+	}
+
+	var oldest, head int64
+	if err := sds.db.QueryRowContext(ctx,
+		"SELECT MIN("+colID+"), MAX("+colID+") FROM "+tableTransaction,
+	).Scan(&oldest, &head); err != nil {
+		return fmt.Errorf(errRevision, err)
+	}
+
+	// Transactions are deleted once they fall outside of the GC window, so a revision older than
+	// the oldest remaining transaction can no longer be read consistently.
+	if txID < oldest {
+		return datastore.NewInvalidRevisionErr(rev, datastore.RevisionStale)
+	}
+
+	if txID > head {
+		return datastore.NewInvalidRevisionErr(rev, datastore.CouldNotDetermineRevision)
+	}
+
+	return nil
+}
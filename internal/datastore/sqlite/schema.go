@@ -0,0 +1,82 @@
+package sqlite
+
+import (
+	"math"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+)
+
+const (
+	tableTransaction      = "relation_tuple_transaction"
+	tableRelationship     = "relation_tuple"
+	tableSchema           = "schema_chunk"
+	tableCounters         = "relationship_counter"
+	tableMetadata         = "metadata"
+	tableMigrationVersion = "migration_version"
+
+	colID        = "id"
+	colTimestamp = "timestamp"
+	colMetadata  = "metadata"
+
+	colNamespace        = "namespace"
+	colObjectID         = "object_id"
+	colRelation         = "relation"
+	colUsersetNamespace = "userset_namespace"
+	colUsersetObjectID  = "userset_object_id"
+	colUsersetRelation  = "userset_relation"
+	colCaveatName       = "caveat_name"
+	colCaveatContext    = "caveat_context"
+	colExpiration       = "expiration"
+
+	colName       = "name"
+	colChunkIndex = "chunk_index"
+	colChunkData  = "chunk_data"
+
+	colFilter     = "serialized_filter"
+	colCount      = "current_count"
+	colComputedAt = "computed_at_revision"
+
+	colCreatedTxn = "created_transaction"
+	colDeletedTxn = "deleted_transaction"
+
+	colUniqueID = "unique_id"
+	colVersion  = "version"
+
+	// liveDeletedTxnID is the deleted transaction ID of rows which have not been deleted.
+	liveDeletedTxnID = int64(math.MaxInt64)
+
+	// nowFunction is a SQL function, registered with the driver, that returns the current time
+	// formatted with timeLayout.
+	nowFunction = "spicedb_now"
+
+	// timeLayout is a fixed-width layout for timestamps which sorts lexically in time order when
+	// all values are in UTC.
+	timeLayout = "2006-01-02 15:04:05.000000000-07:00"
+
+	// schemaChunkSize is the maximum size of each chunk of a serialized schema definition.
+	schemaChunkSize = 64 * 1024
+
+	namespacePrefix = "namespace:"
+	caveatPrefix    = "caveat:"
+
+	maxIDsPerFilter = 100
+)
+
+var schema = *common.NewSchemaInformationWithOptions(
+	common.WithRelationshipTableName(tableRelationship),
+	common.WithColNamespace(colNamespace),
+	common.WithColObjectID(colObjectID),
+	common.WithColRelation(colRelation),
+	common.WithColUsersetNamespace(colUsersetNamespace),
+	common.WithColUsersetObjectID(colUsersetObjectID),
+	common.WithColUsersetRelation(colUsersetRelation),
+	common.WithColCaveatName(colCaveatName),
+	common.WithColCaveatContext(colCaveatContext),
+	common.WithColExpiration(colExpiration),
+	common.WithPaginationFilterType(common.ExpandedLogicComparison),
+	common.WithPlaceholderFormat(sq.Question),
+	common.WithNowFunction(nowFunction),
+	common.WithColumnOptimization(common.ColumnOptimizationOptionStaticValues),
+)
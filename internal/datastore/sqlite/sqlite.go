@@ -0,0 +1,244 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"modernc.org/sqlite"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	"github.com/authzed/spicedb/pkg/datastore"
+	"github.com/authzed/spicedb/pkg/datastore/options"
+)
+
+const (
+	Engine = "sqlite"
+
+	defaultWatchBufferLength = 128
+	defaultWatchPollInterval = 100 * time.Millisecond
+	busyTimeoutMillis        = 5000
+
+	errUnableToWrite = "unable to write to sqlite datastore: %w"
+)
+
+var (
+	registerFunctionsOnce sync.Once
+	errRegisterFunctions  error
+)
+
+// NewSQLiteDatastore creates a new Datastore compliant datastore stored in a single SQLite file
+// at path. The database is created and migrated to the latest schema if necessary.
+//
+// If the watchBufferLength value of 0 is set then a default value of 128 will be used.
+func NewSQLiteDatastore(
+	ctx context.Context,
+	path string,
+	watchBufferLength uint16,
+	gcWindow time.Duration,
+) (datastore.Datastore, error) {
+	if path == "" {
+		return nil, errors.New("sqlite datastore requires a database file path")
+	}
+
+	if err := registerFunctions(); err != nil {
+		return nil, err
+	}
+
+	dsn := fmt.Sprintf(
+		"%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate",
+		path, busyTimeoutMillis,
+	)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open sqlite datastore at %s: %w", path, err)
+	}
+
+	uniqueID, err := migrate(ctx, db)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to migrate sqlite datastore at %s: %w", path, err)
+	}
+
+	if watchBufferLength == 0 {
+		watchBufferLength = defaultWatchBufferLength
+	}
+
+	return &sqliteDatastore{
+		CommonDecoder: revisions.CommonDecoder{
+			Kind:              revisions.TransactionID,
+			DatastoreUniqueID: uniqueID,
+		},
+		db:                      db,
+		gcWindow:                gcWindow,
+		watchBufferLength:       watchBufferLength,
+		watchBufferWriteTimeout: 100 * time.Millisecond,
+		watchPollInterval:       defaultWatchPollInterval,
+	}, nil
+}
+
+// registerFunctions registers the SQL functions used by the datastore with the driver. This must
+// happen before any connection is opened.
+func registerFunctions() error {
+	registerFunctionsOnce.Do(func() {
+		errRegisterFunctions = sqlite.RegisterScalarFunction(nowFunction, 0, func(_ *sqlite.FunctionContext, _ []driver.Value) (driver.Value, error) {
+			return formatTime(time.Now()), nil
+		})
+	})
+	return errRegisterFunctions
+}
+
+type sqliteDatastore struct {
+	revisions.CommonDecoder
+
+	db *sql.DB
+
+	// writeLock serializes read-write transactions, as SQLite only supports a single writer.
+	writeLock sync.Mutex
+
+	gcRunLock sync.Mutex
+	gcHasRun  atomic.Bool
+
+	gcWindow                time.Duration
+	watchBufferLength       uint16
+	watchBufferWriteTimeout time.Duration
+	watchPollInterval       time.Duration
+}
+
+func (sds *sqliteDatastore) MetricsID() (string, error) {
+	return Engine, nil
+}
+
+func (sds *sqliteDatastore) SnapshotReader(rev datastore.Revision) datastore.Reader {
+	txID, err := transactionID(rev)
+	if err != nil {
+		return &sqliteReader{initErr: err}
+	}
+
+	reader := newSQLiteReader(sds.db, nil, snapshotFilterer(txID))
+	return &reader
+}
+
+// snapshotFilterer restricts queries to the rows alive as of the given transaction.
+func snapshotFilterer(txID int64) queryFilterer {
+	return func(original sq.SelectBuilder) sq.SelectBuilder {
+		return original.
+			Where(sq.LtOrEq{colCreatedTxn: txID}).
+			Where(sq.Gt{colDeletedTxn: txID})
+	}
+}
+
+func (sds *sqliteDatastore) SupportsIntegrity() bool {
+	return false
+}
+
+func (sds *sqliteDatastore) ReadWriteTx(
+	ctx context.Context,
+	f datastore.TxUserFunc,
+	opts ...options.RWTOptionsOption,
+) (datastore.Revision, error) {
+	config := options.NewRWTOptionsWithOptions(opts...)
+
+	var metadata []byte
+	if config.Metadata != nil && len(config.Metadata.GetFields()) > 0 {
+		marshalled, err := json.Marshal(config.Metadata.AsMap())
+		if err != nil {
+			return datastore.NoRevision, fmt.Errorf(errUnableToWrite, err)
+		}
+		metadata = marshalled
+	}
+
+	sds.writeLock.Lock()
+	defer sds.writeLock.Unlock()
+
+	tx, err := sds.db.BeginTx(ctx, nil)
+	if err != nil {
+		return datastore.NoRevision, fmt.Errorf(errUnableToWrite, err)
+	}
+	defer func() {
+		// Rollback is a no-op once the transaction has been committed.
+		_ = tx.Rollback()
+	}()
+
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO "+tableTransaction+" ("+colTimestamp+", "+colMetadata+") VALUES (?, ?)",
+		formatTime(time.Now()), metadata,
+	)
+	if err != nil {
+		return datastore.NoRevision, fmt.Errorf(errUnableToWrite, err)
+	}
+
+	newTxID, err := result.LastInsertId()
+	if err != nil {
+		return datastore.NoRevision, fmt.Errorf(errUnableToWrite, err)
+	}
+
+	rwt := &sqliteReadWriteTx{
+		sqliteReader: newSQLiteReader(tx, tx, func(original sq.SelectBuilder) sq.SelectBuilder {
+			return original.Where(sq.Eq{colDeletedTxn: liveDeletedTxnID})
+		}),
+		tx:   tx,
+		txID: newTxID,
+	}
+	if err := f(ctx, rwt); err != nil {
+		// We *must* return the inner error unmodified in case it's not an error type
+		// that supports unwrapping (e.g. gRPC errors)
+		return datastore.NoRevision, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return datastore.NoRevision, fmt.Errorf(errUnableToWrite, err)
+	}
+
+	return revisions.NewForTransactionID(uint64(newTxID)), nil
+}
+
+func (sds *sqliteDatastore) ReadyState(ctx context.Context) (datastore.ReadyState, error) {
+	version, err := currentMigration(ctx, sds.db)
+	if err != nil {
+		return datastore.ReadyState{}, err
+	}
+
+	return common.NewMigrationValidator(headMigration, nil).MigrationReadyState(version), nil
+}
+
+func (sds *sqliteDatastore) OfflineFeatures() (*datastore.Features, error) {
+	return &datastore.Features{
+		Watch: datastore.Feature{
+			Status: datastore.FeatureSupported,
+		},
+		IntegrityData: datastore.Feature{
+			Status: datastore.FeatureUnsupported,
+		},
+		ContinuousCheckpointing: datastore.Feature{
+			Status: datastore.FeatureUnsupported,
+		},
+		WatchEmitsImmediately: datastore.Feature{
+			Status: datastore.FeatureUnsupported,
+		},
+	}, nil
+}
+
+func (sds *sqliteDatastore) Features(_ context.Context) (*datastore.Features, error) {
+	return sds.OfflineFeatures()
+}
+
+func (sds *sqliteDatastore) Close() error {
+	return sds.db.Close()
+}
+
+// formatTime renders t in the fixed-width UTC layout used for all timestamp columns, so that
+// timestamps can be compared as strings within SQLite.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+var _ datastore.Datastore = &sqliteDatastore{}
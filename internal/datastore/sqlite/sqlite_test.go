@@ -0,0 +1,254 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/authzed/spicedb/pkg/datastore"
+	ns "github.com/authzed/spicedb/pkg/namespace"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+func newTestDatastore(t *testing.T, path string, gcWindow time.Duration) datastore.Datastore {
+	t.Helper()
+
+	ds, err := NewSQLiteDatastore(t.Context(), path, 0, gcWindow)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ds.Close() })
+	return ds
+}
+
+func writeTestData(t *testing.T, ds datastore.Datastore, rels ...string) datastore.Revision {
+	t.Helper()
+
+	rev, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		if err := rwt.WriteNamespaces(ctx,
+			ns.Namespace("user"),
+			ns.Namespace("document", ns.MustRelation("reader", nil)),
+		); err != nil {
+			return err
+		}
+
+		updates := make([]tuple.RelationshipUpdate, 0, len(rels))
+		for _, rel := range rels {
+			updates = append(updates, tuple.Touch(tuple.MustParse(rel)))
+		}
+		return rwt.WriteRelationships(ctx, updates)
+	})
+	require.NoError(t, err)
+	return rev
+}
+
+func readTestRelationships(t *testing.T, ds datastore.Datastore, rev datastore.Revision, filter datastore.RelationshipsFilter) []string {
+	t.Helper()
+
+	if filter.OptionalResourceType == "" {
+		filter.OptionalResourceType = "document"
+	}
+
+	iter, err := ds.SnapshotReader(rev).QueryRelationships(t.Context(), filter)
+	require.NoError(t, err)
+
+	var found []string
+	for rel, err := range iter {
+		require.NoError(t, err)
+		found = append(found, tuple.MustString(rel))
+	}
+	return found
+}
+
+func TestSQLiteSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spicedb.db")
+
+	ds, err := NewSQLiteDatastore(t.Context(), path, 0, 1*time.Hour)
+	require.NoError(t, err)
+
+	written := writeTestData(t, ds, "document:doc1#reader@user:alice", "document:doc2#reader@user:bob")
+	uniqueID, err := ds.UniqueID(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, ds.Close())
+
+	reopened := newTestDatastore(t, path, 1*time.Hour)
+
+	head, err := reopened.HeadRevision(t.Context())
+	require.NoError(t, err)
+	require.True(t, head.Equal(written))
+
+	reopenedID, err := reopened.UniqueID(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, uniqueID, reopenedID)
+
+	require.ElementsMatch(t, []string{
+		"document:doc1#reader@user:alice",
+		"document:doc2#reader@user:bob",
+	}, readTestRelationships(t, reopened, head, datastore.RelationshipsFilter{}))
+
+	nsDef, lastWritten, err := reopened.SnapshotReader(head).ReadNamespaceByName(t.Context(), "document")
+	require.NoError(t, err)
+	require.Equal(t, "document", nsDef.Name)
+	require.True(t, lastWritten.Equal(written))
+
+	state, err := reopened.ReadyState(t.Context())
+	require.NoError(t, err)
+	require.True(t, state.IsReady)
+}
+
+func TestSQLiteSnapshotReads(t *testing.T) {
+	ds := newTestDatastore(t, filepath.Join(t.TempDir(), "spicedb.db"), 1*time.Hour)
+
+	first := writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	second, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		return rwt.WriteRelationships(ctx, []tuple.RelationshipUpdate{
+			tuple.Delete(tuple.MustParse("document:doc1#reader@user:alice")),
+			tuple.Create(tuple.MustParse("document:doc2#reader@user:bob")),
+		})
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"document:doc1#reader@user:alice"},
+		readTestRelationships(t, ds, first, datastore.RelationshipsFilter{}))
+	require.Equal(t, []string{"document:doc2#reader@user:bob"},
+		readTestRelationships(t, ds, second, datastore.RelationshipsFilter{}))
+
+	require.NoError(t, ds.CheckRevision(t.Context(), first))
+	require.NoError(t, ds.CheckRevision(t.Context(), second))
+}
+
+func TestSQLiteCreateExistingRelationshipFails(t *testing.T) {
+	ds := newTestDatastore(t, filepath.Join(t.TempDir(), "spicedb.db"), 1*time.Hour)
+
+	writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	_, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		return rwt.WriteRelationships(ctx, []tuple.RelationshipUpdate{
+			tuple.Create(tuple.MustParse("document:doc1#reader@user:alice")),
+		})
+	})
+	var existsErr common.CreateRelationshipExistsError
+	require.ErrorAs(t, err, &existsErr)
+}
+
+func TestSQLiteResourceIDPrefixIsLiteral(t *testing.T) {
+	ds := newTestDatastore(t, filepath.Join(t.TempDir(), "spicedb.db"), 1*time.Hour)
+
+	head := writeTestData(t, ds,
+		"document:team_a#reader@user:alice",
+		"document:teamxa#reader@user:bob",
+	)
+
+	require.Equal(t, []string{"document:team_a#reader@user:alice"},
+		readTestRelationships(t, ds, head, datastore.RelationshipsFilter{OptionalResourceIDPrefix: "team_"}))
+}
+
+func TestSQLiteWatch(t *testing.T) {
+	ds := newTestDatastore(t, filepath.Join(t.TempDir(), "spicedb.db"), 1*time.Hour)
+
+	start, err := ds.HeadRevision(t.Context())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	changes, errs := ds.Watch(ctx, start, datastore.WatchOptions{
+		Content: datastore.WatchRelationships | datastore.WatchSchema,
+	})
+
+	written := writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	select {
+	case change := <-changes:
+		require.True(t, change.Revision.Equal(written))
+		require.Len(t, change.RelationshipChanges, 1)
+		require.Equal(t, tuple.UpdateOperationTouch, change.RelationshipChanges[0].Operation)
+		require.Equal(t, "document:doc1#reader@user:alice", tuple.MustString(change.RelationshipChanges[0].Relationship))
+		require.Len(t, change.ChangedDefinitions, 2)
+
+	case err := <-errs:
+		require.NoError(t, err)
+
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for watch change")
+	}
+
+	deleted, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		return rwt.DeleteNamespaces(ctx, []string{"document"}, datastore.DeleteNamespacesAndRelationships)
+	})
+	require.NoError(t, err)
+
+	select {
+	case change := <-changes:
+		require.True(t, change.Revision.Equal(deleted))
+		require.Equal(t, []string{"document"}, change.DeletedNamespaces)
+		require.Len(t, change.RelationshipChanges, 1)
+		require.Equal(t, tuple.UpdateOperationDelete, change.RelationshipChanges[0].Operation)
+
+	case err := <-errs:
+		require.NoError(t, err)
+
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timed out waiting for watch change")
+	}
+}
+
+func TestSQLiteGarbageCollection(t *testing.T) {
+	ds := newTestDatastore(t, filepath.Join(t.TempDir(), "spicedb.db"), 50*time.Millisecond)
+	sds := ds.(*sqliteDatastore)
+
+	first := writeTestData(t, ds, "document:doc1#reader@user:alice")
+	_, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		return rwt.WriteRelationships(ctx, []tuple.RelationshipUpdate{
+			tuple.Delete(tuple.MustParse("document:doc1#reader@user:alice")),
+		})
+	})
+	require.NoError(t, err)
+	writeTestData(t, ds)
+
+	time.Sleep(100 * time.Millisecond)
+
+	head := writeTestData(t, ds, "document:doc2#reader@user:bob")
+
+	require.NoError(t, common.RunGarbageCollection(t.Context(), sds, 50*time.Millisecond))
+	require.True(t, sds.HasGCRun())
+
+	var tombstoned int
+	require.NoError(t, sds.db.QueryRowContext(t.Context(),
+		"SELECT COUNT(*) FROM "+tableRelationship+" WHERE "+colDeletedTxn+" != ?", liveDeletedTxnID,
+	).Scan(&tombstoned))
+	require.Zero(t, tombstoned)
+
+	require.Error(t, ds.CheckRevision(t.Context(), first))
+	require.NoError(t, ds.CheckRevision(t.Context(), head))
+	require.Equal(t, []string{"document:doc2#reader@user:bob"},
+		readTestRelationships(t, ds, head, datastore.RelationshipsFilter{}))
+}
+
+func TestSQLiteDeletesExpiredRelationships(t *testing.T) {
+	ds := newTestDatastore(t, filepath.Join(t.TempDir(), "spicedb.db"), 50*time.Millisecond)
+
+	writeTestData(t, ds, "document:doc1#reader@user:alice")
+
+	expired := tuple.MustParse("document:doc2#reader@user:bob")
+	expiration := time.Now().Add(-1 * time.Hour)
+	expired.OptionalExpiration = &expiration
+	head, err := ds.ReadWriteTx(t.Context(), func(ctx context.Context, rwt datastore.ReadWriteTransaction) error {
+		return rwt.WriteRelationships(ctx, []tuple.RelationshipUpdate{tuple.Touch(expired)})
+	})
+	require.NoError(t, err)
+
+	gc, err := ds.(*sqliteDatastore).BuildGarbageCollector(t.Context())
+	require.NoError(t, err)
+	defer gc.Close()
+
+	deleted, err := gc.DeleteExpiredRels(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	require.Equal(t, []string{"document:doc1#reader@user:alice"},
+		readTestRelationships(t, ds, head, datastore.RelationshipsFilter{}))
+}
@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/authzed/spicedb/pkg/datastore"
+)
+
+func (sds *sqliteDatastore) Statistics(ctx context.Context) (datastore.Stats, error) {
+	head, err := sds.HeadRevision(ctx)
+	if err != nil {
+		return datastore.Stats{}, fmt.Errorf("unable to compute head revision: %w", err)
+	}
+
+	var count uint64
+	if err := sds.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM "+tableRelationship+" WHERE "+colDeletedTxn+" = ?", liveDeletedTxnID,
+	).Scan(&count); err != nil {
+		return datastore.Stats{}, fmt.Errorf("unable to count relationships: %w", err)
+	}
+
+	objTypes, err := sds.SnapshotReader(head).ListAllNamespaces(ctx)
+	if err != nil {
+		return datastore.Stats{}, fmt.Errorf("unable to list object types: %w", err)
+	}
+
+	return datastore.Stats{
+		UniqueID:                   sds.DatastoreUniqueID,
+		EstimatedRelationshipCount: count,
+		ObjectTypeStatistics:       datastore.ComputeObjectTypeStats(objTypes),
+	}, nil
+}
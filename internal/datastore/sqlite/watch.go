@@ -0,0 +1,367 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
+	"github.com/akoserwal/embedspicedb/internal/datastore/revisions"
+	"github.com/authzed/spicedb/pkg/datastore"
+	"github.com/authzed/spicedb/pkg/tuple"
+)
+
+const errWatchError = "watch error: %w"
+
+// Watch polls the transaction table for newly committed transactions and emits the changes they
+// made. Because every write goes through the same file, changes made by other processes sharing
+// the database are observed as well.
+func (sds *sqliteDatastore) Watch(ctx context.Context, afterRevision datastore.Revision, options datastore.WatchOptions) (<-chan datastore.RevisionChanges, <-chan error) {
+	watchBufferLength := options.WatchBufferLength
+	if watchBufferLength == 0 {
+		watchBufferLength = sds.watchBufferLength
+	}
+
+	updates := make(chan datastore.RevisionChanges, watchBufferLength)
+	errs := make(chan error, 1)
+
+	if options.EmissionStrategy == datastore.EmitImmediatelyStrategy {
+		close(updates)
+		errs <- errors.New("emit immediately strategy is unsupported in SQLite")
+		return updates, errs
+	}
+
+	afterTxID, err := transactionID(afterRevision)
+	if err != nil {
+		close(updates)
+		errs <- err
+		return updates, errs
+	}
+
+	watchBufferWriteTimeout := options.WatchBufferWriteTimeout
+	if watchBufferWriteTimeout == 0 {
+		watchBufferWriteTimeout = sds.watchBufferWriteTimeout
+	}
+
+	sendChange := func(change datastore.RevisionChanges) bool {
+		select {
+		case updates <- change:
+			return true
+
+		default:
+			// If we cannot immediately write, setup the timer and try again.
+		}
+
+		timer := time.NewTimer(watchBufferWriteTimeout)
+		defer timer.Stop()
+
+		select {
+		case updates <- change:
+			return true
+
+		case <-timer.C:
+			errs <- datastore.NewWatchDisconnectedErr()
+			return false
+		}
+	}
+
+	go func() {
+		defer close(updates)
+		defer close(errs)
+
+		ticker := time.NewTicker(sds.watchPollInterval)
+		defer ticker.Stop()
+
+		currentTxn := afterTxID
+		for {
+			stagedUpdates, headTxn, err := sds.loadChanges(ctx, currentTxn, options)
+			if err != nil {
+				switch {
+				case errors.Is(ctx.Err(), context.Canceled):
+					errs <- datastore.NewWatchCanceledErr()
+				default:
+					errs <- fmt.Errorf(errWatchError, err)
+				}
+				return
+			}
+
+			for _, changeToWrite := range stagedUpdates {
+				if !sendChange(changeToWrite) {
+					return
+				}
+			}
+			currentTxn = headTxn
+
+			select {
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.Canceled) {
+					errs <- datastore.NewWatchCanceledErr()
+				} else {
+					errs <- fmt.Errorf(errWatchError, ctx.Err())
+				}
+				return
+
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return updates, errs
+}
+
+// loadChanges returns the changes committed after afterTxn, up to and including the current head
+// transaction, which is returned alongside them.
+func (sds *sqliteDatastore) loadChanges(ctx context.Context, afterTxn int64, options datastore.WatchOptions) ([]datastore.RevisionChanges, int64, error) {
+	var headTxn int64
+	if err := sds.db.QueryRowContext(ctx, "SELECT MAX("+colID+") FROM "+tableTransaction).Scan(&headTxn); err != nil {
+		return nil, 0, err
+	}
+	if headTxn <= afterTxn {
+		return nil, afterTxn, nil
+	}
+
+	tracked := common.NewChanges(revisions.TransactionIDKeyFunc, options.Content, 0)
+
+	if err := sds.loadTransactionMetadata(ctx, tracked, afterTxn, headTxn); err != nil {
+		return nil, 0, err
+	}
+
+	if options.Content&datastore.WatchRelationships == datastore.WatchRelationships {
+		if err := sds.loadRelationshipChanges(ctx, tracked, afterTxn, headTxn); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if options.Content&datastore.WatchSchema == datastore.WatchSchema {
+		if err := sds.loadSchemaChanges(ctx, tracked, afterTxn, headTxn); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	changes, err := tracked.AsRevisionChanges(revisions.TransactionIDKeyLessThanFunc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if options.Content&datastore.WatchCheckpoints == datastore.WatchCheckpoints {
+		changes = append(changes, datastore.RevisionChanges{
+			Revision:     revisions.NewForTransactionID(uint64(headTxn)),
+			IsCheckpoint: true,
+		})
+	}
+
+	return changes, headTxn, nil
+}
+
+func (sds *sqliteDatastore) loadTransactionMetadata(
+	ctx context.Context,
+	tracked *common.Changes[revisions.TransactionIDRevision, uint64],
+	afterTxn, headTxn int64,
+) error {
+	query, args, err := sq.Select(colID, colMetadata).
+		From(tableTransaction).
+		Where(sq.Gt{colID: afterTxn}).
+		Where(sq.LtOrEq{colID: headTxn}).
+		Where(sq.NotEq{colMetadata: nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := sds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var txID int64
+		var serialized []byte
+		if err := rows.Scan(&txID, &serialized); err != nil {
+			return err
+		}
+
+		var metadata common.TransactionMetadata
+		if err := json.Unmarshal(serialized, &metadata); err != nil {
+			return fmt.Errorf("unable to decode transaction metadata: %w", err)
+		}
+
+		if err := tracked.AddRevisionMetadata(ctx, revisions.NewForTransactionID(uint64(txID)), metadata); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (sds *sqliteDatastore) loadRelationshipChanges(
+	ctx context.Context,
+	tracked *common.Changes[revisions.TransactionIDRevision, uint64],
+	afterTxn, headTxn int64,
+) error {
+	query, args, err := sq.Select(
+		colNamespace, colObjectID, colRelation,
+		colUsersetNamespace, colUsersetObjectID, colUsersetRelation,
+		colCaveatName, colCaveatContext, colExpiration,
+		colCreatedTxn, colDeletedTxn,
+	).
+		From(tableRelationship).
+		Where(sq.Or{
+			sq.And{sq.Gt{colCreatedTxn: afterTxn}, sq.LtOrEq{colCreatedTxn: headTxn}},
+			sq.And{sq.Gt{colDeletedTxn: afterTxn}, sq.LtOrEq{colDeletedTxn: headTxn}},
+		}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	rows, err := sds.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rel tuple.Relationship
+		var caveatName sql.NullString
+		var caveatCtx caveatContextWrapper
+		var expiration *time.Time
+		var createdTxn, deletedTxn int64
+		if err := rows.Scan(
+			&rel.Resource.ObjectType, &rel.Resource.ObjectID, &rel.Resource.Relation,
+			&rel.Subject.ObjectType, &rel.Subject.ObjectID, &rel.Subject.Relation,
+			&caveatName, &caveatCtx, &expiration,
+			&createdTxn, &deletedTxn,
+		); err != nil {
+			return err
+		}
+
+		rel.OptionalCaveat, err = common.ContextualizedCaveatFrom(caveatName.String, caveatCtx)
+		if err != nil {
+			return err
+		}
+
+		if expiration != nil {
+			t := expiration.UTC()
+			rel.OptionalExpiration = &t
+		}
+
+		if createdTxn > afterTxn && createdTxn <= headTxn {
+			if err := tracked.AddRelationshipChange(ctx, revisions.NewForTransactionID(uint64(createdTxn)), rel, tuple.UpdateOperationTouch); err != nil {
+				return err
+			}
+		}
+
+		if deletedTxn > afterTxn && deletedTxn <= headTxn {
+			if err := tracked.AddRelationshipChange(ctx, revisions.NewForTransactionID(uint64(deletedTxn)), rel, tuple.UpdateOperationDelete); err != nil {
+				return err
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func (sds *sqliteDatastore) loadSchemaChanges(
+	ctx context.Context,
+	tracked *common.Changes[revisions.TransactionIDRevision, uint64],
+	afterTxn, headTxn int64,
+) error {
+	query, args, err := sq.Select(colName, colCreatedTxn, colDeletedTxn).
+		From(tableSchema).
+		Where(sq.Eq{colChunkIndex: 0}).
+		Where(sq.Or{
+			sq.And{sq.Gt{colCreatedTxn: afterTxn}, sq.LtOrEq{colCreatedTxn: headTxn}},
+			sq.And{sq.Gt{colDeletedTxn: afterTxn}, sq.LtOrEq{colDeletedTxn: headTxn}},
+		}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	type schemaRow struct {
+		name       string
+		createdTxn int64
+		deletedTxn int64
+	}
+
+	// Collect the rows first, as reading definitions issues further queries.
+	var schemaRows []schemaRow
+	writtenAt := make(map[string]map[int64]struct{})
+	if err := func() error {
+		rows, err := sds.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var row schemaRow
+			if err := rows.Scan(&row.name, &row.createdTxn, &row.deletedTxn); err != nil {
+				return err
+			}
+			schemaRows = append(schemaRows, row)
+
+			if _, ok := writtenAt[row.name]; !ok {
+				writtenAt[row.name] = make(map[int64]struct{})
+			}
+			writtenAt[row.name][row.createdTxn] = struct{}{}
+		}
+		return rows.Err()
+	}(); err != nil {
+		return err
+	}
+
+	for _, row := range schemaRows {
+		if row.createdTxn > afterTxn && row.createdTxn <= headTxn {
+			rev := revisions.NewForTransactionID(uint64(row.createdTxn))
+			definition, err := sds.readDefinitionAt(ctx, rev, row.name)
+			if err != nil {
+				return err
+			}
+			if err := tracked.AddChangedDefinition(ctx, rev, definition); err != nil {
+				return err
+			}
+		}
+
+		if row.deletedTxn > afterTxn && row.deletedTxn <= headTxn {
+			// A definition which was rewritten is reported as changed by its replacement.
+			if _, ok := writtenAt[row.name][row.deletedTxn]; ok {
+				continue
+			}
+
+			rev := revisions.NewForTransactionID(uint64(row.deletedTxn))
+			switch {
+			case strings.HasPrefix(row.name, namespacePrefix):
+				err = tracked.AddDeletedNamespace(ctx, rev, strings.TrimPrefix(row.name, namespacePrefix))
+			case strings.HasPrefix(row.name, caveatPrefix):
+				err = tracked.AddDeletedCaveat(ctx, rev, strings.TrimPrefix(row.name, caveatPrefix))
+			default:
+				err = fmt.Errorf("unknown schema definition %q", row.name)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (sds *sqliteDatastore) readDefinitionAt(ctx context.Context, rev datastore.Revision, name string) (datastore.SchemaDefinition, error) {
+	reader := sds.SnapshotReader(rev)
+	switch {
+	case strings.HasPrefix(name, namespacePrefix):
+		def, _, err := reader.ReadNamespaceByName(ctx, strings.TrimPrefix(name, namespacePrefix))
+		return def, err
+	case strings.HasPrefix(name, caveatPrefix):
+		def, _, err := reader.ReadCaveatByName(ctx, strings.TrimPrefix(name, caveatPrefix))
+		return def, err
+	default:
+		return nil, fmt.Errorf("unknown schema definition %q", name)
+	}
+}
@@ -0,0 +1,110 @@
+// Package gateway serves the SpiceDB HTTP API, translating JSON requests into calls on a gRPC client
+// connection to the server.
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"io/fs"
+	"net"
+	"net/http"
+	"time"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/akoserwal/embedspicedb/internal/socket"
+)
+
+// registrations register the handlers of the services exposed over HTTP.
+var registrations = []func(context.Context, *runtime.ServeMux, *grpc.ClientConn) error{
+	v1.RegisterPermissionsServiceHandler,
+	v1.RegisterSchemaServiceHandler,
+	v1.RegisterWatchServiceHandler,
+	v1.RegisterExperimentalServiceHandler,
+}
+
+// NewHandler returns a handler serving the SpiceDB HTTP API over conn. Request bodies and responses
+// are JSON using the field names of the protobuf definitions, as served by SpiceDB's own gateway.
+// The Authorization header is forwarded, so requests authenticate with the preshared key.
+func NewHandler(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.HTTPBodyMarshaler{
+			Marshaler: &runtime.JSONPb{
+				MarshalOptions: protojson.MarshalOptions{
+					UseProtoNames:   true,
+					EmitUnpopulated: true,
+				},
+				UnmarshalOptions: protojson.UnmarshalOptions{
+					DiscardUnknown: true,
+				},
+			},
+		}),
+	)
+	for _, register := range registrations {
+		if err := register(ctx, mux, conn); err != nil {
+			return nil, err
+		}
+	}
+	return mux, nil
+}
+
+// Server is the HTTP gateway bound to its listener.
+type Server struct {
+	srv  *http.Server
+	addr string
+}
+
+// Start starts serving handler on address, a TCP address or a unix:// socket path. Sockets are
+// created with mode. If tlsConfig isn't nil, the gateway serves HTTPS with it. The caller is
+// responsible for calling Shutdown.
+func Start(address string, mode fs.FileMode, tlsConfig *tls.Config, handler http.Handler) (*Server, error) {
+	ln, err := socket.Listen(address, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		addr: socket.Addr(ln.Addr()),
+		srv: &http.Server{
+			Handler: handler,
+			// No write timeout: watch responses stream for as long as the client stays connected.
+			ReadHeaderTimeout: 5 * time.Second,
+			TLSConfig:         tlsConfig,
+		},
+	}
+
+	go func(ln net.Listener) {
+		// Serve returns http.ErrServerClosed on Shutdown.
+		if tlsConfig != nil {
+			_ = s.srv.ServeTLS(ln, "", "")
+			return
+		}
+		_ = s.srv.Serve(ln)
+	}(ln)
+
+	return s, nil
+}
+
+// Addr returns the bound address (e.g. "[::]:8443" or "unix:///run/gateway.sock").
+func (s *Server) Addr() string {
+	if s == nil {
+		return ""
+	}
+	return s.addr
+}
+
+// Shutdown stops accepting requests, waits for the ones in progress and closes the listener,
+// removing its socket file. Requests still in progress when ctx is done, such as watches, are cut off.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s == nil || s.srv == nil {
+		return nil
+	}
+	err := s.srv.Shutdown(ctx)
+	if err != nil {
+		_ = s.srv.Close()
+	}
+	return err
+}
@@ -0,0 +1,318 @@
+// Package grpcfront serves the gRPC server's clients on the configured address, terminating TLS if
+// configured, and forwards their calls to the SpiceDB server, which serves gRPC in memory. SpiceDB
+// can't serve a listener or a tls.Config of its own, so the front serves them: over TCP, unix domain
+// sockets, with or without TLS alike. The peer of each call, with its TLS state, is handed to the
+// SpiceDB server's interceptors, so the client certificate remains visible to them.
+package grpcfront
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+	"github.com/akoserwal/embedspicedb/internal/socket"
+)
+
+// handshakeTimeout bounds the TLS handshake of a client connection.
+const handshakeTimeout = 10 * time.Second
+
+// peerKey is the metadata key carrying the ID of a forwarded call's peer to the backend server.
+const peerKey = "embedspicedb-peer"
+
+// Front serves the connections accepted on a listener, forwarding their calls to a backend server.
+type Front struct {
+	ln      net.Listener
+	addr    net.Addr
+	srv     *grpc.Server
+	conns   connCounter
+	backend *grpc.ClientConn
+	done    chan struct{}
+
+	mu     sync.Mutex
+	peers  map[string]*peer.Peer // GUARDED_BY(mu)
+	served bool                  // GUARDED_BY(mu)
+}
+
+// New returns a front serving ln once Serve is called. If creds isn't nil, client connections are
+// secured with them, such as TLS credentials.
+func New(ln net.Listener, creds credentials.TransportCredentials) *Front {
+	f := &Front{
+		ln:    ln,
+		addr:  ln.Addr(),
+		done:  make(chan struct{}),
+		peers: make(map[string]*peer.Peer),
+	}
+	opts := []grpc.ServerOption{
+		grpc.UnknownServiceHandler(f.forward),
+		grpc.ForceServerCodec(frameCodec{}),
+		grpc.StatsHandler(&f.conns),
+		grpc.ConnectionTimeout(handshakeTimeout),
+		// Message sizes are limited by the backend server
+		grpc.MaxRecvMsgSize(math.MaxInt32),
+	}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	f.srv = grpc.NewServer(opts...)
+	return f
+}
+
+// Serve starts serving the listener, forwarding calls over backend. The backend server must run
+// the interceptors returned by UnaryServerInterceptor and StreamServerInterceptor first.
+func (f *Front) Serve(backend *grpc.ClientConn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.backend = backend
+	f.served = true
+	go func() {
+		defer close(f.done)
+		if err := f.srv.Serve(f.ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Error().Err(err).Msg("failed to accept gRPC connection; no longer accepting connections")
+		}
+	}()
+}
+
+// Addr returns the address clients connect to (e.g. "[::]:50051" or "unix:///run/spicedb.sock").
+func (f *Front) Addr() string {
+	if f == nil {
+		return ""
+	}
+	return socket.Addr(f.addr)
+}
+
+// StopAccepting closes the listener, removing its socket file, and tells clients to make no new
+// calls. Calls being forwarded carry on.
+func (f *Front) StopAccepting() {
+	go f.srv.GracefulStop()
+}
+
+// Terminate closes the client connections, ending the calls being forwarded, and returns how many
+// there were.
+func (f *Front) Terminate() int {
+	n := f.conns.open()
+	f.srv.Stop()
+	return n
+}
+
+// Close closes the listener and the client connections, and waits for the front to stop.
+func (f *Front) Close() error {
+	f.srv.Stop()
+	f.mu.Lock()
+	served := f.served
+	f.mu.Unlock()
+	if served {
+		<-f.done
+		return nil
+	}
+	if err := f.ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// forward forwards a call to the backend server, relaying the messages, headers and trailers both
+// ways, and returns the backend's status.
+func (f *Front) forward(_ any, stream grpc.ServerStream) error {
+	method, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "failed to determine the method of the call")
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	// The metadata is forwarded as is, except for a peer ID set by the client
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	md.Delete(peerKey)
+	if p, ok := peer.FromContext(ctx); ok {
+		id, forget := f.register(p)
+		defer forget()
+		md.Set(peerKey, id)
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	desc := &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}
+	backendStream, err := f.backend.NewStream(ctx, desc, method,
+		grpc.ForceCodec(frameCodec{}),
+		grpc.MaxCallRecvMsgSize(math.MaxInt32),
+	)
+	if err != nil {
+		return err
+	}
+
+	// The client's messages are forwarded until it closes its side of the stream, or the call ends
+	go func() {
+		for {
+			msg := &frame{}
+			if err := stream.RecvMsg(msg); err != nil {
+				if errors.Is(err, io.EOF) {
+					_ = backendStream.CloseSend()
+					return
+				}
+				cancel()
+				return
+			}
+			if err := backendStream.SendMsg(msg); err != nil {
+				// The backend's status is returned by RecvMsg below
+				return
+			}
+		}
+	}()
+
+	if header, err := backendStream.Header(); err == nil {
+		if err := stream.SendHeader(header); err != nil {
+			return err
+		}
+	}
+	for {
+		msg := &frame{}
+		if err := backendStream.RecvMsg(msg); err != nil {
+			stream.SetTrailer(backendStream.Trailer())
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := stream.SendMsg(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// register records the peer of a call being forwarded, returning its ID and the function forgetting
+// it once the call ended. IDs are random, so clients can't claim the peers of other calls.
+func (f *Front) register(p *peer.Peer) (string, func()) {
+	id := rand.Text()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.peers[id] = p
+	return id, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.peers, id)
+	}
+}
+
+// restorePeer returns ctx with the peer of the forwarded call it belongs to, if any, in place of the
+// front's own connection, and without the peer ID in its metadata.
+func (f *Front) restorePeer(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	ids := md.Get(peerKey)
+	if len(ids) == 0 {
+		return ctx
+	}
+	md = md.Copy()
+	md.Delete(peerKey)
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	f.mu.Lock()
+	p, ok := f.peers[ids[0]]
+	f.mu.Unlock()
+	if !ok {
+		return ctx
+	}
+	return peer.NewContext(ctx, p)
+}
+
+// UnaryServerInterceptor returns the backend server's interceptor restoring the peers of forwarded
+// unary calls.
+func (f *Front) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(f.restorePeer(ctx), req)
+	}
+}
+
+// StreamServerInterceptor returns the backend server's interceptor restoring the peers of forwarded
+// streaming calls.
+func (f *Front) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &peerStream{ServerStream: stream, ctx: f.restorePeer(stream.Context())})
+	}
+}
+
+// peerStream is a server stream whose context carries the peer of the forwarded call.
+type peerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *peerStream) Context() context.Context {
+	return s.ctx
+}
+
+// frame is a message forwarded as is, in its wire format.
+type frame struct {
+	data []byte
+}
+
+// frameCodec reads and writes frames, leaving the messages encoded.
+type frameCodec struct{}
+
+func (frameCodec) Marshal(v any) ([]byte, error) {
+	f, ok := v.(*frame)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "unexpected message type %T", v)
+	}
+	return f.data, nil
+}
+
+func (frameCodec) Unmarshal(data []byte, v any) error {
+	f, ok := v.(*frame)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected message type %T", v)
+	}
+	// data is reused once Unmarshal returns
+	f.data = append([]byte(nil), data...)
+	return nil
+}
+
+// Name returns the name of the protobuf codec, so the content type of the calls is unchanged.
+func (frameCodec) Name() string {
+	return "proto"
+}
+
+// connCounter counts the client connections open.
+type connCounter struct {
+	n atomic.Int64
+}
+
+func (c *connCounter) open() int {
+	return int(c.n.Load())
+}
+
+func (c *connCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleRPC(context.Context, stats.RPCStats) {}
+
+func (c *connCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (c *connCounter) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		c.n.Add(1)
+	case *stats.ConnEnd:
+		c.n.Add(-1)
+	}
+}
@@ -0,0 +1,263 @@
+package grpcfront
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startBackend serves the health service in memory behind the front's interceptors, followed by
+// next, and starts the front forwarding calls to it.
+func startBackend(t *testing.T, f *Front, next ...grpc.UnaryServerInterceptor) {
+	t.Helper()
+	ln := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{f.UnaryServerInterceptor()}, next...)...))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///backend",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	f.Serve(conn)
+}
+
+// dial opens a client connection to the front.
+func dial(t *testing.T, f *Front, creds credentials.TransportCredentials) *grpc.ClientConn {
+	t.Helper()
+	conn, err := grpc.NewClient(f.Addr(), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestFrontForwardsCalls(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := New(ln, nil)
+	defer front.Close()
+	startBackend(t, front)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := healthpb.NewHealthClient(dial(t, front, insecure.NewCredentials()))
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", resp.GetStatus())
+	}
+
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("error = %v, want the backend's NotFound status", err)
+	}
+
+	if n := front.Terminate(); n != 1 {
+		t.Errorf("Terminate() = %d, want the client's connection", n)
+	}
+}
+
+func TestFrontRestoresPeers(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 0)
+	serverCert := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+	clientCert := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := New(ln, credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate()},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool(),
+	}))
+	defer front.Close()
+
+	type call struct {
+		peer *peer.Peer
+		md   metadata.MD
+	}
+	calls := make(chan call, 1)
+	startBackend(t, front, func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		p, _ := peer.FromContext(ctx)
+		md, _ := metadata.FromIncomingContext(ctx)
+		calls <- call{peer: p, md: md}
+		return handler(ctx, req)
+	})
+
+	conn := dial(t, front, credentials.NewTLS(&tls.Config{
+		RootCAs:      ca.pool(),
+		Certificates: []tls.Certificate{clientCert.tlsCertificate()},
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// A client can't claim the peer of another call
+	ctx = metadata.AppendToOutgoingContext(ctx, peerKey, "forged")
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-calls
+	if got.peer == nil {
+		t.Fatal("the backend saw no peer")
+	}
+	info, ok := got.peer.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		t.Fatalf("the backend saw auth info %T, want the client's TLS state", got.peer.AuthInfo)
+	}
+	if len(info.State.VerifiedChains) == 0 || info.State.VerifiedChains[0][0].Subject.CommonName != "client" {
+		t.Errorf("the backend didn't see the client's verified certificate: %v", info.State.PeerCertificates)
+	}
+	if len(got.md.Get(peerKey)) != 0 {
+		t.Errorf("the backend saw the peer ID %v in the metadata", got.md.Get(peerKey))
+	}
+}
+
+// flakyListener fails its first Accept calls with a temporary error.
+type flakyListener struct {
+	net.Listener
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	if l.failures > 0 {
+		l.failures--
+		l.mu.Unlock()
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: syscall.EMFILE}
+	}
+	l.mu.Unlock()
+	return l.Listener.Accept()
+}
+
+func TestFrontRetriesTemporaryAcceptErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := New(&flakyListener{Listener: ln, failures: 3}, nil)
+	defer front.Close()
+	startBackend(t, front)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := healthpb.NewHealthClient(dial(t, front, insecure.NewCredentials()))
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("connection accepted after temporary errors was not served: %v", err)
+	}
+}
+
+func TestFrontStopsOnPermanentAcceptErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	front := New(&failingListener{Listener: ln}, nil)
+	startBackend(t, front)
+
+	select {
+	case <-front.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("front kept serving after a permanent error")
+	}
+	_ = front.Close()
+}
+
+// failingListener fails every Accept call with an error which is not temporary.
+type failingListener struct {
+	net.Listener
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("listener broken")
+}
+
+// testCert is a certificate and its key, signed by a test CA or self-signed.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate for 127.0.0.1, signed by ca or, if ca is nil, a self-signed CA.
+func newTestCert(t *testing.T, name string, ca *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+	}
+	parent, parentKey := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		parent, parentKey = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
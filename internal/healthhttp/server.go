@@ -2,9 +2,13 @@ package healthhttp
 
 import (
 	"context"
+	"crypto/tls"
+	"io/fs"
 	"net"
 	"net/http"
 	"time"
+
+	"github.com/akoserwal/embedspicedb/internal/socket"
 )
 
 // Server is a small wrapper around an HTTP server + bound listener, so callers can
@@ -15,33 +19,39 @@ type Server struct {
 	addr string
 }
 
-// Start creates and starts an HTTP server bound to the provided address.
+// Start creates and starts an HTTP server bound to the provided address, a TCP address or a unix://
+// socket path. Sockets are created with mode. If tlsConfig isn't nil, the server serves HTTPS with it.
 // The caller is responsible for calling Shutdown.
-func Start(address string, handler http.Handler) (*Server, error) {
-	ln, err := net.Listen("tcp", address)
+func Start(address string, mode fs.FileMode, tlsConfig *tls.Config, handler http.Handler) (*Server, error) {
+	ln, err := socket.Listen(address, mode)
 	if err != nil {
 		return nil, err
 	}
 
 	s := &Server{
 		ln:   ln,
-		addr: ln.Addr().String(),
+		addr: socket.Addr(ln.Addr()),
 		srv: &http.Server{
 			Handler:      handler,
 			ReadTimeout:  5 * time.Second,
 			WriteTimeout: 5 * time.Second,
+			TLSConfig:    tlsConfig,
 		},
 	}
 
 	go func() {
 		// Serve will return http.ErrServerClosed on Shutdown; callers decide logging.
+		if tlsConfig != nil {
+			_ = s.srv.ServeTLS(ln, "", "")
+			return
+		}
 		_ = s.srv.Serve(ln)
 	}()
 
 	return s, nil
 }
 
-// Addr returns the bound address (e.g. "127.0.0.1:54321").
+// Addr returns the bound address (e.g. "127.0.0.1:54321" or "unix:///run/health.sock").
 func (s *Server) Addr() string {
 	if s == nil {
 		return ""
@@ -55,6 +65,14 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return nil
 	}
 	// Shutdown will stop accepting new connections and gracefully drain existing ones.
-	// It also closes the listener used by Serve.
+	// It also closes the listener used by Serve, removing its socket file.
 	return s.srv.Shutdown(ctx)
 }
+
+// Close stops the server immediately, closing its listener and connections.
+func (s *Server) Close() error {
+	if s == nil || s.srv == nil {
+		return nil
+	}
+	return s.srv.Close()
+}
@@ -0,0 +1,175 @@
+// Package httpsource fetches schemas published at HTTP(S) URLs, revalidating the fetched copies
+// with conditional requests, and polls them for changes.
+package httpsource
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+const (
+	// DefaultPollInterval is the interval between polls when none is configured.
+	DefaultPollInterval = 30 * time.Second
+
+	// DefaultTimeout is the timeout of requests made with the default client.
+	DefaultTimeout = 10 * time.Second
+
+	// MaxBodySize is the largest schema accepted from a URL.
+	MaxBodySize = 10 << 20
+)
+
+// Source is a schema served at an HTTP(S) URL.
+type Source struct {
+	url    string
+	client *http.Client
+
+	mu           sync.Mutex
+	fetched      bool   // GUARDED_BY(mu)
+	body         []byte // GUARDED_BY(mu)
+	etag         string // GUARDED_BY(mu)
+	lastModified string // GUARDED_BY(mu)
+}
+
+// New returns the source of the schema served at url. A nil client uses a client with DefaultTimeout.
+func New(url string, client *http.Client) *Source {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Source{url: url, client: client}
+}
+
+// URL returns the URL the schema is served at.
+func (s *Source) URL() string {
+	return s.url
+}
+
+// Fetch returns the schema served at the URL, and whether it differs from the previously fetched
+// schema. Once fetched, the schema is revalidated with If-None-Match and If-Modified-Since, so an
+// unchanged schema is not transferred again.
+func (s *Source) Fetch(ctx context.Context) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch schema from %s: %w", s.url, err)
+	}
+	if s.fetched {
+		if s.etag != "" {
+			req.Header.Set("If-None-Match", s.etag)
+		}
+		if s.lastModified != "" {
+			req.Header.Set("If-Modified-Since", s.lastModified)
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch schema from %s: %w", s.url, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && s.fetched:
+		return s.body, false, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, false, fmt.Errorf("failed to fetch schema from %s: unexpected status %s", s.url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to fetch schema from %s: %w", s.url, err)
+	}
+	if len(body) > MaxBodySize {
+		return nil, false, fmt.Errorf("failed to fetch schema from %s: schema exceeds %d bytes", s.url, MaxBodySize)
+	}
+
+	changed := !s.fetched || !bytes.Equal(body, s.body)
+	s.fetched = true
+	s.body = body
+	s.etag = resp.Header.Get("ETag")
+	s.lastModified = resp.Header.Get("Last-Modified")
+	return body, changed, nil
+}
+
+// Poller polls sources for changes and reloads the schema when they change.
+type Poller struct {
+	sources    []*Source
+	interval   time.Duration
+	reloadFunc func(changed []string) error
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewPoller returns a poller fetching the sources every interval, and calling reloadFunc with the
+// URLs whose schema changed. A zero interval defaults to DefaultPollInterval.
+func NewPoller(sources []*Source, interval time.Duration, reloadFunc func(changed []string) error) *Poller {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Poller{
+		sources:    sources,
+		interval:   interval,
+		reloadFunc: reloadFunc,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Start begins polling the sources.
+func (p *Poller) Start() {
+	log.Ctx(p.ctx).Debug().Int("urls", len(p.sources)).Dur("interval", p.interval).Msg("polling schema URLs for changes")
+	go p.pollLoop()
+}
+
+// Stop stops polling. Like the timers of a file watcher, a reload in progress is not waited for:
+// it may be blocked on the server which is stopping.
+func (p *Poller) Stop() {
+	p.cancel()
+}
+
+func (p *Poller) pollLoop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.poll()
+		}
+	}
+}
+
+func (p *Poller) poll() {
+	var changed []string
+	for _, source := range p.sources {
+		_, ok, err := source.Fetch(p.ctx)
+		if err != nil {
+			if p.ctx.Err() == nil {
+				log.Ctx(p.ctx).Warn().Err(err).Str("url", source.URL()).Msg("failed to poll schema URL")
+			}
+			continue
+		}
+		if ok {
+			changed = append(changed, source.URL())
+		}
+	}
+	if len(changed) == 0 || p.ctx.Err() != nil {
+		return
+	}
+
+	log.Ctx(p.ctx).Info().Strs("urls", changed).Msg("schema URLs changed, reloading")
+	if err := p.reloadFunc(changed); err != nil {
+		log.Ctx(p.ctx).Error().Err(err).Msg("failed to reload schema")
+	}
+}
@@ -0,0 +1,247 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/authzed/spicedb/pkg/schemadsl/compiler"
+	"github.com/authzed/spicedb/pkg/schemadsl/input"
+
+	"github.com/akoserwal/embedspicedb/internal/httpsource"
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+	"github.com/akoserwal/embedspicedb/internal/schemafiles"
+)
+
+// schemaSource is the schema text read from one of the configured schema files.
+type schemaSource struct {
+	// file is the file containing the schema text. For YAML files referencing a schema file,
+	// this is the referenced file.
+	file string
+
+	// text is the schema text.
+	text string
+
+	// firstLine is the 1-based line of file on which text starts.
+	firstLine int
+
+	// rendered is true if text was rendered from a template in file.
+	rendered bool
+}
+
+// SchemaError is a schema compilation or template error, located in the schema file it originates from.
+type SchemaError struct {
+	// File is the schema file containing the error.
+	File string
+
+	// Line is the 1-based line of the error within File.
+	Line int
+
+	// Column is the 1-based column of the error within the schema text. For schemas embedded in
+	// YAML files, this does not include the indentation of the YAML block.
+	Column int
+
+	// Message describes the error.
+	Message string
+
+	// Source is the schema source code the error refers to, if known.
+	Source string
+
+	// Rendered is the schema text rendered from the template in File, if templating is enabled and
+	// the error occurred after rendering. Where the template adds or removes lines, Line counts the
+	// lines of Rendered rather than those of File.
+	Rendered string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// ValidateSchemaFiles reads and compiles the schema files matched by the given files, directories and
+// patterns, without writing the schema.
+// Compilation errors are returned as a *SchemaError.
+func ValidateSchemaFiles(ctx context.Context, entries []string) error {
+	return ValidateSchemaFS(ctx, nil, entries)
+}
+
+// ValidateSchemaFS is like ValidateSchemaFiles, but reads the schema files from fsys.
+// A nil fsys is the operating system's file system.
+func ValidateSchemaFS(ctx context.Context, fsys fs.FS, entries []string) error {
+	return ValidateSchemaSources(ctx, fsys, entries, nil, nil)
+}
+
+// ValidateSchemaSources is like ValidateSchemaFS, but also fetches the schemas served at the given
+// URL sources, which are combined after the schema files. If vars is not nil, the local schema
+// files are rendered as templates first, like WithTemplateVars; the URL sources are not.
+func ValidateSchemaSources(ctx context.Context, fsys fs.FS, entries []string, urls []*httpsource.Source, vars map[string]any) error {
+	if len(entries) == 0 && len(urls) == 0 {
+		return fmt.Errorf("no schema files configured")
+	}
+
+	var files []string
+	if len(entries) > 0 {
+		var err error
+		files, err = resolveSchemaFiles(fsys, entries)
+		if err != nil {
+			return err
+		}
+	}
+
+	sources, _, err := readSchemaSources(fsys, files)
+	if err != nil {
+		return err
+	}
+	if err := renderSchemaSources(ctx, sources, vars); err != nil {
+		return err
+	}
+	urlSources, err := readURLSources(ctx, urls)
+	if err != nil {
+		return err
+	}
+	sources = append(sources, urlSources...)
+	if err := mergeDefinitions(sources); err != nil {
+		return err
+	}
+	if combineSchemaSources(sources) == "" {
+		return fmt.Errorf("no schema content found in files")
+	}
+
+	if err := compileSchemaSources(sources); err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Debug().Int("files", len(files)).Int("urls", len(urls)).Msg("schema is valid")
+	return nil
+}
+
+// ValidateSchema reads and compiles the configured schema files, without writing the schema.
+// Compilation errors are returned as a *SchemaError.
+func (r *SchemaReloader) ValidateSchema(ctx context.Context) error {
+	return ValidateSchemaSources(ctx, r.fsys, r.Files(), r.urls, r.templateVars)
+}
+
+// resolveSchemaFiles expands directory and pattern entries into the schema files they match.
+func resolveSchemaFiles(fsys fs.FS, entries []string) ([]string, error) {
+	files, err := schemafiles.ResolveFS(fsys, entries)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no schema files match %s", strings.Join(entries, ", "))
+	}
+	return files, nil
+}
+
+// readSchemaSources reads the schema text of each file, returning the other files read along the
+// way. A schema file which is also referenced by a validation file, e.g. because both are in a
+// configured directory, is only included once, through the validation file. Files imported by a
+// schema are included ahead of it, once.
+func readSchemaSources(fsys fs.FS, files []string) ([]schemaSource, []string, error) {
+	sources := make([]schemaSource, 0, len(files))
+	var deps []string
+	for _, filePath := range files {
+		source, err := readSchemaSource(fsys, filePath, &deps)
+		if err != nil {
+			return nil, deps, fmt.Errorf("failed to read schema file %s: %w", filePath, err)
+		}
+		sources = append(sources, source)
+	}
+
+	if len(deps) > 0 {
+		referenced := make(map[string]struct{}, len(deps))
+		for _, dep := range deps {
+			referenced[canonicalPath(fsys, dep)] = struct{}{}
+		}
+		included := sources[:0]
+		for i, source := range sources {
+			if _, ok := referenced[canonicalPath(fsys, files[i])]; ok && source.file == files[i] {
+				continue
+			}
+			included = append(included, source)
+		}
+		sources = included
+	}
+
+	return resolveImports(fsys, sources, deps)
+}
+
+// canonicalPath returns the absolute form of name, or name itself if it cannot be determined.
+// Paths within an fs.FS are already canonical once cleaned.
+func canonicalPath(fsys fs.FS, name string) string {
+	if fsys != nil {
+		return path.Clean(name)
+	}
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
+
+// readFile reads the named file from fsys, or from the operating system's file system if fsys is nil.
+func readFile(fsys fs.FS, name string) ([]byte, error) {
+	if fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(fsys, name)
+}
+
+// combineSchemaSources joins the schema texts into the schema written to SpiceDB. Imports must have
+// been resolved and definitions merged, so that each definition is declared once.
+func combineSchemaSources(sources []schemaSource) string {
+	parts := make([]string, 0, len(sources))
+	for _, source := range sources {
+		parts = append(parts, source.text)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// compileSchemaSources compiles the combined schema, mapping any error back to the schema file
+// and line it originates from.
+func compileSchemaSources(sources []schemaSource) error {
+	_, err := compiler.Compile(compiler.InputSchema{
+		Source:       input.Source("schema"),
+		SchemaString: combineSchemaSources(sources),
+	}, compiler.AllowUnprefixedObjectType())
+	if err == nil {
+		return nil
+	}
+
+	var contextErr compiler.WithContextError
+	if !errors.As(err, &contextErr) {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	line, column, lerr := contextErr.SourceRange.Start().LineAndColumn()
+	if lerr != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	schemaErr := &SchemaError{
+		Line:    line + 1, // 0-indexed in the parser
+		Column:  column + 1,
+		Message: contextErr.BaseMessage,
+		Source:  contextErr.ErrorSourceCode,
+	}
+
+	// Sources are joined by a blank line, so each starts two lines after the previous one ends.
+	start := 0
+	for _, source := range sources {
+		end := start + strings.Count(source.text, "\n")
+		if line >= start && line <= end {
+			schemaErr.File = source.file
+			schemaErr.Line = line - start + source.firstLine
+			if source.rendered {
+				schemaErr.Rendered = source.text
+			}
+			break
+		}
+		start = end + 2
+	}
+
+	return schemaErr
+}
@@ -0,0 +1,363 @@
+package schema
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// importPattern matches the import statements of composable schemas: `import "path/to/file.zed"`,
+// on a line of its own. It is matched against the text with its comments blanked out, so imports
+// which are commented out are ignored.
+var importPattern = regexp.MustCompile(`(?m)^[ \t]*import[ \t]+"([^"\n]*)"[ \t]*\r?$`)
+
+// schemaImport is an import statement of a schema source.
+type schemaImport struct {
+	// path is the imported file, relative to the importing file.
+	path string
+
+	// line is the 0-based line of the statement within the schema text.
+	line int
+}
+
+// stripImports returns text with its import statements blanked out, keeping the lines of the
+// remaining text where they are, along with the statements.
+func stripImports(text string) (string, []schemaImport) {
+	// Blanking comments keeps every other byte at its offset, so matches locate the text as well
+	uncommented := blankComments(text)
+	matches := importPattern.FindAllStringSubmatchIndex(uncommented, -1)
+	if len(matches) == 0 {
+		return text, nil
+	}
+
+	imports := make([]schemaImport, 0, len(matches))
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		imports = append(imports, schemaImport{
+			path: uncommented[m[2]:m[3]],
+			line: strings.Count(text[:m[0]], "\n"),
+		})
+		b.WriteString(text[last:m[0]])
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String(), imports
+}
+
+// resolveRelative returns the path of ref, relative to the directory of the file from. Within an
+// fs.FS, paths are slash-separated.
+func resolveRelative(fsys fs.FS, from, ref string) string {
+	if fsys != nil {
+		return path.Join(path.Dir(from), filepath.ToSlash(ref))
+	}
+	return filepath.Join(filepath.Dir(from), ref)
+}
+
+// importResolver inlines the files imported by schema sources, ahead of the sources importing them.
+type importResolver struct {
+	fsys     fs.FS
+	deps     []string
+	included map[string]struct{}
+	stack    []string // canonical paths of the files being resolved
+	sources  []schemaSource
+}
+
+// resolveImports returns the sources with the files they import, directly or indirectly, inserted
+// ahead of them. Each file is included once, however many files import it or whether it is also
+// configured itself. Imported files are appended to deps.
+func resolveImports(fsys fs.FS, sources []schemaSource, deps []string) ([]schemaSource, []string, error) {
+	ir := &importResolver{
+		fsys:     fsys,
+		deps:     deps,
+		included: make(map[string]struct{}, len(sources)),
+		sources:  make([]schemaSource, 0, len(sources)),
+	}
+	for _, source := range sources {
+		if err := ir.add(source); err != nil {
+			return nil, ir.deps, err
+		}
+	}
+	return ir.sources, ir.deps, nil
+}
+
+func (ir *importResolver) add(source schemaSource) error {
+	key := canonicalPath(ir.fsys, source.file)
+	if _, ok := ir.included[key]; ok {
+		return nil
+	}
+
+	text, imports := stripImports(source.text)
+	ir.stack = append(ir.stack, key)
+	for _, imp := range imports {
+		importErr := func(format string, args ...any) *SchemaError {
+			return &SchemaError{
+				File:    source.file,
+				Line:    source.firstLine + imp.line,
+				Column:  1,
+				Message: fmt.Sprintf(format, args...),
+				Source:  strings.Split(source.text, "\n")[imp.line],
+			}
+		}
+
+		if !filepath.IsLocal(imp.path) {
+			return importErr("import %q is not local to the importing file", imp.path)
+		}
+		importPath := resolveRelative(ir.fsys, source.file, imp.path)
+		ir.deps = append(ir.deps, importPath)
+
+		if i := slices.Index(ir.stack, canonicalPath(ir.fsys, importPath)); i >= 0 {
+			cycle := append(slices.Clone(ir.stack[i:]), ir.stack[i])
+			return importErr("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+
+		content, err := readFile(ir.fsys, importPath)
+		if err != nil {
+			return importErr("failed to import %s: %v", importPath, err)
+		}
+		if err := ir.add(schemaSource{file: importPath, text: string(content), firstLine: 1}); err != nil {
+			return err
+		}
+	}
+	ir.stack = ir.stack[:len(ir.stack)-1]
+
+	ir.included[key] = struct{}{}
+	source.text = text
+	ir.sources = append(ir.sources, source)
+	return nil
+}
+
+// schemaBlock is a top-level definition or caveat of a schema text.
+type schemaBlock struct {
+	// kind is "definition" or "caveat".
+	kind string
+
+	// name is the name of the definition or caveat, including its prefix.
+	name string
+
+	// start and end are the byte offsets of the block within the text, including the comments
+	// directly preceding it.
+	start, end int
+
+	// keyword is the byte offset of the definition or caveat keyword.
+	keyword int
+
+	// body is the block without comments, with its whitespace collapsed, for comparison.
+	body string
+}
+
+// scanBlocks returns the top-level definitions and caveats of a schema text. It only tracks comments,
+// strings and braces, leaving the validation of the schema to the compiler.
+func scanBlocks(text string) []schemaBlock {
+	stripped := []byte(text) // text with its comments blanked out
+	var blocks []schemaBlock
+	var current *schemaBlock
+	depth := 0
+	leadStart := -1 // start of the comments preceding the current position, if any
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		if end, ok := commentEnd(text, i); ok {
+			blank(stripped, i, end)
+			if leadStart < 0 && depth == 0 && current == nil {
+				leadStart = i
+			}
+			i = end
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\'':
+			i = stringEnd(text, i)
+			leadStart = -1
+			continue
+
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+			continue
+
+		case c == '{':
+			depth++
+
+		case c == '}':
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 && current != nil {
+				current.end = i + 1
+				current.body = strings.Join(strings.Fields(string(stripped[current.keyword:current.end])), " ")
+				blocks = append(blocks, *current)
+				current = nil
+			}
+
+		case depth == 0 && current == nil && isIdentByte(c):
+			word := readIdent(text, i)
+			if word == "definition" || word == "caveat" {
+				j := i + len(word)
+				for j < len(text) && (text[j] == ' ' || text[j] == '\t') {
+					j++
+				}
+				start := i
+				if leadStart >= 0 {
+					start = leadStart
+				}
+				current = &schemaBlock{kind: word, name: readIdent(text, j), start: start, keyword: i}
+			}
+			leadStart = -1
+			i += len(word)
+			continue
+		}
+
+		leadStart = -1
+		i++
+	}
+	return blocks
+}
+
+// blankComments returns text with its comments replaced by spaces, keeping line breaks, so every
+// other byte stays at its offset.
+func blankComments(text string) string {
+	blanked := []byte(text)
+	for i := 0; i < len(text); {
+		if end, ok := commentEnd(text, i); ok {
+			blank(blanked, i, end)
+			i = end
+			continue
+		}
+		if text[i] == '"' || text[i] == '\'' {
+			i = stringEnd(text, i)
+			continue
+		}
+		i++
+	}
+	return string(blanked)
+}
+
+// commentEnd returns the offset just past the comment starting at offset i of text, if one does.
+// Line comments end before their line break; unterminated block comments at the end of text.
+func commentEnd(text string, i int) (int, bool) {
+	switch {
+	case strings.HasPrefix(text[i:], "//"):
+		if n := strings.IndexByte(text[i:], '\n'); n >= 0 {
+			return i + n, true
+		}
+		return len(text), true
+	case strings.HasPrefix(text[i:], "/*"):
+		if n := strings.Index(text[i+2:], "*/"); n >= 0 {
+			return i + 2 + n + 2, true
+		}
+		return len(text), true
+	}
+	return 0, false
+}
+
+// stringEnd returns the offset just past the string literal starting at offset i of text, which ends
+// at its closing quote or, if it has none, at the end of its line.
+func stringEnd(text string, i int) int {
+	quote := text[i]
+	j := i + 1
+	for j < len(text) && text[j] != quote && text[j] != '\n' {
+		if text[j] == '\\' {
+			j++
+		}
+		j++
+	}
+	return min(j+1, len(text))
+}
+
+// blank replaces the bytes of b between start and end, except line breaks, by spaces.
+func blank(b []byte, start, end int) {
+	for j := start; j < end; j++ {
+		if b[j] != '\n' {
+			b[j] = ' '
+		}
+	}
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '/' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func readIdent(text string, start int) string {
+	end := start
+	for end < len(text) && isIdentByte(text[end]) {
+		end++
+	}
+	return text[start:end]
+}
+
+// declaration is where a definition or caveat was first declared.
+type declaration struct {
+	body string
+	file string
+	line int
+}
+
+// mergeDefinitions removes definitions and caveats declared again, identically, by a later source,
+// e.g. because two files share a definition both of them reference. Declarations which differ from
+// the first declaration of the same kind in another file are returned as a *SchemaError.
+// Declarations repeated within a file, and definitions sharing the name of a caveat, are left to the
+// compiler to report.
+func mergeDefinitions(sources []schemaSource) error {
+	declared := make(map[string]declaration) // by kind and name
+	for i, source := range sources {
+		var duplicates []schemaBlock
+		for _, block := range scanBlocks(source.text) {
+			if block.name == "" {
+				continue
+			}
+			line := source.firstLine + strings.Count(source.text[:block.keyword], "\n")
+
+			key := block.kind + " " + block.name
+			first, ok := declared[key]
+			if !ok {
+				declared[key] = declaration{body: block.body, file: source.file, line: line}
+				continue
+			}
+			if first.file == source.file {
+				continue
+			}
+			if first.body == block.body {
+				duplicates = append(duplicates, block)
+				continue
+			}
+
+			lineStart := strings.LastIndexByte(source.text[:block.keyword], '\n') + 1
+			lineEnd := strings.IndexByte(source.text[block.keyword:], '\n')
+			if lineEnd < 0 {
+				lineEnd = len(source.text) - block.keyword
+			}
+			return &SchemaError{
+				File:    source.file,
+				Line:    line,
+				Column:  block.keyword - lineStart + 1,
+				Message: fmt.Sprintf("%s %s conflicts with the one declared at %s:%d", block.kind, block.name, first.file, first.line),
+				Source:  source.text[lineStart : block.keyword+lineEnd],
+			}
+		}
+		sources[i].text = removeBlocks(source.text, duplicates)
+	}
+	return nil
+}
+
+// removeBlocks removes the given blocks from text, keeping their line breaks so that the lines of the
+// remaining text stay where they are.
+func removeBlocks(text string, blocks []schemaBlock) string {
+	if len(blocks) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, block := range blocks {
+		b.WriteString(text[last:block.start])
+		b.WriteString(strings.Repeat("\n", strings.Count(text[block.start:block.end], "\n")))
+		last = block.end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
@@ -0,0 +1,463 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	core "github.com/authzed/spicedb/pkg/proto/core/v1"
+	implv1 "github.com/authzed/spicedb/pkg/proto/impl/v1"
+	"github.com/authzed/spicedb/pkg/schemadsl/compiler"
+	"github.com/authzed/spicedb/pkg/schemadsl/input"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// DestructiveChangePolicy controls what a reload does when the new schema removes definitions,
+// relations, permissions or caveats, narrows the subject types allowed on a relation, or removes or
+// retypes caveat parameters.
+type DestructiveChangePolicy string
+
+const (
+	// DestructiveChangesAllow writes destructive changes without comment.
+	DestructiveChangesAllow DestructiveChangePolicy = "allow"
+
+	// DestructiveChangesWarn writes destructive changes and logs each of them. This is the default.
+	DestructiveChangesWarn DestructiveChangePolicy = "warn"
+
+	// DestructiveChangesBlock refuses to write a schema containing destructive changes; the reload
+	// fails with a *DestructiveChangeError and the stored schema is left untouched.
+	DestructiveChangesBlock DestructiveChangePolicy = "block"
+)
+
+// Valid returns an error if the policy is not one of the known policies.
+func (p DestructiveChangePolicy) Valid() error {
+	switch p {
+	case "", DestructiveChangesAllow, DestructiveChangesWarn, DestructiveChangesBlock:
+		return nil
+	default:
+		return fmt.Errorf("unknown destructive change policy %q (supported: %s, %s, %s)",
+			p, DestructiveChangesAllow, DestructiveChangesWarn, DestructiveChangesBlock)
+	}
+}
+
+// SchemaChangeKind describes how a schema element changed.
+type SchemaChangeKind string
+
+const (
+	SchemaChangeAdded   SchemaChangeKind = "added"
+	SchemaChangeRemoved SchemaChangeKind = "removed"
+	SchemaChangeChanged SchemaChangeKind = "changed"
+)
+
+// SchemaElement is the kind of schema element which changed.
+type SchemaElement string
+
+const (
+	SchemaElementDefinition SchemaElement = "definition"
+	SchemaElementRelation   SchemaElement = "relation"
+	SchemaElementPermission SchemaElement = "permission"
+	SchemaElementCaveat     SchemaElement = "caveat"
+)
+
+// SchemaChange is a single difference between the stored schema and the new schema.
+type SchemaChange struct {
+	Kind    SchemaChangeKind `json:"kind"`
+	Element SchemaElement    `json:"element"`
+
+	// Definition is the name of the definition or caveat which changed, or which contains the
+	// relation or permission which changed.
+	Definition string `json:"definition"`
+
+	// Name is the name of the relation or permission which changed. Empty for definitions and caveats.
+	Name string `json:"name,omitempty"`
+
+	// Detail describes what changed, for changed elements.
+	Detail string `json:"detail,omitempty"`
+
+	// Destructive is true if the change removes something which relationships or clients may
+	// depend on.
+	Destructive bool `json:"destructive"`
+}
+
+func (c SchemaChange) String() string {
+	target := c.Definition
+	if c.Name != "" {
+		target += "#" + c.Name
+	}
+
+	s := fmt.Sprintf("%s %s %s", c.Kind, c.Element, target)
+	if c.Detail != "" {
+		s += ": " + c.Detail
+	}
+	return s
+}
+
+// SchemaDiff lists the differences between the stored schema and a new schema, ordered by
+// definition name.
+type SchemaDiff struct {
+	Changes []SchemaChange `json:"changes"`
+}
+
+// IsEmpty returns true if the schemas define the same elements.
+func (d *SchemaDiff) IsEmpty() bool {
+	return len(d.Changes) == 0
+}
+
+// Destructive returns the destructive changes.
+func (d *SchemaDiff) Destructive() []SchemaChange {
+	var destructive []SchemaChange
+	for _, change := range d.Changes {
+		if change.Destructive {
+			destructive = append(destructive, change)
+		}
+	}
+	return destructive
+}
+
+// DestructiveChangeError is returned by reloads blocked by DestructiveChangesBlock.
+type DestructiveChangeError struct {
+	Diff *SchemaDiff
+}
+
+func (e *DestructiveChangeError) Error() string {
+	destructive := e.Diff.Destructive()
+	descriptions := make([]string, 0, len(destructive))
+	for _, change := range destructive {
+		descriptions = append(descriptions, change.String())
+	}
+	return fmt.Sprintf("schema contains %d destructive changes: %s", len(destructive), strings.Join(descriptions, "; "))
+}
+
+// diffAgainstStored compares the new schema with the schema currently stored in SpiceDB.
+func (r *SchemaReloader) diffAgainstStored(ctx context.Context, newSchema string) (*SchemaDiff, error) {
+	var storedSchema string
+	resp, err := r.schemaClient.ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	switch {
+	case err == nil:
+		storedSchema = resp.SchemaText
+	case grpcstatus.Code(err) == codes.NotFound:
+		// No schema has been written yet.
+	default:
+		return nil, fmt.Errorf("failed to read current schema: %w", err)
+	}
+
+	stored, err := compileForDiff(storedSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile current schema: %w", err)
+	}
+	updated, err := compileForDiff(newSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffSchemas(stored, updated), nil
+}
+
+func compileForDiff(schemaText string) (*compiler.CompiledSchema, error) {
+	if strings.TrimSpace(schemaText) == "" {
+		return &compiler.CompiledSchema{}, nil
+	}
+	return compiler.Compile(compiler.InputSchema{
+		Source:       input.Source("schema"),
+		SchemaString: schemaText,
+	}, compiler.AllowUnprefixedObjectType())
+}
+
+// applyDestructiveChangePolicy blocks or reports the destructive changes in diff, returning a
+// warning for each destructive change which may be written.
+func (r *SchemaReloader) applyDestructiveChangePolicy(ctx context.Context, diff *SchemaDiff) ([]string, error) {
+	destructive := diff.Destructive()
+	if len(destructive) == 0 {
+		return nil, nil
+	}
+
+	switch r.destructivePolicy {
+	case DestructiveChangesAllow:
+		return nil, nil
+
+	case DestructiveChangesBlock:
+		return nil, &DestructiveChangeError{Diff: diff}
+
+	default:
+		warnings := make([]string, 0, len(destructive))
+		for _, change := range destructive {
+			log.Ctx(ctx).Warn().Str("change", change.String()).Msg("schema reload contains destructive change")
+			warnings = append(warnings, "destructive change: "+change.String())
+		}
+		return warnings, nil
+	}
+}
+
+// diffSchemas returns the differences between two compiled schemas.
+func diffSchemas(stored, updated *compiler.CompiledSchema) *SchemaDiff {
+	diff := &SchemaDiff{}
+
+	storedDefs := definitionsByName(stored.ObjectDefinitions)
+	updatedDefs := definitionsByName(updated.ObjectDefinitions)
+	for _, name := range unionOfKeys(storedDefs, updatedDefs) {
+		before, inStored := storedDefs[name]
+		after, inUpdated := updatedDefs[name]
+		switch {
+		case !inStored:
+			diff.Changes = append(diff.Changes, SchemaChange{Kind: SchemaChangeAdded, Element: SchemaElementDefinition, Definition: name})
+		case !inUpdated:
+			diff.Changes = append(diff.Changes, SchemaChange{Kind: SchemaChangeRemoved, Element: SchemaElementDefinition, Definition: name, Destructive: true})
+		default:
+			diff.Changes = append(diff.Changes, diffRelations(name, before, after)...)
+		}
+	}
+
+	storedCaveats := caveatsByName(stored.CaveatDefinitions)
+	updatedCaveats := caveatsByName(updated.CaveatDefinitions)
+	for _, name := range unionOfKeys(storedCaveats, updatedCaveats) {
+		before, inStored := storedCaveats[name]
+		after, inUpdated := updatedCaveats[name]
+		switch {
+		case !inStored:
+			diff.Changes = append(diff.Changes, SchemaChange{Kind: SchemaChangeAdded, Element: SchemaElementCaveat, Definition: name})
+		case !inUpdated:
+			diff.Changes = append(diff.Changes, SchemaChange{Kind: SchemaChangeRemoved, Element: SchemaElementCaveat, Definition: name, Destructive: true})
+		default:
+			if change, ok := diffCaveats(before, after); ok {
+				diff.Changes = append(diff.Changes, change)
+			}
+		}
+	}
+
+	return diff
+}
+
+func diffRelations(definition string, before, after *core.NamespaceDefinition) []SchemaChange {
+	storedRels := relationsByName(before.Relation)
+	updatedRels := relationsByName(after.Relation)
+
+	var changes []SchemaChange
+	for _, name := range unionOfKeys(storedRels, updatedRels) {
+		storedRel, inStored := storedRels[name]
+		updatedRel, inUpdated := updatedRels[name]
+		switch {
+		case !inStored:
+			changes = append(changes, SchemaChange{Kind: SchemaChangeAdded, Element: relationElement(updatedRel), Definition: definition, Name: name})
+		case !inUpdated:
+			changes = append(changes, SchemaChange{Kind: SchemaChangeRemoved, Element: relationElement(storedRel), Definition: definition, Name: name, Destructive: true})
+		case relationElement(storedRel) != relationElement(updatedRel):
+			changes = append(changes, SchemaChange{
+				Kind:        SchemaChangeChanged,
+				Element:     relationElement(updatedRel),
+				Definition:  definition,
+				Name:        name,
+				Detail:      fmt.Sprintf("%s became a %s", relationElement(storedRel), relationElement(updatedRel)),
+				Destructive: relationElement(storedRel) == SchemaElementRelation,
+			})
+		case relationElement(updatedRel) == SchemaElementRelation:
+			if change, ok := diffAllowedTypes(definition, storedRel, updatedRel); ok {
+				changes = append(changes, change)
+			}
+		case !proto.Equal(withoutSourceInfo(storedRel.UsersetRewrite), withoutSourceInfo(updatedRel.UsersetRewrite)):
+			// A permission computed differently changes check results, but no stored relationship
+			changes = append(changes, SchemaChange{
+				Kind:       SchemaChangeChanged,
+				Element:    SchemaElementPermission,
+				Definition: definition,
+				Name:       name,
+				Detail:     "changed expression",
+			})
+		}
+	}
+	return changes
+}
+
+// diffAllowedTypes compares the subject types allowed on a relation. Removing an allowed type is
+// destructive, as relationships of that type can no longer be written or may be rejected.
+func diffAllowedTypes(definition string, before, after *core.Relation) (SchemaChange, bool) {
+	storedTypes := allowedTypes(before)
+	updatedTypes := allowedTypes(after)
+
+	var added, removed []string
+	for _, t := range unionOfKeys(storedTypes, updatedTypes) {
+		_, inStored := storedTypes[t]
+		_, inUpdated := updatedTypes[t]
+		switch {
+		case !inStored:
+			added = append(added, t)
+		case !inUpdated:
+			removed = append(removed, t)
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return SchemaChange{}, false
+	}
+
+	var details []string
+	if len(added) > 0 {
+		details = append(details, "added allowed types "+strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		details = append(details, "removed allowed types "+strings.Join(removed, ", "))
+	}
+
+	return SchemaChange{
+		Kind:        SchemaChangeChanged,
+		Element:     SchemaElementRelation,
+		Definition:  definition,
+		Name:        after.Name,
+		Detail:      strings.Join(details, "; "),
+		Destructive: len(removed) > 0,
+	}, true
+}
+
+// diffCaveats compares the parameters and expression of a caveat. Removing a parameter or changing
+// its type is destructive, as the caveat contexts of stored relationships may no longer evaluate.
+func diffCaveats(before, after *core.CaveatDefinition) (SchemaChange, bool) {
+	var details []string
+	destructive := false
+	for _, name := range unionOfKeys(before.ParameterTypes, after.ParameterTypes) {
+		storedType, inStored := before.ParameterTypes[name]
+		updatedType, inUpdated := after.ParameterTypes[name]
+		switch {
+		case !inStored:
+			details = append(details, "added parameter "+name)
+		case !inUpdated:
+			details = append(details, "removed parameter "+name)
+			destructive = true
+		case !proto.Equal(storedType, updatedType):
+			details = append(details, "changed type of parameter "+name)
+			destructive = true
+		}
+	}
+	if !caveatExpressionsEqual(before, after) {
+		details = append(details, "changed expression")
+	}
+	if len(details) == 0 {
+		return SchemaChange{}, false
+	}
+
+	return SchemaChange{
+		Kind:        SchemaChangeChanged,
+		Element:     SchemaElementCaveat,
+		Definition:  after.Name,
+		Detail:      strings.Join(details, "; "),
+		Destructive: destructive,
+	}, true
+}
+
+// caveatExpressionsEqual compares the compiled expressions of two caveats, ignoring where in the
+// schema they were written.
+func caveatExpressionsEqual(before, after *core.CaveatDefinition) bool {
+	var storedExpr, updatedExpr implv1.DecodedCaveat
+	if proto.Unmarshal(before.SerializedExpression, &storedExpr) != nil || proto.Unmarshal(after.SerializedExpression, &updatedExpr) != nil {
+		return bytes.Equal(before.SerializedExpression, after.SerializedExpression)
+	}
+	return proto.Equal(withoutSourceInfo(&storedExpr), withoutSourceInfo(&updatedExpr))
+}
+
+// withoutSourceInfo returns a copy of m without the source positions the compiler records, so
+// elements which only moved within the schema compare equal.
+func withoutSourceInfo[M proto.Message](m M) M {
+	clone := proto.Clone(m).(M)
+	clearSourceInfo(clone.ProtoReflect())
+	return clone
+}
+
+func clearSourceInfo(m protoreflect.Message) {
+	if !m.IsValid() {
+		return
+	}
+	var sourceFields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Name() == "source_position" || fd.Name() == "source_info":
+			sourceFields = append(sourceFields, fd)
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				clearSourceInfo(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
+				clearSourceInfo(value.Message())
+				return true
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			clearSourceInfo(v.Message())
+		}
+		return true
+	})
+	for _, fd := range sourceFields {
+		m.Clear(fd)
+	}
+}
+
+func relationElement(rel *core.Relation) SchemaElement {
+	if rel.UsersetRewrite != nil {
+		return SchemaElementPermission
+	}
+	return SchemaElementRelation
+}
+
+func allowedTypes(rel *core.Relation) map[string]struct{} {
+	types := make(map[string]struct{})
+	for _, allowed := range rel.GetTypeInformation().GetAllowedDirectRelations() {
+		t := allowed.Namespace
+		switch {
+		case allowed.GetPublicWildcard() != nil:
+			t += ":*"
+		case allowed.GetRelation() != "" && allowed.GetRelation() != tuple.Ellipsis:
+			t += "#" + allowed.GetRelation()
+		}
+		if allowed.RequiredCaveat != nil {
+			t += " with " + allowed.RequiredCaveat.CaveatName
+		}
+		if allowed.RequiredExpiration != nil {
+			t += " with expiration"
+		}
+		types[t] = struct{}{}
+	}
+	return types
+}
+
+func definitionsByName(defs []*core.NamespaceDefinition) map[string]*core.NamespaceDefinition {
+	byName := make(map[string]*core.NamespaceDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+	return byName
+}
+
+func caveatsByName(caveats []*core.CaveatDefinition) map[string]*core.CaveatDefinition {
+	byName := make(map[string]*core.CaveatDefinition, len(caveats))
+	for _, caveat := range caveats {
+		byName[caveat.Name] = caveat
+	}
+	return byName
+}
+
+func relationsByName(rels []*core.Relation) map[string]*core.Relation {
+	byName := make(map[string]*core.Relation, len(rels))
+	for _, rel := range rels {
+		byName[rel.Name] = rel
+	}
+	return byName
+}
+
+// unionOfKeys returns the keys present in either map, sorted.
+func unionOfKeys[V1, V2 any](a map[string]V1, b map[string]V2) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/spicedb/pkg/schemadsl/compiler"
+	"github.com/authzed/spicedb/pkg/schemadsl/input"
+	"github.com/authzed/spicedb/pkg/tuple"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// SeedPolicy controls how relationships declared in YAML validation files are applied
+// to the datastore after the schema has been written.
+type SeedPolicy string
+
+const (
+	// SeedPolicyNone disables relationship seeding; only the schema is loaded.
+	SeedPolicyNone SeedPolicy = ""
+
+	// SeedPolicyTouch touches every declared relationship, merging them with the relationships
+	// already stored. Relationships removed from the files are left in place.
+	SeedPolicyTouch SeedPolicy = "touch"
+
+	// SeedPolicyReplace makes the stored relationships match the declared relationships exactly:
+	// relationships which are not declared in any file are deleted. The deletes and touches are
+	// written in a single request, atomically, unless there are more than maxUpdatesPerWrite of
+	// them; larger replaces are written in batches, and a failed batch leaves the batches before it
+	// applied.
+	SeedPolicyReplace SeedPolicy = "replace"
+)
+
+// maxUpdatesPerWrite matches SpiceDB's default limit on the number of updates in a single
+// WriteRelationships request.
+const maxUpdatesPerWrite = 1000
+
+// Valid returns an error if the policy is not one of the known policies.
+func (p SeedPolicy) Valid() error {
+	switch p {
+	case SeedPolicyNone, SeedPolicyTouch, SeedPolicyReplace:
+		return nil
+	default:
+		return fmt.Errorf("unknown seed policy %q (supported: %s, %s)", p, SeedPolicyTouch, SeedPolicyReplace)
+	}
+}
+
+// seedRelationshipsFrom returns the relationships declared in the `relationships:` block of the
+// validation files.
+func seedRelationshipsFrom(files []decodedFile) []tuple.Relationship {
+	var relationships []tuple.Relationship
+	for _, df := range files {
+		relationships = append(relationships, df.file.Relationships.Relationships...)
+	}
+	return relationships
+}
+
+// seedRelationships applies the declared relationships according to the reloader's seed policy.
+// The updates are written in a single request if they fit in one, and in batches otherwise.
+func (r *SchemaReloader) seedRelationships(ctx context.Context, schemaText string, relationships []tuple.Relationship) error {
+	var updates []*v1.RelationshipUpdate
+
+	if r.seedPolicy == SeedPolicyReplace {
+		stale, err := r.undeclaredRelationships(ctx, schemaText, relationships)
+		if err != nil {
+			return err
+		}
+		for _, rel := range stale {
+			updates = append(updates, &v1.RelationshipUpdate{
+				Operation:    v1.RelationshipUpdate_OPERATION_DELETE,
+				Relationship: rel,
+			})
+		}
+	}
+
+	// SpiceDB rejects requests which update the same relationship twice, so relationships declared
+	// in several files are only touched once.
+	touched := make(map[string]struct{}, len(relationships))
+	for _, rel := range relationships {
+		key := tuple.StringWithoutCaveatOrExpiration(rel)
+		if _, ok := touched[key]; ok {
+			continue
+		}
+		touched[key] = struct{}{}
+
+		updates = append(updates, &v1.RelationshipUpdate{
+			Operation:    v1.RelationshipUpdate_OPERATION_TOUCH,
+			Relationship: tuple.ToV1Relationship(rel),
+		})
+	}
+
+	// An empty write would still create a datastore revision, and a watch event, for no change
+	if len(updates) == 0 {
+		log.Ctx(ctx).Debug().Str("policy", string(r.seedPolicy)).Msg("no seed relationships to write")
+		return nil
+	}
+
+	if len(updates) <= maxUpdatesPerWrite {
+		if _, err := r.permissionsClient.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{
+			Updates: updates,
+		}); err != nil {
+			return fmt.Errorf("failed to write seed relationships: %w", err)
+		}
+	} else {
+		// Too many updates for one request: the batches are applied one by one, so a failure
+		// leaves the ones before it written.
+		log.Ctx(ctx).Warn().
+			Int("updates", len(updates)).
+			Int("batch_size", maxUpdatesPerWrite).
+			Msg("seed relationships exceed a single write; writing them in batches, which is not atomic")
+		for start := 0; start < len(updates); start += maxUpdatesPerWrite {
+			end := min(start+maxUpdatesPerWrite, len(updates))
+			resp, err := r.permissionsClient.WriteRelationships(ctx, &v1.WriteRelationshipsRequest{
+				Updates: updates[start:end],
+			})
+			if err != nil {
+				return fmt.Errorf("failed to write seed relationships %d-%d of %d (earlier batches were applied): %w", start+1, end, len(updates), err)
+			}
+			log.Ctx(ctx).Info().
+				Int("from", start+1).
+				Int("to", end).
+				Int("of", len(updates)).
+				Str("revision", resp.GetWrittenAt().GetToken()).
+				Msg("wrote seed relationship batch")
+		}
+	}
+
+	log.Ctx(ctx).Info().
+		Int("relationships", len(touched)).
+		Int("deleted", len(updates)-len(touched)).
+		Str("policy", string(r.seedPolicy)).
+		Msg("seeded relationships")
+	return nil
+}
+
+// undeclaredRelationships returns the stored relationships, across every definition in the
+// schema, which are not among the declared relationships.
+func (r *SchemaReloader) undeclaredRelationships(ctx context.Context, schemaText string, declared []tuple.Relationship) ([]*v1.Relationship, error) {
+	compiled, err := compiler.Compile(compiler.InputSchema{
+		Source:       input.Source("schema"),
+		SchemaString: schemaText,
+	}, compiler.AllowUnprefixedObjectType())
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema: %w", err)
+	}
+
+	keep := make(map[string]struct{}, len(declared))
+	for _, rel := range declared {
+		keep[tuple.StringWithoutCaveatOrExpiration(rel)] = struct{}{}
+	}
+
+	var stale []*v1.Relationship
+	for _, def := range compiled.ObjectDefinitions {
+		stream, err := r.permissionsClient.ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+			Consistency:        &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+			RelationshipFilter: &v1.RelationshipFilter{ResourceType: def.Name},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read relationships of %s: %w", def.Name, err)
+		}
+
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read relationships of %s: %w", def.Name, err)
+			}
+
+			if _, ok := keep[tuple.StringWithoutCaveatOrExpiration(tuple.FromV1Relationship(resp.Relationship))]; !ok {
+				stale = append(stale, resp.Relationship)
+			}
+		}
+	}
+	return stale, nil
+}
@@ -3,102 +3,345 @@ package schema
 import (
 	"context"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 	"github.com/authzed/spicedb/pkg/validationfile"
 	"google.golang.org/grpc"
 	"gopkg.in/yaml.v3"
 
+	"github.com/akoserwal/embedspicedb/internal/httpsource"
 	log "github.com/akoserwal/embedspicedb/internal/logging"
 )
 
 // SchemaReloader handles reloading schema files into SpiceDB.
 // NOTE: This lives in an internal package to keep the public surface area small.
 type SchemaReloader struct {
-	schemaClient v1.SchemaServiceClient
-	files        []string
+	schemaClient      v1.SchemaServiceClient
+	permissionsClient v1.PermissionsServiceClient
+	fsys              fs.FS
+	urls              []*httpsource.Source
+	templateVars      map[string]any
+	seedPolicy        SeedPolicy
+	destructivePolicy DestructiveChangePolicy
+
+	mu         sync.RWMutex
+	files      []string          // GUARDED_BY(mu)
+	lastReport *ValidationReport // GUARDED_BY(mu)
+}
+
+// ReloaderOption configures optional SchemaReloader behavior.
+type ReloaderOption func(*SchemaReloader)
+
+// WithRelationshipSeeding applies the relationships declared in YAML validation files after each
+// schema write, according to the given policy.
+func WithRelationshipSeeding(policy SeedPolicy) ReloaderOption {
+	return func(r *SchemaReloader) {
+		r.seedPolicy = policy
+	}
+}
+
+// WithDestructiveChangePolicy sets what a reload does when the new schema removes elements of the
+// stored schema. Defaults to DestructiveChangesWarn.
+func WithDestructiveChangePolicy(policy DestructiveChangePolicy) ReloaderOption {
+	return func(r *SchemaReloader) {
+		r.destructivePolicy = policy
+	}
+}
+
+// WithFS reads the schema files from fsys, such as an embed.FS, instead of the operating system's
+// file system. The schema files, and the files referenced by validation files, are then paths within
+// fsys.
+func WithFS(fsys fs.FS) ReloaderOption {
+	return func(r *SchemaReloader) {
+		r.fsys = fsys
+	}
+}
+
+// ReloadResult describes the outcome of a reload.
+type ReloadResult struct {
+	// Diff lists the differences between the previously stored schema and the reloaded schema.
+	// Nil if the reload failed before the schemas could be compared.
+	Diff *SchemaDiff
+
+	// Validation holds the results of the assertions and expected relations in the validation
+	// files. Nil if the files declare none or the schema was not written.
+	Validation *ValidationReport
+
+	// Schema is the combined schema text read from the schema files, as rendered if templating is
+	// enabled. Empty if the reload failed before all files were read.
+	Schema string
+
+	// Files are the schema files the schema was read from, followed by the schema URLs.
+	Files []string
+
+	// Dependencies are the other files the reload read, or tried to read, such as schema files
+	// referenced by the `schemaFile` key of validation files. Changes to them should trigger a reload.
+	Dependencies []string
+
+	// Revision is the ZedToken returned by WriteSchema. Empty if the schema was not written.
+	Revision string
+
+	// Warnings lists problems which did not fail the reload, such as destructive changes written
+	// under DestructiveChangesWarn or validation files whose assertions could not be evaluated.
+	Warnings []string
 }
 
 // NewSchemaReloader creates a new schema reloader.
-func NewSchemaReloader(conn *grpc.ClientConn, schemaFiles []string) *SchemaReloader {
-	return &SchemaReloader{
-		schemaClient: v1.NewSchemaServiceClient(conn),
-		files:        schemaFiles,
+func NewSchemaReloader(conn *grpc.ClientConn, schemaFiles []string, opts ...ReloaderOption) *SchemaReloader {
+	r := &SchemaReloader{
+		schemaClient:      v1.NewSchemaServiceClient(conn),
+		permissionsClient: v1.NewPermissionsServiceClient(conn),
+		files:             schemaFiles,
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
 }
 
 // Reload reads and reloads all schema files.
 func (r *SchemaReloader) Reload(ctx context.Context) error {
-	if len(r.files) == 0 {
-		return fmt.Errorf("no schema files configured")
-	}
+	_, err := r.ReloadWithResult(ctx)
+	return err
+}
 
-	// Read all schema files and combine them
-	var schemaParts []string
+// ReloadWithResult reads and reloads all schema files, returning the schema diff and assertion
+// results alongside any error. The result is never nil.
+func (r *SchemaReloader) ReloadWithResult(ctx context.Context) (*ReloadResult, error) {
+	result := &ReloadResult{}
+	entries := r.Files()
+	if len(entries) == 0 && len(r.urls) == 0 {
+		return result, fmt.Errorf("no schema files configured")
+	}
 
-	for _, filePath := range r.files {
-		content, err := ReadSchemaFile(filePath)
+	// Directories and patterns are re-resolved on every reload, so added and removed files are picked up
+	var files []string
+	if len(entries) > 0 {
+		var err error
+		files, err = resolveSchemaFiles(r.fsys, entries)
 		if err != nil {
-			return fmt.Errorf("failed to read schema file %s: %w", filePath, err)
+			return result, err
 		}
-		schemaParts = append(schemaParts, content)
+	}
+	result.Files = append(files[:len(files):len(files)], urlsOf(r.urls)...)
+
+	// Read all schema files and URLs, and compile them locally so errors point at the originating file
+	sources, deps, err := readSchemaSources(r.fsys, files)
+	result.Dependencies = deps
+	if err != nil {
+		return result, err
+	}
+	// Only local sources are templates: remote schemas are not trusted with the process environment
+	if err := renderSchemaSources(ctx, sources, r.templateVars); err != nil {
+		return result, err
+	}
+	urlSources, err := readURLSources(ctx, r.urls)
+	if err != nil {
+		return result, err
+	}
+	sources = append(sources, urlSources...)
+	if err := mergeDefinitions(sources); err != nil {
+		return result, err
 	}
 
-	combinedSchema := strings.Join(schemaParts, "\n\n")
+	combinedSchema := combineSchemaSources(sources)
 	if combinedSchema == "" {
-		return fmt.Errorf("no schema content found in files")
+		return result, fmt.Errorf("no schema content found in files")
+	}
+	result.Schema = combinedSchema
+
+	if err := compileSchemaSources(sources); err != nil {
+		return result, err
+	}
+
+	diff, err := r.diffAgainstStored(ctx, combinedSchema)
+	if err != nil {
+		return result, err
+	}
+	result.Diff = diff
+	warnings, err := r.applyDestructiveChangePolicy(ctx, diff)
+	if err != nil {
+		return result, err
 	}
+	result.Warnings = append(result.Warnings, warnings...)
 
-	log.Ctx(ctx).Info().Int("files", len(r.files)).Msg("reloading schema")
-	_, err := r.schemaClient.WriteSchema(ctx, &v1.WriteSchemaRequest{Schema: combinedSchema})
+	log.Ctx(ctx).Info().Int("files", len(files)).Int("urls", len(r.urls)).Int("changes", len(diff.Changes)).Msg("reloading schema")
+	revision, err := r.writeSchema(ctx, combinedSchema)
 	if err != nil {
-		return fmt.Errorf("failed to write schema: %w", err)
+		return result, err
+	}
+	result.Revision = revision
+
+	decoded, decodeErr := decodeValidationFiles(r.fsys, files)
+	if r.seedPolicy != SeedPolicyNone {
+		if decodeErr != nil {
+			return result, decodeErr
+		}
+		if err := r.seedRelationships(ctx, combinedSchema, seedRelationshipsFrom(decoded)); err != nil {
+			return result, err
+		}
 	}
 
 	log.Ctx(ctx).Info().Msg("schema reloaded successfully")
-	return nil
+
+	// Files which are not valid validation files only contribute their schema.
+	if decodeErr != nil {
+		log.Ctx(ctx).Warn().Err(decodeErr).Msg("skipping schema assertions")
+		result.Warnings = append(result.Warnings, "skipped schema assertions: "+decodeErr.Error())
+		r.setLastReport(nil)
+		return result, nil
+	}
+
+	report, err := r.validate(ctx, decoded)
+	if err != nil {
+		return result, fmt.Errorf("failed to evaluate schema assertions: %w", err)
+	}
+	r.setLastReport(report)
+	result.Validation = report
+	if report != nil && report.Failed > 0 {
+		return result, &ValidationError{Report: report}
+	}
+	return result, nil
 }
 
-// ReadSchemaFile reads a single schema file, handling both .zed and .yaml formats.
+// ApplySchema writes the given schema text, bypassing the schema files, and returns the diff
+// against the stored schema and the ZedToken at which it was written. The destructive change policy
+// applies as it does to reloads. It is used to roll back to a previously applied schema. The result
+// is never nil.
+func (r *SchemaReloader) ApplySchema(ctx context.Context, schemaText string) (*ReloadResult, error) {
+	result := &ReloadResult{Schema: schemaText}
+	if strings.TrimSpace(schemaText) == "" {
+		return result, fmt.Errorf("schema must not be empty")
+	}
+
+	diff, err := r.diffAgainstStored(ctx, schemaText)
+	if err != nil {
+		return result, err
+	}
+	result.Diff = diff
+	warnings, err := r.applyDestructiveChangePolicy(ctx, diff)
+	if err != nil {
+		return result, err
+	}
+	result.Warnings = warnings
+
+	log.Ctx(ctx).Info().Int("changes", len(diff.Changes)).Msg("applying schema")
+	revision, err := r.writeSchema(ctx, schemaText)
+	if err != nil {
+		return result, err
+	}
+	result.Revision = revision
+	return result, nil
+}
+
+func (r *SchemaReloader) writeSchema(ctx context.Context, schemaText string) (string, error) {
+	resp, err := r.schemaClient.WriteSchema(ctx, &v1.WriteSchemaRequest{Schema: schemaText})
+	if err != nil {
+		return "", fmt.Errorf("failed to write schema: %w", err)
+	}
+	return resp.GetWrittenAt().GetToken(), nil
+}
+
+// Files returns the schema files, directories and patterns the reloader reads.
+func (r *SchemaReloader) Files() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.files
+}
+
+// SetFiles replaces the schema files, directories and patterns read by subsequent reloads. A reload
+// in progress keeps reading the previous files.
+func (r *SchemaReloader) SetFiles(files []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = files
+}
+
+// LastValidationReport returns the results of the assertions and expected relations evaluated by
+// the most recent successful schema write, or nil if the validation files declared none.
+func (r *SchemaReloader) LastValidationReport() *ValidationReport {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastReport
+}
+
+func (r *SchemaReloader) setLastReport(report *ValidationReport) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastReport = report
+}
+
+// ReadSchemaFile reads a single schema file, handling both .zed and .yaml formats. Files imported by
+// the schema are included ahead of it.
 func ReadSchemaFile(filePath string) (string, error) {
+	return ReadSchemaFileFS(nil, filePath)
+}
+
+// ReadSchemaFileFS reads a single schema file from fsys, like ReadSchemaFile. A `schemaFile`
+// referenced by a YAML file, and imported files, are read from fsys as well. A nil fsys is the
+// operating system's file system.
+func ReadSchemaFileFS(fsys fs.FS, filePath string) (string, error) {
+	return readSchemaFile(fsys, filePath, nil)
+}
+
+// readSchemaFile reads a single schema file along with the files it imports, rendering them as
+// templates if vars is not nil.
+func readSchemaFile(fsys fs.FS, filePath string, vars map[string]any) (string, error) {
+	sources, _, err := readSchemaSources(fsys, []string{filePath})
+	if err != nil {
+		return "", err
+	}
+	if err := renderSchemaSources(context.Background(), sources, vars); err != nil {
+		return "", err
+	}
+	if err := mergeDefinitions(sources); err != nil {
+		return "", err
+	}
+	return combineSchemaSources(sources), nil
+}
+
+// readSchemaSource reads the schema text of a single schema file, along with where it is located.
+// Other files it reads, or tries to read, are appended to deps if it is not nil.
+func readSchemaSource(fsys fs.FS, filePath string, deps *[]string) (schemaSource, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
 	if ext == ".yaml" || ext == ".yml" {
-		content, err := os.ReadFile(filePath)
+		content, err := readFile(fsys, filePath)
 		if err != nil {
-			return "", err
+			return schemaSource{}, err
 		}
 
-		schema, err := schemaFromYAML(filePath, content)
+		source, err := schemaFromYAML(fsys, filePath, content, deps)
 		if err != nil {
-			return "", err
+			return schemaSource{}, err
 		}
-		if strings.TrimSpace(schema) == "" {
-			return "", fmt.Errorf("no schema found in YAML file")
+		if strings.TrimSpace(source.text) == "" {
+			return schemaSource{}, fmt.Errorf("no schema found in YAML file")
 		}
-		return schema, nil
+		return source, nil
 	}
 
 	// Read as plain text (.zed or other)
-	content, err := os.ReadFile(filePath)
+	content, err := readFile(fsys, filePath)
 	if err != nil {
-		return "", err
+		return schemaSource{}, err
 	}
 
-	return string(content), nil
+	return schemaSource{file: filePath, text: string(content), firstLine: 1}, nil
 }
 
-func schemaFromYAML(yamlFilePath string, content []byte) (string, error) {
+func schemaFromYAML(fsys fs.FS, yamlFilePath string, content []byte, deps *[]string) (schemaSource, error) {
 	parsed, err := validationfile.DecodeValidationFile(content)
 	if err == nil {
 		if parsed.Schema.Schema != "" {
-			return parsed.Schema.Schema, nil
+			return inlineSchemaSource(yamlFilePath, content, parsed.Schema.Schema), nil
 		}
 		if parsed.SchemaFile != "" {
-			return readReferencedSchemaFile(yamlFilePath, parsed.SchemaFile)
+			return readReferencedSchemaFile(fsys, yamlFilePath, parsed.SchemaFile, deps)
 		}
 		// Fall through to minimal YAML parsing below for cases not covered by validationfile.
 	}
@@ -107,41 +350,74 @@ func schemaFromYAML(yamlFilePath string, content []byte) (string, error) {
 	if yerr := yaml.Unmarshal(content, &m); yerr != nil {
 		// Prefer the DecodeValidationFile error if we had one, but at least surface something consistent.
 		if err != nil {
-			return "", fmt.Errorf("failed to parse YAML file: %w", err)
+			return schemaSource{}, fmt.Errorf("failed to parse YAML file: %w", err)
 		}
-		return "", fmt.Errorf("failed to parse YAML file: %w", yerr)
+		return schemaSource{}, fmt.Errorf("failed to parse YAML file: %w", yerr)
 	}
 
 	if v, ok := m["schema"]; ok {
 		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
-			return s, nil
+			return inlineSchemaSource(yamlFilePath, content, s), nil
 		}
 	}
 	if v, ok := m["schema_file"]; ok {
 		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
-			return readReferencedSchemaFile(yamlFilePath, s)
+			return readReferencedSchemaFile(fsys, yamlFilePath, s, deps)
 		}
 	}
 	if v, ok := m["schemaFile"]; ok { // alternate spelling
 		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
-			return readReferencedSchemaFile(yamlFilePath, s)
+			return readReferencedSchemaFile(fsys, yamlFilePath, s, deps)
 		}
 	}
 
 	if err != nil {
-		return "", fmt.Errorf("failed to parse YAML file: %w", err)
+		return schemaSource{}, fmt.Errorf("failed to parse YAML file: %w", err)
 	}
-	return "", fmt.Errorf("no schema found in YAML file")
+	return schemaSource{}, fmt.Errorf("no schema found in YAML file")
 }
 
-func readReferencedSchemaFile(yamlFilePath, ref string) (string, error) {
+// inlineSchemaSource locates the schema embedded under the `schema` key of a YAML file, so that
+// compile errors can be reported against the lines of the YAML file.
+func inlineSchemaSource(yamlFilePath string, content []byte, schema string) schemaSource {
+	source := schemaSource{file: yamlFilePath, text: schema, firstLine: 1}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 {
+		return source
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return source
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "schema" {
+			continue
+		}
+
+		value := root.Content[i+1]
+		source.firstLine = value.Line
+		if value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			// Block scalars start on the line after the indicator.
+			source.firstLine++
+		}
+		break
+	}
+	return source
+}
+
+func readReferencedSchemaFile(fsys fs.FS, yamlFilePath, ref string, deps *[]string) (schemaSource, error) {
 	if !filepath.IsLocal(ref) {
-		return "", fmt.Errorf("schema file %q is not local", ref)
+		return schemaSource{}, fmt.Errorf("schema file %q is not local", ref)
+	}
+	schemaPath := resolveRelative(fsys, yamlFilePath, ref)
+	if deps != nil {
+		*deps = append(*deps, schemaPath)
 	}
-	schemaPath := filepath.Join(filepath.Dir(yamlFilePath), ref)
-	schemaContent, err := os.ReadFile(schemaPath)
+	schemaContent, err := readFile(fsys, schemaPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read referenced schema file %s: %w", schemaPath, err)
+		return schemaSource{}, fmt.Errorf("failed to read referenced schema file %s: %w", schemaPath, err)
 	}
-	return string(schemaContent), nil
+	return schemaSource{file: schemaPath, text: string(schemaContent), firstLine: 1}, nil
 }
@@ -0,0 +1,106 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// templateName is the name schema templates are parsed under. Errors name the template, so they
+// are parsed under a fixed name which templateErrorPattern can pick out, rather than the file path.
+const templateName = "schema"
+
+// templateErrorPattern matches the location prefixed to the errors of text/template:
+// "template: schema:LINE: message" for parse errors, and "template: schema:LINE:COLUMN: message"
+// for execution errors, with a 0-based column.
+var templateErrorPattern = regexp.MustCompile(`(?s)^template: ` + templateName + `:(\d+)(?::(\d+))?: (.*)$`)
+
+// templateFuncs are the functions available to schema templates in addition to the built-in ones.
+var templateFuncs = template.FuncMap{
+	// env returns the value of an environment variable, or an empty string if it is not set.
+	"env": os.Getenv,
+}
+
+// WithTemplateVars renders the schema text of every schema file as a Go text/template before
+// compiling it, with vars as the template's data: `{{ .name }}` is replaced by vars["name"], and
+// `{{ env "NAME" }}` by the environment variable NAME. Referencing a variable missing from vars is
+// an error. A nil map disables templating. Schemas fetched from URLs are not rendered, so a remote
+// schema can't read the environment.
+func WithTemplateVars(vars map[string]any) ReloaderOption {
+	return func(r *SchemaReloader) {
+		r.templateVars = vars
+	}
+}
+
+// RenderSchemaFile reads a single schema file from fsys, like ReadSchemaFileFS, and renders it as a
+// template with vars as data, like WithTemplateVars. The rendered schema text is returned as is,
+// without compiling it. A nil fsys is the operating system's file system.
+func RenderSchemaFile(fsys fs.FS, filePath string, vars map[string]any) (string, error) {
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	return readSchemaFile(fsys, filePath, vars)
+}
+
+// renderSchemaSources renders each source as a template, unless vars is nil. Errors in a template
+// are returned as a *SchemaError located in the template's file.
+func renderSchemaSources(ctx context.Context, sources []schemaSource, vars map[string]any) error {
+	if vars == nil {
+		return nil
+	}
+	for i, source := range sources {
+		rendered, err := renderSchemaSource(source, vars)
+		if err != nil {
+			return err
+		}
+		log.Ctx(ctx).Debug().Str("file", source.file).Msg("rendered schema template")
+		sources[i] = rendered
+	}
+	return nil
+}
+
+func renderSchemaSource(source schemaSource, vars map[string]any) (schemaSource, error) {
+	tmpl, err := template.New(templateName).Funcs(templateFuncs).Option("missingkey=error").Parse(source.text)
+	if err != nil {
+		return schemaSource{}, templateError(source, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return schemaSource{}, templateError(source, err)
+	}
+
+	source.text = buf.String()
+	source.rendered = true
+	return source, nil
+}
+
+// templateError locates an error of text/template in the file of source.
+func templateError(source schemaSource, err error) *SchemaError {
+	schemaErr := &SchemaError{File: source.file, Line: source.firstLine, Column: 1, Message: err.Error()}
+
+	match := templateErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return schemaErr
+	}
+	line, _ := strconv.Atoi(match[1])
+	schemaErr.Line = line - 1 + source.firstLine
+	if match[2] != "" {
+		column, _ := strconv.Atoi(match[2])
+		schemaErr.Column = column + 1
+	}
+	schemaErr.Message = strings.TrimPrefix(match[3], `executing "`+templateName+`" `)
+
+	lines := strings.Split(source.text, "\n")
+	if line >= 1 && line <= len(lines) {
+		schemaErr.Source = lines[line-1]
+	}
+	return schemaErr
+}
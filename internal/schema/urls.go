@@ -0,0 +1,96 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/authzed/spicedb/pkg/validationfile"
+
+	"github.com/akoserwal/embedspicedb/internal/httpsource"
+)
+
+// WithURLs reads schemas served at HTTP(S) URLs in addition to the schema files, fetching them with
+// client. A nil client uses a client with a 10 second timeout.
+func WithURLs(client *http.Client, urls []string) ReloaderOption {
+	sources := make([]*httpsource.Source, 0, len(urls))
+	for _, u := range urls {
+		sources = append(sources, httpsource.New(u, client))
+	}
+	return WithURLSources(sources)
+}
+
+// WithURLSources reads schemas from the given URL sources in addition to the schema files. Sources
+// may be shared with an httpsource.Poller, so that a reload after a change revalidates the copy the
+// poller fetched instead of transferring the schema again.
+func WithURLSources(sources []*httpsource.Source) ReloaderOption {
+	return func(r *SchemaReloader) {
+		r.urls = sources
+	}
+}
+
+// readURLSources fetches the schema text served at each URL.
+func readURLSources(ctx context.Context, sources []*httpsource.Source) ([]schemaSource, error) {
+	schemaSources := make([]schemaSource, 0, len(sources))
+	for _, source := range sources {
+		body, _, err := source.Fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		schemaSource, err := schemaFromURL(source.URL(), body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema from %s: %w", source.URL(), err)
+		}
+		if _, imports := stripImports(schemaSource.text); len(imports) > 0 {
+			// There is no directory to resolve them against
+			return nil, fmt.Errorf("failed to read schema from %s: imports are not supported for URLs", source.URL())
+		}
+		schemaSources = append(schemaSources, schemaSource)
+	}
+	return schemaSources, nil
+}
+
+// schemaFromURL returns the schema text served at rawURL. URLs whose path ends in .yaml or .yml serve
+// validation files, which must embed their schema: `schemaFile` references are not followed.
+func schemaFromURL(rawURL string, body []byte) (schemaSource, error) {
+	if !isYAMLURL(rawURL) {
+		if strings.TrimSpace(string(body)) == "" {
+			return schemaSource{}, fmt.Errorf("empty schema")
+		}
+		return schemaSource{file: rawURL, text: string(body), firstLine: 1}, nil
+	}
+
+	parsed, err := validationfile.DecodeValidationFile(body)
+	if err != nil {
+		return schemaSource{}, fmt.Errorf("failed to parse YAML file: %w", err)
+	}
+	if parsed.Schema.Schema == "" {
+		return schemaSource{}, fmt.Errorf("no schema found in YAML file; schemaFile references are not supported for URLs")
+	}
+	return inlineSchemaSource(rawURL, body, parsed.Schema.Schema), nil
+}
+
+func isYAMLURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+func urlsOf(sources []*httpsource.Source) []string {
+	urls := make([]string, 0, len(sources))
+	for _, source := range sources {
+		urls = append(urls, source.URL())
+	}
+	return urls
+}
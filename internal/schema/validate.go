@@ -0,0 +1,384 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/authzed/spicedb/pkg/tuple"
+	"github.com/authzed/spicedb/pkg/validationfile"
+	"github.com/authzed/spicedb/pkg/validationfile/blocks"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// Kinds of checks declared in YAML validation files.
+const (
+	AssertionKindTrue             = "assertTrue"
+	AssertionKindFalse            = "assertFalse"
+	AssertionKindCaveated         = "assertCaveated"
+	AssertionKindExpectedRelation = "validation"
+)
+
+// AssertionResult is the outcome of a single assertion or expected relation.
+type AssertionResult struct {
+	// File is the validation file declaring the check.
+	File string `json:"file"`
+
+	// Line is the line of the check within File, if known.
+	Line uint64 `json:"line,omitempty"`
+
+	// Kind is one of assertTrue, assertFalse, assertCaveated or validation.
+	Kind string `json:"kind"`
+
+	// Assertion is the check as written in the file.
+	Assertion string `json:"assertion"`
+
+	// Passed is true if the embedded server agreed with the check.
+	Passed bool `json:"passed"`
+
+	// Message explains why the check failed. Empty if it passed.
+	Message string `json:"message,omitempty"`
+}
+
+// ValidationReport holds the results of evaluating the assertions and expected relations of all
+// validation files after a reload.
+type ValidationReport struct {
+	Results []AssertionResult `json:"results"`
+	Passed  int               `json:"passed"`
+	Failed  int               `json:"failed"`
+}
+
+// Failures returns the results of the checks which failed.
+func (r *ValidationReport) Failures() []AssertionResult {
+	var failures []AssertionResult
+	for _, result := range r.Results {
+		if !result.Passed {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+func (r *ValidationReport) add(result AssertionResult) {
+	r.Results = append(r.Results, result)
+	if result.Passed {
+		r.Passed++
+	} else {
+		r.Failed++
+	}
+}
+
+// ValidationError is returned by Reload when the schema was written but some of the assertions or
+// expected relations in the validation files failed.
+type ValidationError struct {
+	Report *ValidationReport
+}
+
+func (e *ValidationError) Error() string {
+	failures := e.Report.Failures()
+	msg := fmt.Sprintf("%d of %d schema assertions failed", e.Report.Failed, len(e.Report.Results))
+	if len(failures) > 0 {
+		first := failures[0]
+		msg += fmt.Sprintf("; first failure: %s %q in %s: %s", first.Kind, first.Assertion, first.File, first.Message)
+	}
+	return msg
+}
+
+// decodedFile is a parsed YAML validation file.
+type decodedFile struct {
+	path string
+	file *validationfile.ValidationFile
+}
+
+// decodeValidationFiles parses all YAML validation files. Other schema files are skipped.
+func decodeValidationFiles(fsys fs.FS, files []string) ([]decodedFile, error) {
+	var decoded []decodedFile
+	for _, filePath := range files {
+		ext := strings.ToLower(filepath.Ext(filePath))
+		if ext != ".yaml" && ext != ".yml" {
+			continue
+		}
+
+		content, err := readFile(fsys, filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema file %s: %w", filePath, err)
+		}
+
+		parsed, err := validationfile.DecodeValidationFile(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse validation file %s: %w", filePath, err)
+		}
+		decoded = append(decoded, decodedFile{path: filePath, file: parsed})
+	}
+	return decoded, nil
+}
+
+// validate evaluates the assertions and expected relations of the given files against the server.
+// It returns nil if the files declare no checks.
+func (r *SchemaReloader) validate(ctx context.Context, files []decodedFile) (*ValidationReport, error) {
+	report := &ValidationReport{}
+	hasChecks := false
+
+	for _, df := range files {
+		assertions := []struct {
+			kind       string
+			assertions []blocks.Assertion
+			expected   v1.CheckPermissionResponse_Permissionship
+		}{
+			{AssertionKindTrue, df.file.Assertions.AssertTrue, v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION},
+			{AssertionKindFalse, df.file.Assertions.AssertFalse, v1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION},
+			{AssertionKindCaveated, df.file.Assertions.AssertCaveated, v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION},
+		}
+
+		for _, group := range assertions {
+			for _, assertion := range group.assertions {
+				hasChecks = true
+				result, err := r.checkAssertion(ctx, assertion, group.expected)
+				if err != nil {
+					return nil, err
+				}
+				result.File = df.path
+				result.Kind = group.kind
+				report.add(result)
+			}
+		}
+
+		for objRel, subjects := range df.file.ExpectedRelations.ValidationMap {
+			hasChecks = true
+			result, err := r.checkExpectedRelation(ctx, objRel, subjects)
+			if err != nil {
+				return nil, err
+			}
+			result.File = df.path
+			result.Kind = AssertionKindExpectedRelation
+			report.add(result)
+		}
+	}
+
+	if !hasChecks {
+		return nil, nil
+	}
+
+	// Map iteration is unordered, so sort for stable reporting.
+	slices.SortStableFunc(report.Results, func(a, b AssertionResult) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Assertion, b.Assertion)
+	})
+
+	for _, result := range report.Results {
+		if result.Passed {
+			log.Ctx(ctx).Debug().Str("file", result.File).Str("kind", result.Kind).Str("assertion", result.Assertion).Msg("schema assertion passed")
+		} else {
+			log.Ctx(ctx).Warn().Str("file", result.File).Str("kind", result.Kind).Str("assertion", result.Assertion).Str("reason", result.Message).Msg("schema assertion failed")
+		}
+	}
+	log.Ctx(ctx).Info().Int("passed", report.Passed).Int("failed", report.Failed).Msg("evaluated schema assertions")
+
+	return report, nil
+}
+
+var permissionshipNames = map[v1.CheckPermissionResponse_Permissionship]string{
+	v1.CheckPermissionResponse_PERMISSIONSHIP_HAS_PERMISSION:         "has permission",
+	v1.CheckPermissionResponse_PERMISSIONSHIP_NO_PERMISSION:          "no permission",
+	v1.CheckPermissionResponse_PERMISSIONSHIP_CONDITIONAL_PERMISSION: "conditional permission",
+}
+
+func (r *SchemaReloader) checkAssertion(ctx context.Context, assertion blocks.Assertion, expected v1.CheckPermissionResponse_Permissionship) (AssertionResult, error) {
+	result := AssertionResult{
+		Line:      assertion.SourcePosition.LineNumber,
+		Assertion: assertion.RelationshipWithContextString,
+	}
+
+	rel := assertion.Relationship
+	req := &v1.CheckPermissionRequest{
+		Consistency: &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+		Resource:    &v1.ObjectReference{ObjectType: rel.Resource.ObjectType, ObjectId: rel.Resource.ObjectID},
+		Permission:  rel.Resource.Relation,
+		Subject: &v1.SubjectReference{
+			Object:           &v1.ObjectReference{ObjectType: rel.Subject.ObjectType, ObjectId: rel.Subject.ObjectID},
+			OptionalRelation: stripEllipsis(rel.Subject.Relation),
+		},
+	}
+	if len(assertion.CaveatContext) > 0 {
+		caveatContext, err := structpb.NewStruct(assertion.CaveatContext)
+		if err != nil {
+			result.Message = fmt.Sprintf("invalid caveat context: %v", err)
+			return result, nil
+		}
+		req.Context = caveatContext
+	}
+
+	resp, err := r.permissionsClient.CheckPermission(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		result.Message = fmt.Sprintf("check failed: %v", err)
+		return result, nil
+	}
+
+	if resp.Permissionship != expected {
+		result.Message = fmt.Sprintf("expected %s, got %s", permissionshipNames[expected], permissionshipNames[resp.Permissionship])
+		return result, nil
+	}
+
+	result.Passed = true
+	return result, nil
+}
+
+// checkExpectedRelation compares the subjects declared for a relation with those found by looking
+// up subjects of each declared subject type. Subjects of types that are not declared are not
+// considered.
+func (r *SchemaReloader) checkExpectedRelation(ctx context.Context, objRel blocks.ObjectRelation, subjects []blocks.ExpectedSubject) (AssertionResult, error) {
+	result := AssertionResult{
+		Line:      objRel.SourcePosition.LineNumber,
+		Assertion: objRel.ObjectRelationString,
+	}
+
+	type subjectType struct {
+		objectType string
+		relation   string
+	}
+
+	expected := make(map[string]struct{})
+	var subjectTypes []subjectType
+	for _, subject := range subjects {
+		if subject.SubjectWithExceptions == nil {
+			continue
+		}
+
+		expected[expectedSubjectKey(*subject.SubjectWithExceptions)] = struct{}{}
+
+		st := subjectType{
+			objectType: subject.SubjectWithExceptions.Subject.Subject.ObjectType,
+			relation:   stripEllipsis(subject.SubjectWithExceptions.Subject.Subject.Relation),
+		}
+		if !slices.Contains(subjectTypes, st) {
+			subjectTypes = append(subjectTypes, st)
+		}
+	}
+
+	resource := objRel.ObjectAndRelation
+	found := make(map[string]struct{})
+	for _, st := range subjectTypes {
+		stream, err := r.permissionsClient.LookupSubjects(ctx, &v1.LookupSubjectsRequest{
+			Consistency:             &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+			Resource:                &v1.ObjectReference{ObjectType: resource.ObjectType, ObjectId: resource.ObjectID},
+			Permission:              resource.Relation,
+			SubjectObjectType:       st.objectType,
+			OptionalSubjectRelation: st.relation,
+		})
+		if err == nil {
+			for {
+				var resp *v1.LookupSubjectsResponse
+				resp, err = stream.Recv()
+				if errors.Is(err, io.EOF) {
+					err = nil
+					break
+				}
+				if err != nil {
+					break
+				}
+				found[resolvedSubjectKey(st.objectType, st.relation, resp)] = struct{}{}
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			result.Message = fmt.Sprintf("lookup of %s subjects failed: %v", st.objectType, err)
+			return result, nil
+		}
+	}
+
+	var missing, unexpected []string
+	for key := range expected {
+		if _, ok := found[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	for key := range found {
+		if _, ok := expected[key]; !ok {
+			unexpected = append(unexpected, key)
+		}
+	}
+	slices.Sort(missing)
+	slices.Sort(unexpected)
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing subjects "+strings.Join(missing, ", "))
+	}
+	if len(unexpected) > 0 {
+		problems = append(problems, "unexpected subjects "+strings.Join(unexpected, ", "))
+	}
+	if len(problems) > 0 {
+		result.Message = strings.Join(problems, "; ")
+		return result, nil
+	}
+
+	result.Passed = true
+	return result, nil
+}
+
+// expectedSubjectKey formats a declared subject in the same form as resolvedSubjectKey.
+func expectedSubjectKey(subject blocks.SubjectWithExceptions) string {
+	key := subjectKey(subject.Subject.Subject.ObjectType, subject.Subject.Subject.ObjectID, stripEllipsis(subject.Subject.Subject.Relation), subject.Subject.IsCaveated)
+	if len(subject.Exceptions) == 0 {
+		return key
+	}
+
+	exceptions := make([]string, 0, len(subject.Exceptions))
+	for _, exception := range subject.Exceptions {
+		exceptions = append(exceptions, subjectKey(exception.Subject.ObjectType, exception.Subject.ObjectID, stripEllipsis(exception.Subject.Relation), exception.IsCaveated))
+	}
+	slices.Sort(exceptions)
+	return key + " - {" + strings.Join(exceptions, ", ") + "}"
+}
+
+// resolvedSubjectKey formats a subject found by LookupSubjects, including any wildcard exclusions.
+func resolvedSubjectKey(objectType, relation string, resp *v1.LookupSubjectsResponse) string {
+	subject := resp.Subject
+	key := subjectKey(objectType, subject.SubjectObjectId, relation, subject.Permissionship == v1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_CONDITIONAL_PERMISSION)
+	if len(resp.ExcludedSubjects) == 0 {
+		return key
+	}
+
+	exceptions := make([]string, 0, len(resp.ExcludedSubjects))
+	for _, excluded := range resp.ExcludedSubjects {
+		exceptions = append(exceptions, subjectKey(objectType, excluded.SubjectObjectId, relation, excluded.Permissionship == v1.LookupPermissionship_LOOKUP_PERMISSIONSHIP_CONDITIONAL_PERMISSION))
+	}
+	slices.Sort(exceptions)
+	return key + " - {" + strings.Join(exceptions, ", ") + "}"
+}
+
+func subjectKey(objectType, objectID, relation string, caveated bool) string {
+	key := objectType + ":" + objectID
+	if relation != "" {
+		key += "#" + relation
+	}
+	if caveated {
+		key += "[...]"
+	}
+	return key
+}
+
+func stripEllipsis(relation string) string {
+	if relation == tuple.Ellipsis {
+		return ""
+	}
+	return relation
+}
@@ -0,0 +1,309 @@
+// Package schemafiles resolves the entries of Config.SchemaFiles, which may be files, directories
+// or glob patterns, into the schema files they currently match.
+package schemafiles
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Kind is the kind of a SchemaFiles entry.
+type Kind int
+
+const (
+	// KindFile is a single schema file, which may not exist yet.
+	KindFile Kind = iota
+
+	// KindDir is a directory: every schema file below it matches, recursively.
+	KindDir
+
+	// KindGlob is a glob pattern. In addition to the syntax of filepath.Match, a `**` path segment
+	// matches any number of directories.
+	KindGlob
+)
+
+// Entry is a parsed SchemaFiles entry.
+type Entry struct {
+	// Path is the entry as configured.
+	Path string
+
+	// Kind is the kind of the entry.
+	Kind Kind
+
+	// Base is the directory containing every file the entry can match: the directory itself for
+	// KindDir, the longest leading part of the pattern without metacharacters for KindGlob, and the
+	// parent directory for KindFile.
+	Base string
+
+	// pattern holds the pattern segments below Base, for KindGlob.
+	pattern []string
+
+	// fsys is the file system the entry's files are read from, or nil for the operating system's.
+	fsys fs.FS
+}
+
+// IsSchemaFile returns whether path has one of the extensions of schema files: .zed, .yaml or .yml.
+func IsSchemaFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".zed", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// Parse parses a SchemaFiles entry. Entries containing glob metacharacters are patterns; entries
+// ending in a path separator or naming an existing directory are directories; anything else is a
+// file.
+func Parse(entry string) (Entry, error) {
+	return ParseFS(nil, entry)
+}
+
+// ParseFS parses a SchemaFiles entry naming files within fsys, in the slash-separated form of
+// fs.ValidPath. A nil fsys is the operating system's file system, like for Parse.
+func ParseFS(fsys fs.FS, entry string) (Entry, error) {
+	if fsys != nil {
+		return parseFS(fsys, entry)
+	}
+
+	slashed := filepath.ToSlash(entry)
+
+	if isGlob(slashed) {
+		base, pattern, err := parseGlob(slashed, filepath.Match)
+		if err != nil {
+			return Entry{}, fmt.Errorf("invalid pattern %q: %w", entry, err)
+		}
+		return Entry{Path: entry, Kind: KindGlob, Base: filepath.FromSlash(base), pattern: pattern}, nil
+	}
+
+	if strings.HasSuffix(slashed, "/") {
+		return Entry{Path: entry, Kind: KindDir, Base: filepath.Clean(entry)}, nil
+	}
+	if info, err := os.Stat(entry); err == nil && info.IsDir() {
+		return Entry{Path: entry, Kind: KindDir, Base: filepath.Clean(entry)}, nil
+	}
+	return Entry{Path: entry, Kind: KindFile, Base: filepath.Dir(entry)}, nil
+}
+
+func parseFS(fsys fs.FS, entry string) (Entry, error) {
+	name := strings.TrimSuffix(entry, "/")
+	if !fs.ValidPath(name) {
+		return Entry{}, fmt.Errorf("invalid path %q: must be a slash-separated path without . or .. elements", entry)
+	}
+
+	if isGlob(name) {
+		base, pattern, err := parseGlob(name, path.Match)
+		if err != nil {
+			return Entry{}, fmt.Errorf("invalid pattern %q: %w", entry, err)
+		}
+		return Entry{Path: entry, Kind: KindGlob, Base: base, pattern: pattern, fsys: fsys}, nil
+	}
+
+	if strings.HasSuffix(entry, "/") || name == "." {
+		return Entry{Path: entry, Kind: KindDir, Base: name, fsys: fsys}, nil
+	}
+	if info, err := fs.Stat(fsys, name); err == nil && info.IsDir() {
+		return Entry{Path: entry, Kind: KindDir, Base: name, fsys: fsys}, nil
+	}
+	return Entry{Path: entry, Kind: KindFile, Base: path.Dir(name), fsys: fsys}, nil
+}
+
+// isGlob returns whether entry contains glob metacharacters.
+func isGlob(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
+
+// parseGlob splits a slash-separated glob entry into its base, the slash-separated segments before
+// the first segment containing metacharacters, and the pattern segments from there on, which are
+// validated with match.
+func parseGlob(entry string, match func(pattern, name string) (bool, error)) (string, []string, error) {
+	segments := strings.Split(entry, "/")
+	literal := 0
+	for literal < len(segments) && !isGlob(segments[literal]) {
+		literal++
+	}
+	for _, segment := range segments[literal:] {
+		if _, err := match(segment, ""); err != nil {
+			return "", nil, err
+		}
+	}
+
+	base := strings.Join(segments[:literal], "/")
+	switch {
+	case literal == 1 && segments[0] == "":
+		base = "/"
+	case base == "":
+		base = "."
+	}
+	return base, segments[literal:], nil
+}
+
+// Abs returns the entry with an absolute Path and Base. Entries within an fs.FS are returned as is.
+func (e Entry) Abs() (Entry, error) {
+	if e.fsys != nil {
+		return e, nil
+	}
+
+	path, err := filepath.Abs(e.Path)
+	if err != nil {
+		return Entry{}, err
+	}
+	base, err := filepath.Abs(e.Base)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Path, e.Base = path, base
+	return e, nil
+}
+
+// Match returns whether the entry matches the file at name, which must be absolute if the entry is.
+// Files and directories below Base whose name starts with a dot never match directories and patterns.
+func (e Entry) Match(name string) bool {
+	if e.Kind == KindFile {
+		if e.fsys != nil {
+			return path.Clean(name) == path.Clean(e.Path)
+		}
+		return filepath.Clean(name) == filepath.Clean(e.Path)
+	}
+
+	rel, err := e.rel(name)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, ".") {
+			return false
+		}
+	}
+
+	if e.Kind == KindDir {
+		return IsSchemaFile(name)
+	}
+	// Paths within an fs.FS are slash-separated whatever the operating system
+	match := filepath.Match
+	if e.fsys != nil {
+		match = path.Match
+	}
+	return matchSegments(e.pattern, segments, match)
+}
+
+// rel returns path relative to Base.
+func (e Entry) rel(name string) (string, error) {
+	if e.fsys == nil {
+		return filepath.Rel(e.Base, name)
+	}
+	switch {
+	case e.Base == ".":
+		return name, nil
+	case name == e.Base:
+		return ".", nil
+	case strings.HasPrefix(name, e.Base+"/"):
+		return strings.TrimPrefix(name, e.Base+"/"), nil
+	default:
+		return "..", nil
+	}
+}
+
+// matchSegments matches path segments against pattern segments with match, where `**` matches any
+// number of segments.
+func matchSegments(pattern, segments []string, match func(pattern, name string) (bool, error)) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:], match) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// Files returns the files the entry currently matches, in lexical order. A KindFile entry always
+// returns its file, whether or not it exists, so that reading it reports the missing file.
+func (e Entry) Files() ([]string, error) {
+	if e.Kind == KindFile {
+		return []string{e.Path}, nil
+	}
+
+	var files []string
+	err := e.walkDir(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A pattern whose base directory does not exist simply matches nothing.
+			if path == e.Base && errors.Is(err, fs.ErrNotExist) && e.Kind == KindGlob {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != e.Base && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if e.Match(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema files in %s: %w", e.Base, err)
+	}
+	return files, nil
+}
+
+// walkDir walks the files below Base.
+func (e Entry) walkDir(fn fs.WalkDirFunc) error {
+	if e.fsys == nil {
+		return filepath.WalkDir(e.Base, fn)
+	}
+	return fs.WalkDir(e.fsys, e.Base, fn)
+}
+
+// Resolve returns the schema files matched by the entries: in the order of the entries, each
+// entry's files in lexical order, and without duplicates.
+func Resolve(entries []string) ([]string, error) {
+	return ResolveFS(nil, entries)
+}
+
+// ResolveFS returns the schema files within fsys matched by the entries, like Resolve.
+// A nil fsys is the operating system's file system.
+func ResolveFS(fsys fs.FS, entries []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]struct{})
+	for _, raw := range entries {
+		entry, err := ParseFS(fsys, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		matched, err := entry.Files()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range matched {
+			key := filepath.Clean(file)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,167 @@
+// Package socket listens on the addresses the server is configured with: TCP addresses, and unix
+// domain sockets written as unix:// followed by the socket path.
+package socket
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Unix is the network of unix domain socket addresses.
+	Unix = "unix"
+
+	// TCP is the network of every other address.
+	TCP = "tcp"
+
+	// Prefix starts the addresses of unix domain sockets, such as "unix:///run/spicedb.sock".
+	Prefix = "unix://"
+
+	// DefaultMode is the permission of socket files when none is configured: only the user running
+	// the server may connect.
+	DefaultMode fs.FileMode = 0o600
+
+	// probeTimeout bounds the connection attempt deciding whether an existing socket is in use.
+	probeTimeout = time.Second
+)
+
+// Split returns the network of address and the address on that network: the socket path for unix://
+// addresses, and address itself for TCP addresses.
+func Split(address string) (network, addr string) {
+	if path, ok := strings.CutPrefix(address, Prefix); ok {
+		return Unix, path
+	}
+	return TCP, address
+}
+
+// Validate returns an error if address is neither a unix:// socket path nor a TCP address.
+func Validate(address string) error {
+	network, addr := Split(address)
+	if network == Unix {
+		if strings.TrimSpace(addr) == "" {
+			return fmt.Errorf("socket path must not be empty")
+		}
+		return nil
+	}
+	_, err := net.ResolveTCPAddr(TCP, addr)
+	return err
+}
+
+// Listen listens on address. Unix domain sockets are created with mode, replacing a socket left
+// behind by a process which exited without removing it. Closing the listener removes the socket.
+func Listen(address string, mode fs.FileMode) (net.Listener, error) {
+	network, addr := Split(address)
+	if network != Unix {
+		return net.Listen(network, addr)
+	}
+
+	if err := prepare(addr); err != nil {
+		return nil, err
+	}
+
+	// The socket is created in a private directory and moved to its path once its mode is set, so
+	// nobody can connect to it with the permissions it was created with.
+	dir, err := os.MkdirTemp(filepath.Dir(addr), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket %s: %w", addr, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.ListenUnix(Unix, &net.UnixAddr{Name: tmp, Net: Unix})
+	if err != nil {
+		return nil, err
+	}
+	ln.SetUnlinkOnClose(false)
+	if err := chmod(tmp, mode); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, addr); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to create socket %s: %w", addr, err)
+	}
+	return &unixListener{UnixListener: ln, addr: &net.UnixAddr{Name: addr, Net: Unix}}, nil
+}
+
+// unixListener is a listener on a socket moved to its path after it was created.
+type unixListener struct {
+	*net.UnixListener
+	addr *net.UnixAddr
+}
+
+// Addr returns the path the socket was moved to.
+func (l *unixListener) Addr() net.Addr {
+	return l.addr
+}
+
+// Close closes the listener and removes its socket.
+func (l *unixListener) Close() error {
+	if err := l.UnixListener.Close(); err != nil {
+		return err
+	}
+	return Remove(l.addr.Name)
+}
+
+// prepare makes way for a socket at path by removing a stale socket. It fails if the socket is in
+// use, or if path is a file other than a socket, which is never removed.
+func prepare(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout(Unix, path, probeTimeout)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is already in use", path)
+	}
+	return Remove(path)
+}
+
+// chmod sets the permission of the socket at path.
+func chmod(path string, mode fs.FileMode) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("failed to set permissions of socket %s: %w", path, err)
+	}
+	return nil
+}
+
+// Remove removes the socket at path, if any. Files other than sockets are left in place.
+func Remove(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Addr returns the address of a listener in the form it is configured with, prefixing the paths of
+// unix domain sockets with unix://.
+func Addr(addr net.Addr) string {
+	if addr.Network() == Unix {
+		return Prefix + addr.String()
+	}
+	return addr.String()
+}
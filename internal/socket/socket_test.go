@@ -0,0 +1,74 @@
+package socket
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenSetsModeBeforeSocketAppears(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "grpc.sock")
+
+	// Record the mode of the socket the first time it is seen
+	firstMode := make(chan fs.FileMode, 1)
+	go func() {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if info, err := os.Lstat(path); err == nil {
+				firstMode <- info.Mode()
+				return
+			}
+		}
+		close(firstMode)
+	}()
+
+	ln, err := Listen(Prefix+path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	mode, ok := <-firstMode
+	if !ok {
+		t.Fatal("socket never appeared")
+	}
+	if mode.Type() != fs.ModeSocket || mode.Perm() != 0o600 {
+		t.Fatalf("socket first appeared with mode %v, want a socket with permissions 0600", mode)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory holds %d entries, want the socket alone", len(entries))
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "grpc.sock")
+	ln, err := Listen(Prefix+path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Addr(ln.Addr()); got != Prefix+path {
+		t.Errorf("Addr() = %q, want %q", got, Prefix+path)
+	}
+
+	conn, err := net.Dial(Unix, path)
+	if err != nil {
+		t.Fatalf("failed to connect to the socket: %v", err)
+	}
+	_ = conn.Close()
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left behind after Close: %v", err)
+	}
+}
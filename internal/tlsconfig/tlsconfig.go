@@ -0,0 +1,203 @@
+// Package tlsconfig builds the TLS configuration of the server's listeners, reloading certificate
+// files when they change.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// reloadInterval is how often, at most, the files are checked for changes.
+const reloadInterval = time.Second
+
+// Files names the PEM encoded files TLS is configured with.
+type Files struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+}
+
+// Server provides the TLS configuration of the server's listeners, from files or from a *tls.Config.
+type Server struct {
+	files Files
+	base  *tls.Config
+
+	mu        sync.Mutex
+	checked   time.Time        // GUARDED_BY(mu)
+	stamps    []fileStamp      // GUARDED_BY(mu)
+	cert      *tls.Certificate // GUARDED_BY(mu)
+	clientCAs *x509.CertPool   // GUARDED_BY(mu)
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// New returns the TLS configuration served from files, or from base if it isn't nil. The files are
+// loaded immediately, and reloaded when they change.
+func New(files Files, base *tls.Config) (*Server, error) {
+	s := &Server{
+		files: files,
+		base:  base,
+	}
+	if base != nil {
+		return s, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checked = time.Now()
+	s.stamps = s.stat()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ServerConfig returns the configuration of a listener, negotiating nextProtos unless the base
+// configuration sets its own.
+func (s *Server) ServerConfig(nextProtos ...string) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.base != nil {
+		cfg = s.base.Clone()
+	}
+	// crypto/tls only calls GetCertificate without Certificates, or for clients sending SNI;
+	// getCertificate selects from Certificates itself.
+	cfg.Certificates = nil
+	cfg.GetCertificate = s.getCertificate
+	if len(cfg.NextProtos) == 0 {
+		cfg.NextProtos = nextProtos
+	}
+	if s.base != nil || s.files.ClientCAFile == "" {
+		return cfg
+	}
+
+	// Client certificates are verified by crypto/tls against the client CAs loaded when the
+	// connection is made, so the CAs are reloaded like the certificate.
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	base := cfg.Clone()
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		conn := base.Clone()
+		conn.ClientCAs = s.currentClientCAs()
+		return conn, nil
+	}
+	return cfg
+}
+
+// getCertificate returns the certificate to present to the client sending hello.
+func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := s.selectCertificate(hello)
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return nil, errors.New("tls: no certificates configured")
+	}
+	return cert, nil
+}
+
+// selectCertificate chooses the certificate for hello, as crypto/tls would from the configuration.
+func (s *Server) selectCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.base == nil {
+		s.refresh()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.cert, nil
+	}
+
+	if s.base.GetCertificate != nil {
+		cert, err := s.base.GetCertificate(hello)
+		if err != nil || cert != nil {
+			return cert, err
+		}
+	}
+	for i := range s.base.Certificates {
+		if hello.SupportsCertificate(&s.base.Certificates[i]) == nil {
+			return &s.base.Certificates[i], nil
+		}
+	}
+	if len(s.base.Certificates) > 0 {
+		return &s.base.Certificates[0], nil
+	}
+	return nil, nil
+}
+
+// currentClientCAs returns the client CAs loaded from Files.ClientCAFile, reloading them if it
+// changed.
+func (s *Server) currentClientCAs() *x509.CertPool {
+	s.refresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientCAs
+}
+
+// refresh reloads the files if they changed since they were loaded, checking at most once per
+// reloadInterval. If they can't be loaded, for example because they are being rewritten, the
+// previous certificates remain in use until the files change again.
+func (s *Server) refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) < reloadInterval {
+		return
+	}
+	s.checked = time.Now()
+
+	stamps := s.stat()
+	if slices.Equal(stamps, s.stamps) {
+		return
+	}
+	s.stamps = stamps
+	if err := s.load(); err != nil {
+		log.Warn().Err(err).Msg("failed to reload TLS certificates; serving the previous ones")
+		return
+	}
+	log.Info().Str("cert_file", s.files.CertFile).Msg("reloaded TLS certificates")
+}
+
+// stat returns the versions of the files. Files which can't be read have a zero stamp.
+func (s *Server) stat() []fileStamp {
+	var stamps []fileStamp
+	for _, path := range []string{s.files.CertFile, s.files.KeyFile, s.files.ClientCAFile} {
+		var stamp fileStamp
+		if info, err := os.Stat(path); err == nil {
+			stamp = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		stamps = append(stamps, stamp)
+	}
+	return stamps
+}
+
+// load reads the files.
+func (s *Server) load() error {
+	cert, err := tls.LoadX509KeyPair(s.files.CertFile, s.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if s.files.ClientCAFile != "" {
+		data, err := os.ReadFile(s.files.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS client CAs: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("failed to load TLS client CAs: no certificates found in %s", s.files.ClientCAFile)
+		}
+	}
+
+	s.cert = &cert
+	s.clientCAs = clientCAs
+	return nil
+}
@@ -0,0 +1,209 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"io"
+	"sort"
+	"time"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// CircuitState is the state of the circuit breaker guarding the watcher's reloads.
+type CircuitState string
+
+const (
+	// CircuitClosed means reloads run as soon as changes settle.
+	CircuitClosed CircuitState = "closed"
+
+	// CircuitOpen means consecutive reloads failed and further reloads are held back until the
+	// backoff expires. Changes made in the meantime are reloaded once it does.
+	CircuitOpen CircuitState = "open"
+
+	// CircuitHalfOpen means the backoff expired: the next reload is a trial, which closes the circuit
+	// if it succeeds and opens it for twice as long if it fails.
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+const (
+	// DefaultFailureThreshold is the number of consecutive failed reloads after which the circuit
+	// opens when none is configured.
+	DefaultFailureThreshold = 3
+
+	// DefaultBackoff is the initial backoff when none is configured.
+	DefaultBackoff = 1 * time.Second
+
+	// DefaultMaxBackoff is the maximum backoff when none is configured.
+	DefaultMaxBackoff = 1 * time.Minute
+)
+
+// Status describes the outcome of the watcher's recent reloads.
+type Status struct {
+	// Circuit is the state of the circuit breaker.
+	Circuit CircuitState `json:"circuit"`
+
+	// ConsecutiveFailures is the number of reloads which failed since the last successful one.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// LastError is the error of the last failed reload. Empty once a reload succeeds.
+	LastError string `json:"last_error,omitempty"`
+
+	// RetryAt is when the backoff expires. Only set while the circuit is open.
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// WithBackoff sets the number of consecutive failed reloads after which reloads are held back, and
+// the initial and maximum time they are held back for. The backoff doubles with every further
+// failure. Zero values keep the defaults: DefaultFailureThreshold, DefaultBackoff and
+// DefaultMaxBackoff.
+func WithBackoff(threshold int, initial, maxBackoff time.Duration) Option {
+	return func(fw *FileWatcher) {
+		if threshold > 0 {
+			fw.failureThreshold = threshold
+		}
+		if initial > 0 {
+			fw.backoff = initial
+		}
+		if maxBackoff > 0 {
+			fw.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// Status returns the outcome of the watcher's recent reloads.
+func (fw *FileWatcher) Status() Status {
+	fw.statusMu.Lock()
+	defer fw.statusMu.Unlock()
+
+	status := Status{
+		Circuit:             fw.circuitLocked(time.Now()),
+		ConsecutiveFailures: fw.failures,
+	}
+	if fw.lastErr != nil {
+		status.LastError = fw.lastErr.Error()
+	}
+	if status.Circuit == CircuitOpen {
+		retryAt := fw.retryAt
+		status.RetryAt = &retryAt
+	}
+	return status
+}
+
+// MarkLoaded records that the current contents of the watched files were loaded outside the
+// watcher, for example by an initial or manual reload. It resets the backoff, and changes which
+// leave the contents as they are now no longer trigger a reload.
+func (fw *FileWatcher) MarkLoaded() {
+	hash := fw.contentHash()
+
+	fw.statusMu.Lock()
+	defer fw.statusMu.Unlock()
+	fw.loadedHash = &hash
+	fw.failures = 0
+	fw.lastErr = nil
+	fw.retryAt = time.Time{}
+}
+
+func (fw *FileWatcher) circuitLocked(now time.Time) CircuitState {
+	switch {
+	case fw.failures < fw.failureThreshold:
+		return CircuitClosed
+	case now.Before(fw.retryAt):
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// backoffRemaining returns how long reloads are still held back for.
+func (fw *FileWatcher) backoffRemaining(now time.Time) time.Duration {
+	fw.statusMu.Lock()
+	defer fw.statusMu.Unlock()
+
+	if fw.circuitLocked(now) != CircuitOpen {
+		return 0
+	}
+	return fw.retryAt.Sub(now)
+}
+
+// unchanged returns whether the watched files still have the contents hashed to hash when they were
+// last loaded. After a failed reload, which may have written part of its changes, nothing is
+// considered unchanged.
+func (fw *FileWatcher) unchanged(hash [sha256.Size]byte) bool {
+	fw.statusMu.Lock()
+	defer fw.statusMu.Unlock()
+	return fw.failures == 0 && fw.loadedHash != nil && *fw.loadedHash == hash
+}
+
+// recordResult updates the circuit breaker with the outcome of a reload of the contents hashed to hash.
+func (fw *FileWatcher) recordResult(hash [sha256.Size]byte, err error) {
+	fw.statusMu.Lock()
+	defer fw.statusMu.Unlock()
+
+	if err == nil {
+		if fw.failures >= fw.failureThreshold {
+			log.Ctx(fw.ctx).Info().Int("failures", fw.failures).Msg("schema reload succeeded, closing circuit")
+		}
+		fw.loadedHash = &hash
+		fw.failures = 0
+		fw.lastErr = nil
+		fw.retryAt = time.Time{}
+		return
+	}
+
+	fw.failures++
+	fw.lastErr = err
+	if fw.failures < fw.failureThreshold {
+		return
+	}
+
+	backoff := fw.backoff
+	for i := fw.failureThreshold; i < fw.failures && backoff < fw.maxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, fw.maxBackoff)
+	fw.retryAt = time.Now().Add(backoff)
+	log.Ctx(fw.ctx).Warn().Int("failures", fw.failures).Dur("backoff", backoff).Msg("schema reloads keep failing, holding back reloads")
+}
+
+// contentHash returns a hash of the paths and contents of the schema files, the files currently
+// matched by directories and patterns, and the dependencies. Missing files are hashed as such.
+func (fw *FileWatcher) contentHash() [sha256.Size]byte {
+	seen := make(map[string]struct{}, len(fw.absFiles))
+	for path := range fw.absFiles {
+		seen[path] = struct{}{}
+	}
+	for _, pattern := range fw.patterns {
+		matched, _ := pattern.Files()
+		for _, path := range matched {
+			seen[path] = struct{}{}
+		}
+	}
+	fw.depMu.Lock()
+	for path := range fw.deps {
+		seen[path] = struct{}{}
+	}
+	fw.depMu.Unlock()
+
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		_, _ = io.WriteString(h, path)
+		content, err := fw.readFile(path)
+		if err != nil {
+			_, _ = h.Write([]byte{0})
+			continue
+		}
+		contentSum := sha256.Sum256(content)
+		_, _ = h.Write([]byte{1})
+		_, _ = h.Write(contentSum[:])
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
@@ -0,0 +1,209 @@
+package watch
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// Mode selects how a FileWatcher detects changes.
+type Mode string
+
+const (
+	// ModeAuto uses file system notifications, falling back to polling when they cannot be set up.
+	ModeAuto Mode = "auto"
+
+	// ModeFSNotify uses file system notifications (inotify, kqueue, ReadDirectoryChangesW) only.
+	ModeFSNotify Mode = "fsnotify"
+
+	// ModePoll periodically compares the modification time, size and content hash of the files.
+	// Use it on bind mounts and network file systems which don't deliver notifications.
+	ModePoll Mode = "poll"
+)
+
+// DefaultPollInterval is the interval between polls when none is configured.
+const DefaultPollInterval = 1 * time.Second
+
+// Valid returns an error if the mode is not one of the known modes.
+func (m Mode) Valid() error {
+	switch m {
+	case ModeAuto, ModeFSNotify, ModePoll:
+		return nil
+	default:
+		return fmt.Errorf("unknown watch mode %q (supported: %s, %s, %s)", m, ModeAuto, ModeFSNotify, ModePoll)
+	}
+}
+
+// Option configures optional FileWatcher behavior.
+type Option func(*FileWatcher)
+
+// WithMode sets how the watcher detects changes, and the interval between polls when polling.
+// An empty mode or a zero interval keep the defaults: ModeAuto and DefaultPollInterval.
+func WithMode(mode Mode, pollInterval time.Duration) Option {
+	return func(fw *FileWatcher) {
+		if mode != "" {
+			fw.mode = mode
+		}
+		if pollInterval > 0 {
+			fw.pollInterval = pollInterval
+		}
+	}
+}
+
+// WithFS watches files within fsys, in the slash-separated form of fs.ValidPath, instead of files of
+// the operating system's file system. An fs.FS does not deliver change notifications, so the files
+// are polled; ModeFSNotify is rejected.
+func WithFS(fsys fs.FS) Option {
+	return func(fw *FileWatcher) {
+		fw.fsys = fsys
+	}
+}
+
+// pollState is the observed state of a polled file.
+type pollState struct {
+	exists  bool
+	modTime int64
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+func (fw *FileWatcher) startPolling() {
+	fw.snapshot = fw.poll()
+	log.Ctx(fw.ctx).Debug().Int("files", len(fw.snapshot)).Dur("interval", fw.pollInterval).Msg("polling schema files for changes")
+
+	fw.wg.Add(1)
+	go fw.pollLoop()
+}
+
+func (fw *FileWatcher) pollLoop() {
+	defer fw.wg.Done()
+
+	ticker := time.NewTicker(fw.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-fw.ctx.Done():
+			return
+
+		case <-ticker.C:
+			current := fw.poll()
+			for path, state := range current {
+				prev, ok := fw.snapshot[path]
+				switch {
+				case ok && prev != state:
+					fw.handleFileChange(path)
+				case !ok && !fw.isNamed(path):
+					// A new file matched by a directory or pattern. Files which were just named, i.e.
+					// new dependencies, were read by the reload which named them.
+					fw.handleFileChange(path)
+				}
+			}
+			for path, prev := range fw.snapshot {
+				if _, ok := current[path]; ok || !prev.exists {
+					continue
+				}
+				// A file which is no longer matched because it was deleted, rather than because it
+				// is no longer a dependency.
+				if _, err := fw.stat(path); err != nil {
+					fw.handleFileChange(path)
+				}
+			}
+			fw.snapshot = current
+		}
+	}
+}
+
+// isNamed returns whether path is one of the schema files or dependencies, which are polled whether
+// or not they exist.
+func (fw *FileWatcher) isNamed(path string) bool {
+	return fw.isWatchedFile(path) || fw.isDependency(path)
+}
+
+// poll returns the current state of the schema files, dependencies and files matched by patterns.
+func (fw *FileWatcher) poll() map[string]pollState {
+	states := make(map[string]pollState, len(fw.absFiles))
+	for path := range fw.absFiles {
+		states[path] = fw.statFile(path)
+	}
+
+	fw.depMu.Lock()
+	for path := range fw.deps {
+		states[path] = fw.statFile(path)
+	}
+	fw.depMu.Unlock()
+
+	for _, pattern := range fw.patterns {
+		_ = fw.walkDir(pattern.Base, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != pattern.Base && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if _, ok := states[path]; !ok && pattern.Match(path) {
+				states[path] = fw.statFile(path)
+			}
+			return nil
+		})
+	}
+	return states
+}
+
+// statFile returns the state of the file at path. The content hash catches changes which keep the
+// size and land within the modification time granularity of the file system.
+func (fw *FileWatcher) statFile(path string) pollState {
+	info, err := fw.stat(path)
+	if err != nil {
+		return pollState{}
+	}
+	content, err := fw.readFile(path)
+	if err != nil {
+		return pollState{}
+	}
+	return pollState{
+		exists:  true,
+		modTime: info.ModTime().UnixNano(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(content),
+	}
+}
+
+// abs returns the absolute path of a file of the operating system's file system. Paths within an
+// fs.FS are returned as is.
+func (fw *FileWatcher) abs(path string) (string, error) {
+	if fw.fsys != nil {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+func (fw *FileWatcher) stat(path string) (fs.FileInfo, error) {
+	if fw.fsys != nil {
+		return fs.Stat(fw.fsys, path)
+	}
+	return os.Stat(path)
+}
+
+func (fw *FileWatcher) readFile(path string) ([]byte, error) {
+	if fw.fsys != nil {
+		return fs.ReadFile(fw.fsys, path)
+	}
+	return os.ReadFile(path)
+}
+
+func (fw *FileWatcher) walkDir(root string, fn fs.WalkDirFunc) error {
+	if fw.fsys != nil {
+		return fs.WalkDir(fw.fsys, root, fn)
+	}
+	return filepath.WalkDir(root, fn)
+}
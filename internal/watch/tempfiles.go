@@ -0,0 +1,44 @@
+package watch
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// isEditorTempFile returns whether path is a swap, backup or temporary file written by an editor
+// while saving, rather than a file a user would edit.
+func isEditorTempFile(path string) bool {
+	name := filepath.Base(path)
+
+	switch {
+	case name == "4913":
+		// vim probes whether it may create files in the directory by writing "4913".
+		return true
+	case strings.HasSuffix(name, "~"):
+		// vim and emacs backups.
+		return true
+	case strings.HasPrefix(name, ".#"), strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"):
+		// emacs lock and auto-save files.
+		return true
+	case strings.Contains(name, "___jb_tmp___"), strings.Contains(name, "___jb_old___"):
+		// JetBrains IDE safe writes.
+		return true
+	case strings.HasPrefix(name, ".goutputstream-"):
+		// GLib (gedit and other GNOME editors) atomic writes.
+		return true
+	}
+
+	switch ext := filepath.Ext(name); ext {
+	case ".tmp", ".temp", ".bak", ".orig", ".crswap", ".swx":
+		return true
+	default:
+		return isVimSwapExt(ext)
+	}
+}
+
+// isVimSwapExt returns whether ext is a vim swap file extension: .swp, then .swo, .swn and so on
+// down to .swa when several swap files exist, optionally followed by an "x" for a temporary swap file.
+func isVimSwapExt(ext string) bool {
+	ext = strings.TrimSuffix(ext, "x")
+	return len(ext) == 4 && strings.HasPrefix(ext, ".sw") && ext[3] >= 'a' && ext[3] <= 'p'
+}
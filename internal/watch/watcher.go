@@ -2,62 +2,137 @@ package watch
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 
 	log "github.com/akoserwal/embedspicedb/internal/logging"
+	"github.com/akoserwal/embedspicedb/internal/schemafiles"
 )
 
 // FileWatcher watches schema files for changes and triggers reloads.
 type FileWatcher struct {
-	watcher    *fsnotify.Watcher
-	files      []string
-	absFiles   map[string]struct{}
-	reloadFunc func() error
-	debounce   time.Duration
-	mu         sync.Mutex
-	pending    map[string]time.Time
-	timer      *time.Timer
-	stopped    bool
-	ctx        context.Context
-	cancel     context.CancelFunc
-	wg         sync.WaitGroup
-}
-
-// NewFileWatcher creates a new file watcher.
-func NewFileWatcher(files []string, debounce time.Duration, reloadFunc func() error) (*FileWatcher, error) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return nil, err
-	}
+	watcher          *fsnotify.Watcher
+	files            []string
+	absFiles         map[string]struct{}
+	dirs             map[string][]string    // watched directory -> watched files within it
+	seen             map[string]os.FileInfo // last observed state of each file; only used by watchLoop
+	patterns         []schemafiles.Entry    // directory and glob entries, with absolute paths
+	treeDirs         map[string]struct{}    // directories watched below the patterns' bases; only used by watchLoop
+	depMu            sync.Mutex
+	deps             map[string]struct{} // GUARDED_BY(depMu)
+	depDirs          map[string]struct{} // GUARDED_BY(depMu)
+	mode             Mode
+	pollInterval     time.Duration
+	snapshot         map[string]pollState // last polled state of each file; only used by pollLoop
+	fsys             fs.FS                // file system the files are read from; nil for the operating system's
+	failureThreshold int
+	backoff          time.Duration
+	maxBackoff       time.Duration
+	statusMu         sync.Mutex
+	loadedHash       *[sha256.Size]byte // GUARDED_BY(statusMu); nil until the first successful reload
+	failures         int                // GUARDED_BY(statusMu)
+	lastErr          error              // GUARDED_BY(statusMu)
+	retryAt          time.Time          // GUARDED_BY(statusMu)
+	reloadFunc       func(changed []string) error
+	debounce         time.Duration
+	mu               sync.Mutex
+	pending          map[string]time.Time
+	timer            *time.Timer
+	stopped          bool
+	ctx              context.Context
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+}
 
+// NewFileWatcher creates a new file watcher. Files may also be directories, whose schema files are
+// watched recursively, or glob patterns; files created or removed below them trigger a reload.
+func NewFileWatcher(files []string, debounce time.Duration, reloadFunc func() error, opts ...Option) (*FileWatcher, error) {
+	return NewFileWatcherWithChanges(files, debounce, func([]string) error {
+		return reloadFunc()
+	}, opts...)
+}
+
+// NewFileWatcherWithChanges creates a new file watcher whose reload function receives the absolute
+// paths of the files which changed since the previous reload, sorted.
+func NewFileWatcherWithChanges(files []string, debounce time.Duration, reloadFunc func(changed []string) error, opts ...Option) (*FileWatcher, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	absFiles := make(map[string]struct{}, len(files))
+	fw := &FileWatcher{
+		files:            files,
+		absFiles:         make(map[string]struct{}, len(files)),
+		dirs:             make(map[string][]string),
+		seen:             make(map[string]os.FileInfo, len(files)),
+		treeDirs:         make(map[string]struct{}),
+		deps:             make(map[string]struct{}),
+		depDirs:          make(map[string]struct{}),
+		mode:             ModeAuto,
+		pollInterval:     DefaultPollInterval,
+		failureThreshold: DefaultFailureThreshold,
+		backoff:          DefaultBackoff,
+		maxBackoff:       DefaultMaxBackoff,
+		reloadFunc:       reloadFunc,
+		debounce:         debounce,
+		pending:          make(map[string]time.Time),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+	for _, opt := range opts {
+		opt(fw)
+	}
+
+	if fw.fsys != nil {
+		// An fs.FS does not deliver change notifications.
+		if fw.mode == ModeFSNotify {
+			cancel()
+			return nil, fmt.Errorf("watch mode %s is not supported for schema files in an fs.FS", ModeFSNotify)
+		}
+		fw.mode = ModePoll
+	}
+
 	for _, file := range files {
-		absPath, err := filepath.Abs(file)
+		entry, err := schemafiles.ParseFS(fw.fsys, file)
+		if err == nil {
+			entry, err = entry.Abs()
+		}
 		if err != nil {
 			cancel()
-			_ = watcher.Close()
 			return nil, fmt.Errorf("failed to get absolute path for %s: %w", file, err)
 		}
-		absFiles[absPath] = struct{}{}
+		if entry.Kind != schemafiles.KindFile {
+			fw.patterns = append(fw.patterns, entry)
+			continue
+		}
+
+		absPath := entry.Path
+		if _, ok := fw.absFiles[absPath]; ok {
+			continue
+		}
+		fw.absFiles[absPath] = struct{}{}
+		dir := filepath.Dir(absPath)
+		fw.dirs[dir] = append(fw.dirs[dir], absPath)
 	}
 
-	fw := &FileWatcher{
-		watcher:    watcher,
-		files:      files,
-		absFiles:   absFiles,
-		reloadFunc: reloadFunc,
-		debounce:   debounce,
-		pending:    make(map[string]time.Time),
-		ctx:        ctx,
-		cancel:     cancel,
+	if fw.mode != ModePoll {
+		watcher, err := fsnotify.NewWatcher()
+		switch {
+		case err == nil:
+			fw.watcher = watcher
+		case fw.mode == ModeAuto:
+			log.Ctx(fw.ctx).Warn().Err(err).Msg("failed to create file system watcher; polling schema files instead")
+		default:
+			cancel()
+			return nil, err
+		}
 	}
 
 	return fw, nil
@@ -65,27 +140,72 @@ func NewFileWatcher(files []string, debounce time.Duration, reloadFunc func() er
 
 // Start begins watching files for changes.
 func (fw *FileWatcher) Start() error {
-	// Prefer watching the file path directly (much cheaper on kqueue/macOS than watching a large directory).
-	// Fall back to watching the parent directory if the file does not exist yet.
-	for absPath := range fw.absFiles {
-		if _, err := os.Stat(absPath); err == nil {
-			if err := fw.watcher.Add(absPath); err != nil {
-				return fmt.Errorf("failed to watch file %s: %w", absPath, err)
-			}
-			log.Ctx(fw.ctx).Debug().Str("file", absPath).Msg("watching schema file for changes")
-			continue
+	if fw.watcher != nil {
+		err := fw.addWatches()
+		if err == nil {
+			fw.wg.Add(1)
+			go fw.watchLoop()
+			return nil
+		}
+		if fw.mode != ModeAuto {
+			return err
 		}
 
-		// File doesn't exist; watch the directory so we can detect when it is created.
-		dir := filepath.Dir(absPath)
+		// Watch limits are exhausted, or the file system does not support watches.
+		log.Ctx(fw.ctx).Warn().Err(err).Msg("failed to watch schema files; polling them instead")
+		_ = fw.watcher.Close()
+		fw.watcher = nil
+		fw.treeDirs = make(map[string]struct{})
+	}
+
+	fw.startPolling()
+	return nil
+}
+
+// Mode returns how the watcher detects changes: ModeFSNotify or ModePoll. Before Start, a watcher
+// in ModeAuto reports ModeFSNotify unless file system watches could not be set up at all.
+func (fw *FileWatcher) Mode() Mode {
+	if fw.watcher != nil {
+		return ModeFSNotify
+	}
+	return ModePoll
+}
+
+// addWatches adds the file system watches for the schema files and patterns.
+func (fw *FileWatcher) addWatches() error {
+	// Watch the parent directories rather than the files themselves: editors which save by writing a
+	// temporary file and renaming it over the original (vim, JetBrains IDEs, most atomic writers)
+	// replace the inode, which silently drops a watch on the file. A directory watch survives any
+	// number of replacements, and also detects files created after startup.
+	for dir := range fw.dirs {
 		if err := fw.watcher.Add(dir); err != nil {
 			return fmt.Errorf("failed to watch directory %s: %w", dir, err)
 		}
-		log.Ctx(fw.ctx).Debug().Str("dir", dir).Msg("watching directory for schema changes (file missing at startup)")
+		log.Ctx(fw.ctx).Debug().Str("dir", dir).Strs("files", fw.dirs[dir]).Msg("watching directory for schema changes")
 	}
 
-	fw.wg.Add(1)
-	go fw.watchLoop()
+	for absPath := range fw.absFiles {
+		if info, err := os.Stat(absPath); err == nil {
+			fw.seen[absPath] = info
+		}
+	}
+
+	// Directories and patterns are watched recursively from their base. A base which does not
+	// exist yet is picked up when it is created in its parent directory.
+	for _, pattern := range fw.patterns {
+		if _, err := os.Stat(pattern.Base); err != nil {
+			parent := filepath.Dir(pattern.Base)
+			if err := fw.watcher.Add(parent); err != nil {
+				return fmt.Errorf("failed to watch directory %s: %w", parent, err)
+			}
+			log.Ctx(fw.ctx).Debug().Str("dir", parent).Str("pattern", pattern.Path).Msg("watching directory for schema changes (base missing at startup)")
+			continue
+		}
+		if err := fw.addTree(pattern.Base); err != nil {
+			return err
+		}
+		log.Ctx(fw.ctx).Debug().Str("dir", pattern.Base).Str("pattern", pattern.Path).Msg("watching directory tree for schema changes")
+	}
 
 	return nil
 }
@@ -102,7 +222,10 @@ func (fw *FileWatcher) Stop() error {
 	fw.mu.Unlock()
 
 	fw.cancel()
-	err := fw.watcher.Close()
+	var err error
+	if fw.watcher != nil {
+		err = fw.watcher.Close()
+	}
 	fw.wg.Wait()
 	return err
 }
@@ -120,12 +243,7 @@ func (fw *FileWatcher) watchLoop() {
 				return
 			}
 
-			// Check if the event is for one of our watched files
-			if fw.isWatchedFile(event.Name) {
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-					fw.handleFileChange(event.Name)
-				}
-			}
+			fw.handleEvent(event)
 
 		case err, ok := <-fw.watcher.Errors:
 			if !ok {
@@ -141,6 +259,215 @@ func (fw *FileWatcher) isWatchedFile(path string) bool {
 	return ok
 }
 
+// SetDependencies replaces the additional files watched alongside the schema files, such as schema
+// files referenced by validation files. Changes to them trigger a reload like changes to the schema
+// files themselves. It may be called from the reload function.
+func (fw *FileWatcher) SetDependencies(files []string) error {
+	deps := make(map[string]struct{}, len(files))
+	dirs := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		absPath, err := fw.abs(file)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path for %s: %w", file, err)
+		}
+		if fw.isWatchedFile(absPath) {
+			continue
+		}
+		deps[absPath] = struct{}{}
+		dirs[filepath.Dir(absPath)] = struct{}{}
+	}
+
+	fw.depMu.Lock()
+	defer fw.depMu.Unlock()
+
+	if fw.ctx.Err() != nil {
+		return nil
+	}
+	if fw.watcher == nil {
+		// The poll loop picks the dependencies up on its next poll.
+		fw.deps = deps
+		return nil
+	}
+
+	// Dependencies are watched through their parent directories, like the schema files. Directories
+	// which are watched for the schema files or patterns are left alone.
+	var errs []error
+	for dir := range dirs {
+		if _, ok := fw.depDirs[dir]; ok || fw.watchesDir(dir) {
+			continue
+		}
+		if err := fw.watcher.Add(dir); err != nil {
+			errs = append(errs, fmt.Errorf("failed to watch directory %s: %w", dir, err))
+			delete(dirs, dir)
+			continue
+		}
+		log.Ctx(fw.ctx).Debug().Str("dir", dir).Msg("watching directory for schema dependency changes")
+	}
+	for dir := range fw.depDirs {
+		if _, ok := dirs[dir]; ok || fw.watchesDir(dir) {
+			continue
+		}
+		_ = fw.watcher.Remove(dir)
+	}
+
+	fw.deps = deps
+	fw.depDirs = dirs
+	return errors.Join(errs...)
+}
+
+func (fw *FileWatcher) isDependency(path string) bool {
+	fw.depMu.Lock()
+	defer fw.depMu.Unlock()
+	_, ok := fw.deps[path]
+	return ok
+}
+
+// watchesDir returns whether dir is watched for the schema files or patterns.
+func (fw *FileWatcher) watchesDir(dir string) bool {
+	_, ok := fw.dirs[dir]
+	return ok || fw.inPatternTree(dir)
+}
+
+// handleEvent handles an event in one of the watched directories.
+func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
+	switch {
+	case fw.isWatchedFile(event.Name) || fw.isDependency(event.Name):
+		// Permission and timestamp changes don't change the schema.
+		if event.Op == fsnotify.Chmod {
+			return
+		}
+		// Rename and Remove are the first half of a replace: the file is reloaded once it is back.
+		if info, err := os.Stat(event.Name); err == nil {
+			fw.seen[event.Name] = info
+		} else {
+			delete(fw.seen, event.Name)
+		}
+		fw.handleFileChange(event.Name)
+
+	case isEditorTempFile(event.Name):
+		// Swap, backup and temporary files written while saving; the final rename is a separate event.
+
+	case fw.dirs[event.Name] != nil:
+		// The watched directory itself was removed or renamed, which drops its watch.
+		if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+			log.Ctx(fw.ctx).Warn().Str("dir", event.Name).Msg("watched schema directory was removed; hot reload stopped for its files")
+		}
+
+	case event.Has(fsnotify.Create) && fw.inPatternTree(event.Name) && !strings.HasPrefix(filepath.Base(event.Name), ".") && isDir(event.Name):
+		// A new directory below a pattern's base: watch it, and pick up the files it already contains,
+		// which were created before the watch.
+		if err := fw.addTree(event.Name); err != nil {
+			log.Ctx(fw.ctx).Warn().Err(err).Str("dir", event.Name).Msg("failed to watch new schema directory")
+		}
+		for _, file := range fw.matchingFilesIn(event.Name) {
+			fw.handleFileChange(file)
+		}
+
+	case fw.matchesPattern(event.Name):
+		if event.Op == fsnotify.Chmod {
+			return
+		}
+		fw.handleFileChange(event.Name)
+
+	case fw.isTreeDir(event.Name) && (event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename)):
+		// A directory below a pattern's base went away, possibly along with matching files.
+		for dir := range fw.treeDirs {
+			if dir == event.Name || strings.HasPrefix(dir, event.Name+string(filepath.Separator)) {
+				_ = fw.watcher.Remove(dir)
+				delete(fw.treeDirs, dir)
+			}
+		}
+		fw.handleFileChange(event.Name)
+
+	default:
+		// Another entry of the directory changed. Files may be symlinks whose target was swapped
+		// (e.g. Kubernetes ConfigMap volumes replace a `..data` symlink), so check whether the
+		// watched files of this directory now resolve to different contents.
+		for _, file := range fw.dirs[filepath.Dir(event.Name)] {
+			if fw.replaced(file) {
+				fw.handleFileChange(file)
+			}
+		}
+	}
+}
+
+func (fw *FileWatcher) matchesPattern(path string) bool {
+	for _, pattern := range fw.patterns {
+		if pattern.Match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// inPatternTree returns whether path is a pattern's base, or lies below one.
+func (fw *FileWatcher) inPatternTree(path string) bool {
+	for _, pattern := range fw.patterns {
+		if path == pattern.Base || strings.HasPrefix(path, pattern.Base+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (fw *FileWatcher) isTreeDir(path string) bool {
+	_, ok := fw.treeDirs[path]
+	return ok
+}
+
+// addTree watches root and every directory below it, skipping hidden directories.
+func (fw *FileWatcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := fw.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch directory %s: %w", path, err)
+		}
+		fw.treeDirs[path] = struct{}{}
+		return nil
+	})
+}
+
+// matchingFilesIn returns the files below dir matched by a pattern.
+func (fw *FileWatcher) matchingFilesIn(dir string) []string {
+	var files []string
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && fw.matchesPattern(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// replaced returns whether the file now resolves to a different file, or was modified, since it was
+// last observed.
+func (fw *FileWatcher) replaced(file string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+
+	prev, ok := fw.seen[file]
+	fw.seen[file] = info
+	if !ok {
+		return true
+	}
+	return !os.SameFile(prev, info) || !prev.ModTime().Equal(info.ModTime()) || prev.Size() != info.Size()
+}
+
 func (fw *FileWatcher) handleFileChange(filePath string) {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
@@ -157,36 +484,73 @@ func (fw *FileWatcher) handleFileChange(filePath string) {
 		fw.timer.Stop()
 	}
 
-	// Set up debounced reload
-	fw.timer = time.AfterFunc(fw.debounce, func() {
-		select {
-		case <-fw.ctx.Done():
-			return
-		default:
-		}
+	// Set up debounced reload, held back while the circuit is open
+	delay := fw.debounce
+	if wait := fw.backoffRemaining(now); wait > delay {
+		delay = wait
+	}
+	fw.timer = time.AfterFunc(delay, fw.reloadPending)
+}
 
-		fw.mu.Lock()
-		defer fw.mu.Unlock()
+// reloadPending reloads the pending changes once they settled.
+func (fw *FileWatcher) reloadPending() {
+	select {
+	case <-fw.ctx.Done():
+		return
+	default:
+	}
 
-		if fw.stopped {
-			return
-		}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.stopped {
+		return
+	}
+
+	// Check if there are still pending changes
+	if len(fw.pending) == 0 {
+		return
+	}
+
+	// The circuit may have opened while the changes were debounced
+	if wait := fw.backoffRemaining(time.Now()); wait > 0 {
+		fw.timer = time.AfterFunc(wait, fw.reloadPending)
+		return
+	}
+
+	changed := fw.getPendingFiles()
+
+	// Clear pending
+	fw.pending = make(map[string]time.Time)
 
-		// Check if there are still pending changes
-		if len(fw.pending) == 0 {
+	// A file which was renamed away or removed and not replaced within the debounce interval is
+	// reloaded when it is created again.
+	for _, file := range changed {
+		if !fw.isWatchedFile(file) && !fw.isDependency(file) {
+			// Files matched by directories and patterns may come and go.
+			continue
+		}
+		if _, err := fw.stat(file); err != nil {
+			log.Ctx(fw.ctx).Info().Str("file", file).Msg("schema file removed, waiting for it to be recreated")
 			return
 		}
+	}
 
-		log.Ctx(fw.ctx).Info().Strs("files", fw.getPendingFiles()).Msg("schema files changed, reloading")
+	// Saves without changes and tools touching the files don't warrant a schema write
+	hash := fw.contentHash()
+	if fw.unchanged(hash) {
+		log.Ctx(fw.ctx).Debug().Strs("files", changed).Msg("schema files unchanged, skipping reload")
+		return
+	}
 
-		// Clear pending
-		fw.pending = make(map[string]time.Time)
+	log.Ctx(fw.ctx).Info().Strs("files", changed).Msg("schema files changed, reloading")
 
-		// Trigger reload
-		if err := fw.reloadFunc(); err != nil {
-			log.Ctx(fw.ctx).Error().Err(err).Msg("failed to reload schema")
-		}
-	})
+	// Trigger reload
+	err := fw.reloadFunc(changed)
+	if err != nil {
+		log.Ctx(fw.ctx).Error().Err(err).Msg("failed to reload schema")
+	}
+	fw.recordResult(hash, err)
 }
 
 func (fw *FileWatcher) getPendingFiles() []string {
@@ -194,5 +558,6 @@ func (fw *FileWatcher) getPendingFiles() []string {
 	for file := range fw.pending {
 		files = append(files, file)
 	}
+	sort.Strings(files)
 	return files
 }
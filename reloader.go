@@ -1,6 +1,9 @@
 package embedspicedb
 
 import (
+	"io/fs"
+	"net/http"
+
 	"google.golang.org/grpc"
 
 	internalschema "github.com/akoserwal/embedspicedb/internal/schema"
@@ -10,12 +13,133 @@ import (
 // It is kept in the root package for backwards compatibility, while the implementation lives in `internal/schema`.
 type SchemaReloader = internalschema.SchemaReloader
 
+// ReloaderOption configures optional SchemaReloader behavior.
+type ReloaderOption = internalschema.ReloaderOption
+
+// SeedPolicy controls how relationships declared in YAML validation files are applied on reload.
+type SeedPolicy = internalschema.SeedPolicy
+
+const (
+	// SeedPolicyTouch touches every declared relationship, merging them with existing relationships.
+	SeedPolicyTouch = internalschema.SeedPolicyTouch
+
+	// SeedPolicyReplace deletes existing relationships which are not declared in any file.
+	SeedPolicyReplace = internalschema.SeedPolicyReplace
+)
+
+// SchemaError is a schema compilation or template error, located in the schema file it originates from.
+type SchemaError = internalschema.SchemaError
+
+// ValidationReport holds the results of evaluating the assertions and expected relations of all
+// YAML validation files after a reload.
+type ValidationReport = internalschema.ValidationReport
+
+// AssertionResult is the outcome of a single assertion or expected relation.
+type AssertionResult = internalschema.AssertionResult
+
+// ValidationError is returned by reloads which wrote the schema but failed some of the assertions or
+// expected relations in the validation files. Use errors.As to access the full report. The file
+// watcher does not count these reloads as failed.
+type ValidationError = internalschema.ValidationError
+
+// ReloadResult describes the outcome of a reload: the schema diff, the assertion results and the
+// revision at which the schema was written.
+type ReloadResult = internalschema.ReloadResult
+
+// SchemaDiff lists the differences between the stored schema and a reloaded schema.
+type SchemaDiff = internalschema.SchemaDiff
+
+// SchemaChange is a single difference between the stored schema and a reloaded schema.
+type SchemaChange = internalschema.SchemaChange
+
+// SchemaChangeKind describes how a schema element changed: added, removed or changed.
+type SchemaChangeKind = internalschema.SchemaChangeKind
+
+// SchemaElement is the kind of schema element which changed: definition, relation, permission or caveat.
+type SchemaElement = internalschema.SchemaElement
+
+const (
+	SchemaChangeAdded   = internalschema.SchemaChangeAdded
+	SchemaChangeRemoved = internalschema.SchemaChangeRemoved
+	SchemaChangeChanged = internalschema.SchemaChangeChanged
+
+	SchemaElementDefinition = internalschema.SchemaElementDefinition
+	SchemaElementRelation   = internalschema.SchemaElementRelation
+	SchemaElementPermission = internalschema.SchemaElementPermission
+	SchemaElementCaveat     = internalschema.SchemaElementCaveat
+)
+
+// DestructiveChangePolicy controls what a reload does when the new schema removes definitions,
+// relations, permissions or caveats, or narrows the subject types allowed on a relation.
+type DestructiveChangePolicy = internalschema.DestructiveChangePolicy
+
+const (
+	// DestructiveChangesAllow writes destructive changes without comment.
+	DestructiveChangesAllow = internalschema.DestructiveChangesAllow
+
+	// DestructiveChangesWarn writes destructive changes and logs each of them.
+	DestructiveChangesWarn = internalschema.DestructiveChangesWarn
+
+	// DestructiveChangesBlock refuses to write a schema containing destructive changes.
+	DestructiveChangesBlock = internalschema.DestructiveChangesBlock
+)
+
+// DestructiveChangeError is returned by reloads blocked by DestructiveChangesBlock.
+type DestructiveChangeError = internalschema.DestructiveChangeError
+
+// WithDestructiveChangePolicy sets what a reload does when the new schema removes elements of the
+// stored schema. Defaults to DestructiveChangesWarn.
+func WithDestructiveChangePolicy(policy DestructiveChangePolicy) ReloaderOption {
+	return internalschema.WithDestructiveChangePolicy(policy)
+}
+
+// WithRelationshipSeeding applies the relationships declared in YAML validation files after each
+// schema write, according to the given policy.
+func WithRelationshipSeeding(policy SeedPolicy) ReloaderOption {
+	return internalschema.WithRelationshipSeeding(policy)
+}
+
+// WithSchemaFS reads the schema files from fsys, such as an embed.FS, instead of the operating
+// system's file system. The schema files, and the files referenced by validation files, are then
+// paths within fsys.
+func WithSchemaFS(fsys fs.FS) ReloaderOption {
+	return internalschema.WithFS(fsys)
+}
+
+// WithSchemaURLs reads schemas served at HTTP(S) URLs in addition to the schema files, fetching
+// them with client. A nil client uses a client with a 10 second timeout. Once fetched, a schema is
+// revalidated with a conditional request on every reload.
+func WithSchemaURLs(client *http.Client, urls ...string) ReloaderOption {
+	return internalschema.WithURLs(client, urls)
+}
+
+// WithSchemaVars renders the schema text of every local schema file as a Go text/template before
+// compiling it, with vars as the template's data: `{{ .name }}` is replaced by vars["name"], and
+// `{{ env "NAME" }}` by the environment variable NAME. Schemas fetched from URLs are not rendered.
+// A nil map disables templating.
+func WithSchemaVars(vars map[string]any) ReloaderOption {
+	return internalschema.WithTemplateVars(vars)
+}
+
 // NewSchemaReloader creates a new schema reloader.
-func NewSchemaReloader(conn *grpc.ClientConn, schemaFiles []string) *SchemaReloader {
-	return internalschema.NewSchemaReloader(conn, schemaFiles)
+func NewSchemaReloader(conn *grpc.ClientConn, schemaFiles []string, opts ...ReloaderOption) *SchemaReloader {
+	return internalschema.NewSchemaReloader(conn, schemaFiles, opts...)
 }
 
 // ReadSchemaFile reads a single schema file, handling both .zed and .yaml formats.
 func ReadSchemaFile(filePath string) (string, error) {
 	return internalschema.ReadSchemaFile(filePath)
 }
+
+// ReadSchemaFileFS reads a single schema file from fsys, handling both .zed and .yaml formats.
+// A `schemaFile` referenced by a YAML file is read from fsys as well.
+func ReadSchemaFileFS(fsys fs.FS, filePath string) (string, error) {
+	return internalschema.ReadSchemaFileFS(fsys, filePath)
+}
+
+// RenderSchemaFile reads a single schema file from fsys, like ReadSchemaFileFS, and renders it as a
+// template with vars as data, like WithSchemaVars. Use it to inspect what a templated schema file
+// renders to. A nil fsys is the operating system's file system.
+func RenderSchemaFile(fsys fs.FS, filePath string, vars map[string]any) (string, error) {
+	return internalschema.RenderSchemaFile(fsys, filePath, vars)
+}
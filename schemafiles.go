@@ -0,0 +1,138 @@
+package embedspicedb
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// SchemaFiles returns the schema files, directories and patterns the server reads the schema from:
+// Config.SchemaFiles, as updated by AddSchemaFiles, RemoveSchemaFiles and SetSchemaFiles.
+func (es *EmbeddedServer) SchemaFiles() []string {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	return slices.Clone(es.config.SchemaFiles)
+}
+
+// AddSchemaFiles adds schema files, directories or patterns to the schema files, watches them and
+// reloads the schema. Entries which are already configured are skipped.
+func (es *EmbeddedServer) AddSchemaFiles(ctx context.Context, files ...string) error {
+	return es.updateSchemaFiles(ctx, func(current []string) ([]string, error) {
+		updated := slices.Clone(current)
+		for _, file := range files {
+			if indexSchemaFile(es.config.SchemaFS, updated, file) < 0 {
+				updated = append(updated, file)
+			}
+		}
+		return updated, nil
+	})
+}
+
+// RemoveSchemaFiles removes schema files, directories or patterns from the schema files, stops
+// watching them and reloads the schema. It fails without changing anything if one of them is not
+// configured.
+func (es *EmbeddedServer) RemoveSchemaFiles(ctx context.Context, files ...string) error {
+	return es.updateSchemaFiles(ctx, func(current []string) ([]string, error) {
+		updated := slices.Clone(current)
+		for _, file := range files {
+			i := indexSchemaFile(es.config.SchemaFS, updated, file)
+			if i < 0 {
+				return nil, fmt.Errorf("schema file %s is not configured", file)
+			}
+			updated = slices.Delete(updated, i, i+1)
+		}
+		return updated, nil
+	})
+}
+
+// SetSchemaFiles replaces the schema files, directories and patterns, watches them instead of the
+// previous ones and reloads the schema.
+func (es *EmbeddedServer) SetSchemaFiles(ctx context.Context, files []string) error {
+	return es.updateSchemaFiles(ctx, func([]string) ([]string, error) {
+		return slices.Clone(files), nil
+	})
+}
+
+// updateSchemaFiles replaces the schema files with the result of update. The reloader and the
+// watcher are switched to the new files together, then the schema is reloaded from them. Before
+// Start, only the configuration is updated. Without schema files or URLs, there is nothing to reload
+// and the stored schema is left as is.
+func (es *EmbeddedServer) updateSchemaFiles(ctx context.Context, update func(current []string) ([]string, error)) error {
+	es.mu.Lock()
+	previous := es.config.SchemaFiles
+	files, err := update(previous)
+	if err == nil {
+		err = validateSchemaFiles(es.config.SchemaFS, files)
+	}
+	if err != nil {
+		es.mu.Unlock()
+		return err
+	}
+
+	changed := changedSchemaFiles(es.config.SchemaFS, previous, files)
+	es.config.SchemaFiles = files
+	if !es.started || es.stopping || len(changed) == 0 {
+		es.mu.Unlock()
+		return nil
+	}
+
+	es.reloader.SetFiles(files)
+	previousWatcher := es.watcher
+	es.watcher = es.startWatcher(es.ctx, files)
+	reload := len(files) > 0 || len(es.urlSources) > 0
+	es.mu.Unlock()
+
+	// Stopped outside es.mu: a reload it triggered may be waiting for es.mu, holding up Stop.
+	if previousWatcher != nil {
+		if err := previousWatcher.Stop(); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("error stopping file watcher")
+		}
+	}
+
+	log.Ctx(ctx).Info().Strs("files", files).Strs("changed", changed).Msg("schema files changed")
+	if !reload {
+		return nil
+	}
+	return es.reloadFromFiles(ctx, ReloadTriggerSchemaFiles, changed)
+}
+
+// changedSchemaFiles returns the entries of previous and files which are not in both.
+func changedSchemaFiles(fsys fs.FS, previous, files []string) []string {
+	var changed []string
+	for _, file := range previous {
+		if indexSchemaFile(fsys, files, file) < 0 {
+			changed = append(changed, file)
+		}
+	}
+	for _, file := range files {
+		if indexSchemaFile(fsys, previous, file) < 0 {
+			changed = append(changed, file)
+		}
+	}
+	return changed
+}
+
+// indexSchemaFile returns the index of the entry of files which names the same file, directory or
+// pattern as file, or -1.
+func indexSchemaFile(fsys fs.FS, files []string, file string) int {
+	key := schemaFileKey(fsys, file)
+	return slices.IndexFunc(files, func(f string) bool {
+		return schemaFileKey(fsys, f) == key
+	})
+}
+
+// schemaFileKey returns the canonical form of a schema file entry.
+func schemaFileKey(fsys fs.FS, file string) string {
+	if fsys != nil {
+		return path.Clean(file)
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		return abs
+	}
+	return file
+}
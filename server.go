@@ -2,17 +2,30 @@ package embedspicedb
 
 import (
 	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 	"strings"
 	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
+	"github.com/akoserwal/embedspicedb/internal/datastore/common"
 	"github.com/akoserwal/embedspicedb/internal/datastore/memdb"
+	"github.com/akoserwal/embedspicedb/internal/datastore/sqlite"
+	"github.com/akoserwal/embedspicedb/internal/gateway"
+	"github.com/akoserwal/embedspicedb/internal/grpcfront"
 	"github.com/akoserwal/embedspicedb/internal/healthhttp"
+	"github.com/akoserwal/embedspicedb/internal/httpsource"
 	log "github.com/akoserwal/embedspicedb/internal/logging"
+	internalschema "github.com/akoserwal/embedspicedb/internal/schema"
+	"github.com/akoserwal/embedspicedb/internal/socket"
+	"github.com/akoserwal/embedspicedb/internal/tlsconfig"
 	"github.com/authzed/spicedb/pkg/cmd/server"
 	"github.com/authzed/spicedb/pkg/cmd/util"
 	"github.com/authzed/spicedb/pkg/datastore"
@@ -23,13 +36,25 @@ type EmbeddedServer struct {
 	config          Config
 	server          server.RunnableServer
 	datastore       datastore.Datastore
+	ownsDatastore   bool
 	reloader        *SchemaReloader
 	watcher         *FileWatcher
+	urlSources      []*httpsource.Source
+	urlPoller       *httpsource.Poller
 	conn            *grpc.ClientConn
 	reloadCallbacks []func(error)
+	resultCallbacks []func(*ReloadResult, error)
+	eventCallbacks  []func(ReloadEvent)
+	history         *schemaHistory
 	healthSrv       *healthhttp.Server
+	gatewaySrv      *gateway.Server
+	front           *grpcfront.Front
+	tls             *tlsconfig.Server
 	mu              sync.RWMutex
+	schemaMu        sync.Mutex // serializes schema writes with their history entries
 	started         bool
+	stopping        bool // set while Shutdown drains the server
+	calls           *callTracker
 	startTime       *time.Time
 	ctx             context.Context
 	cancel          context.CancelFunc
@@ -43,8 +68,8 @@ func New(config Config) (*EmbeddedServer, error) {
 		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
-	// Create datastore based on configuration
-	ds, err := createDatastore(context.Background(), config)
+	// Use the caller's datastore if one was supplied, otherwise create one based on configuration
+	ds, ownsDatastore, err := resolveDatastore(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create datastore: %w", err)
 	}
@@ -54,14 +79,44 @@ func New(config Config) (*EmbeddedServer, error) {
 	es := &EmbeddedServer{
 		config:          config,
 		datastore:       ds,
+		ownsDatastore:   ownsDatastore,
 		reloadCallbacks: make([]func(error), 0),
+		history:         newSchemaHistory(config.SchemaHistorySize),
+		calls:           newCallTracker(),
 		ctx:             ctx,
 		cancel:          cancel,
 	}
+	for _, u := range config.SchemaURLs {
+		es.urlSources = append(es.urlSources, httpsource.New(u, config.SchemaHTTPClient))
+	}
 
 	return es, nil
 }
 
+// resolveDatastore returns the datastore to serve and whether the server owns it, and is therefore
+// responsible for closing it on Stop. Datastores supplied through Config.Datastore remain owned by
+// the caller.
+func resolveDatastore(ctx context.Context, config Config) (datastore.Datastore, bool, error) {
+	switch {
+	case config.Datastore != nil:
+		return config.Datastore, false, nil
+
+	case config.DatastoreFactory != nil:
+		ds, err := config.DatastoreFactory(ctx, config)
+		if err != nil {
+			return nil, false, err
+		}
+		if ds == nil {
+			return nil, false, fmt.Errorf("DatastoreFactory returned a nil datastore")
+		}
+		return ds, true, nil
+
+	default:
+		ds, err := createDatastore(ctx, config)
+		return ds, true, err
+	}
+}
+
 // createDatastore creates the appropriate datastore based on configuration.
 func createDatastore(ctx context.Context, config Config) (datastore.Datastore, error) {
 	datastoreType := strings.ToLower(config.DatastoreType)
@@ -71,6 +126,16 @@ func createDatastore(ctx context.Context, config Config) (datastore.Datastore, e
 
 	switch datastoreType {
 	case "memdb":
+		if config.DataDirectory != "" {
+			// Create in-memory datastore persisted to disk
+			return memdb.NewPersistentMemdbDatastore(
+				config.DataDirectory,
+				config.WatchBufferLength,
+				config.RevisionQuantization,
+				config.GCWindow,
+			)
+		}
+
 		// Create in-memory datastore
 		return memdb.NewMemdbDatastore(
 			config.WatchBufferLength,
@@ -78,6 +143,15 @@ func createDatastore(ctx context.Context, config Config) (datastore.Datastore, e
 			config.GCWindow,
 		)
 
+	case "sqlite":
+		// Create single-file datastore persisted at DatastoreURI
+		return sqlite.NewSQLiteDatastore(
+			ctx,
+			config.DatastoreURI,
+			config.WatchBufferLength,
+			config.GCWindow,
+		)
+
 	case "postgres", "postgresql":
 		return nil, fmt.Errorf("PostgreSQL datastore is not available in standalone embedspicedb. Use memdb for development, or use embedspicedb within the SpiceDB module context for persistent datastores")
 
@@ -85,12 +159,52 @@ func createDatastore(ctx context.Context, config Config) (datastore.Datastore, e
 		return nil, fmt.Errorf("MySQL datastore is not available in standalone embedspicedb. Use memdb for development, or use embedspicedb within the SpiceDB module context for persistent datastores")
 
 	default:
-		return nil, fmt.Errorf("unsupported datastore type: %s (supported: memdb, postgres, mysql)", config.DatastoreType)
+		return nil, fmt.Errorf("unsupported datastore type: %s (supported: memdb, sqlite, postgres, mysql)", config.DatastoreType)
 	}
 }
 
+// gcTimeout bounds the duration of a single datastore garbage collection run.
+const gcTimeout = 1 * time.Minute
+
+// gcMetricsOnce guards registration of the process-wide GC metrics, which can only be
+// registered once even when several servers are embedded.
+var gcMetricsOnce sync.Once
+
+// startGarbageCollector runs datastore garbage collection in the background until the server
+// is stopped, if the datastore supports it.
+func (es *EmbeddedServer) startGarbageCollector(ctx context.Context) {
+	collectable, ok := es.datastore.(common.GarbageCollectableDatastore)
+	if !ok {
+		return
+	}
+
+	gcMetricsOnce.Do(func() {
+		if _, err := common.RegisterGCMetrics(); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("failed to register datastore garbage collection metrics")
+		}
+	})
+
+	es.wg.Add(1)
+	go func() {
+		defer es.wg.Done()
+		err := common.StartGarbageCollector(es.ctx, collectable, es.config.GCInterval, es.config.GCWindow, gcTimeout)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Ctx(es.ctx).Error().Err(err).Msg("datastore garbage collection stopped")
+		}
+	}()
+}
+
 // Start starts the server and begins watching schema files for changes.
 func (es *EmbeddedServer) Start(ctx context.Context) error {
+	// The startup reload event is emitted once es.mu is released (deferred calls run in reverse order),
+	// so callbacks may call back into the server.
+	var startupEvent *ReloadEvent
+	defer func() {
+		if startupEvent != nil {
+			es.emitReloadEvent(*startupEvent)
+		}
+	}()
+
 	es.mu.Lock()
 	defer es.mu.Unlock()
 
@@ -98,18 +212,39 @@ func (es *EmbeddedServer) Start(ctx context.Context) error {
 		return fmt.Errorf("server is already started")
 	}
 
+	// Load the certificates every listener serves
+	if es.config.tlsEnabled() {
+		tlsServer, err := tlsconfig.New(tlsconfig.Files{
+			CertFile:     es.config.TLSCertFile,
+			KeyFile:      es.config.TLSKeyFile,
+			ClientCAFile: es.config.TLSClientCAFile,
+		}, es.config.TLSConfig)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS configuration: %w", err)
+		}
+		es.tls = tlsServer
+	}
+
+	// Listen on GRPCAddress; the front forwards the calls it accepts to SpiceDB, served in memory
+	front, err := es.listenGRPC()
+	if err != nil {
+		return err
+	}
+	es.front = front
+
 	// Create server configuration
-	serverConfig := server.NewConfigWithOptionsAndDefaults(
+	options := []server.ConfigOption{
 		server.WithDatastore(es.datastore),
 		server.WithPresharedSecureKey(es.config.PresharedKey),
+		// Served over bufconn; the server's dialer, used by dialWithRetry, connects to it in-process
 		server.WithGRPCServer(util.GRPCServerConfig{
-			Address: es.config.GRPCAddress,
-			Network: "tcp",
-			Enabled: true,
+			Network:    util.BufferedNetwork,
+			BufferSize: inMemoryBufferSize,
+			Enabled:    true,
 		}),
+		// The HTTP gateway is served by startGateway, which can listen on unix domain sockets.
 		server.WithHTTPGateway(util.HTTPServerConfig{
-			HTTPEnabled: es.config.HTTPEnabled,
-			HTTPAddress: es.config.HTTPAddress,
+			HTTPEnabled: false,
 		}),
 		server.WithMetricsAPI(util.HTTPServerConfig{
 			HTTPEnabled: false,
@@ -117,11 +252,18 @@ func (es *EmbeddedServer) Start(ctx context.Context) error {
 		server.WithDispatchServer(util.GRPCServerConfig{
 			Enabled: false,
 		}),
-	)
+	}
+	// Track the calls in flight, so Shutdown can terminate them
+	options = append(options, es.calls.serverOptions()...)
+	if front != nil {
+		options = append(options, frontServerOptions(front)...)
+	}
+	serverConfig := server.NewConfigWithOptionsAndDefaults(options...)
 
 	// Complete server configuration
 	srv, err := serverConfig.Complete(ctx)
 	if err != nil {
+		es.closeGRPCListener()
 		return fmt.Errorf("failed to complete server configuration: %w", err)
 	}
 	es.server = srv
@@ -138,38 +280,66 @@ func (es *EmbeddedServer) Start(ctx context.Context) error {
 	// Get client connection with retry/backoff
 	conn, err := es.dialWithRetry(ctx)
 	if err != nil {
-		es.cancel()
-		es.wg.Wait()
+		es.abortStart()
 		return fmt.Errorf("failed to dial server: %w", err)
 	}
 	es.conn = conn
+	if es.front != nil {
+		es.front.Serve(conn)
+	}
+
+	if err := es.startGateway(ctx); err != nil {
+		es.abortStart()
+		return fmt.Errorf("failed to start HTTP gateway: %w", err)
+	}
+
+	es.startGarbageCollector(ctx)
 
 	// Create schema reloader
-	es.reloader = NewSchemaReloader(conn, es.config.SchemaFiles)
+	var reloaderOpts []ReloaderOption
+	if es.config.SeedRelationships {
+		reloaderOpts = append(reloaderOpts, WithRelationshipSeeding(es.config.SeedPolicy))
+	}
+	reloaderOpts = append(reloaderOpts, WithDestructiveChangePolicy(es.config.DestructiveChangePolicy))
+	if es.config.SchemaFS != nil {
+		reloaderOpts = append(reloaderOpts, WithSchemaFS(es.config.SchemaFS))
+	}
+	if es.config.SchemaVars != nil {
+		reloaderOpts = append(reloaderOpts, WithSchemaVars(es.config.SchemaVars))
+	}
+	if len(es.urlSources) > 0 {
+		// The poller shares the sources, so reloads revalidate the schemas it fetched
+		reloaderOpts = append(reloaderOpts, internalschema.WithURLSources(es.urlSources))
+	}
+	es.reloader = NewSchemaReloader(conn, es.config.SchemaFiles, reloaderOpts...)
+
+	// Initial schema load if files or URLs are provided
+	var startupResult *ReloadResult
+	if len(es.config.SchemaFiles) > 0 || len(es.urlSources) > 0 {
+		result, event := es.reloadSchema(ctx, es.reloader, ReloadTriggerStartup, nil)
+		startupResult = result
+		if event.Err != nil {
+			log.Ctx(ctx).Warn().Err(event.Err).Msg("failed to load initial schema")
+		}
+		startupEvent = &event
+	}
 
-	// Initial schema load if files are provided
-	if len(es.config.SchemaFiles) > 0 {
-		if err := es.reloader.Reload(ctx); err != nil {
-			log.Ctx(ctx).Warn().Err(err).Msg("failed to load initial schema")
+	// Start file watcher if schema files are configured, and can change
+	es.watcher = es.startWatcher(ctx, es.config.SchemaFiles)
+	if es.watcher != nil {
+		es.watchDependencies(ctx, es.watcher, startupResult)
+		if startupEvent != nil && schemaWritten(startupEvent.Err) {
+			es.watcher.MarkLoaded()
 		}
 	}
 
-	// Start file watcher if schema files are configured
-	if len(es.config.SchemaFiles) > 0 {
-		watcher, err := NewFileWatcher(es.config.SchemaFiles, es.config.WatchDebounce, func() error {
-			return es.ReloadSchema(ctx)
+	// Poll schema URLs, reloading through the same pipeline as file changes
+	if len(es.urlSources) > 0 {
+		es.urlPoller = httpsource.NewPoller(es.urlSources, es.config.SchemaURLPollInterval, func(changed []string) error {
+			return writeError(es.reloadFromFiles(ctx, ReloadTriggerURL, changed))
 		})
-		if err != nil {
-			// File watching is an optional convenience; don't fail server startup if it can't be created.
-			log.Ctx(ctx).Warn().Err(err).Strs("files", es.config.SchemaFiles).Msg("failed to create file watcher; hot reload disabled")
-		} else if err := watcher.Start(); err != nil {
-			// Ensure we don't leak file descriptors if Start partially succeeded.
-			_ = watcher.Stop()
-			log.Ctx(ctx).Warn().Err(err).Strs("files", es.config.SchemaFiles).Msg("failed to start file watcher; hot reload disabled")
-		} else {
-			es.watcher = watcher
-			log.Ctx(ctx).Info().Strs("files", es.config.SchemaFiles).Msg("watching schema files for changes")
-		}
+		es.urlPoller.Start()
+		log.Ctx(ctx).Info().Strs("urls", es.config.SchemaURLs).Dur("interval", es.config.SchemaURLPollInterval).Msg("polling schema URLs for changes")
 	}
 
 	// Start health check server if enabled
@@ -181,9 +351,15 @@ func (es *EmbeddedServer) Start(ctx context.Context) error {
 	}
 
 	es.started = true
+	grpcAddress := es.front.Addr()
+	if es.config.GRPCInMemory {
+		grpcAddress = "in-memory"
+	}
 	log.Ctx(ctx).Info().
-		Str("grpc_address", es.config.GRPCAddress).
+		Str("grpc_address", grpcAddress).
 		Bool("http_enabled", es.config.HTTPEnabled).
+		Str("http_address", es.gatewaySrv.Addr()).
+		Bool("tls_enabled", es.tls != nil).
 		Bool("health_check_enabled", es.config.HealthCheckEnabled).
 		Str("health_check_address", es.config.HealthCheckAddress).
 		Msg("embedded SpiceDB server started")
@@ -191,53 +367,123 @@ func (es *EmbeddedServer) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops the server and file watchers.
-func (es *EmbeddedServer) Stop() error {
-	es.mu.Lock()
-	defer es.mu.Unlock()
+// grpcNextProto is the ALPN protocol gRPC clients negotiate over TLS: HTTP/2.
+const grpcNextProto = "h2"
 
-	if !es.started {
-		return nil
+// inMemoryBufferSize is the size of the buffer connecting clients to SpiceDB, which serves gRPC in
+// memory.
+const inMemoryBufferSize = 1 << 20
+
+// listenGRPC listens on GRPCAddress, keeping a port 0 bound from the start, and returns the front
+// serving the listener: it terminates TLS, if enabled, and forwards the calls to SpiceDB, which
+// serves gRPC in memory. With GRPCInMemory, clients only reach SpiceDB in-process, and the front is
+// nil.
+func (es *EmbeddedServer) listenGRPC() (*grpcfront.Front, error) {
+	if es.config.GRPCInMemory {
+		return nil, nil
 	}
 
-	log.Ctx(es.ctx).Info().Msg("stopping embedded SpiceDB server")
+	ln, err := socket.Listen(es.config.GRPCAddress, es.config.SocketMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", es.config.GRPCAddress, err)
+	}
+	var creds credentials.TransportCredentials
+	if es.tls != nil {
+		creds = credentials.NewTLS(es.listenerTLSConfig(grpcNextProto))
+	}
+	return grpcfront.New(ln, creds), nil
+}
 
-	// Stop health check server
-	if err := es.stopHealthCheckServer(es.ctx); err != nil {
-		log.Ctx(es.ctx).Warn().Err(err).Msg("error stopping health check server")
+// frontServerOptions returns the options adding the front's interceptors to the SpiceDB server's
+// middleware chains. They run first, so every middleware sees the peer of the client which made
+// the call, with its TLS state, rather than the front's connection.
+func frontServerOptions(front *grpcfront.Front) []server.ConfigOption {
+	return []server.ConfigOption{
+		server.WithUnaryMiddlewareModification(server.MiddlewareModification[grpc.UnaryServerInterceptor]{
+			Operation: server.OperationPrepend,
+			Middlewares: []server.ReferenceableMiddleware[grpc.UnaryServerInterceptor]{{
+				Name:       frontMiddlewareName,
+				Middleware: front.UnaryServerInterceptor(),
+			}},
+		}),
+		server.WithStreamingMiddlewareModification(server.MiddlewareModification[grpc.StreamServerInterceptor]{
+			Operation: server.OperationPrepend,
+			Middlewares: []server.ReferenceableMiddleware[grpc.StreamServerInterceptor]{{
+				Name:       frontMiddlewareName,
+				Middleware: front.StreamServerInterceptor(),
+			}},
+		}),
 	}
+}
 
-	// Stop file watcher
-	if es.watcher != nil {
-		if err := es.watcher.Stop(); err != nil {
-			log.Ctx(es.ctx).Warn().Err(err).Msg("error stopping file watcher")
-		}
+const frontMiddlewareName = "embedspicedb-grpcfront"
+
+// listenerTLSConfig returns the TLS configuration of a listener negotiating nextProtos, or nil if
+// TLS is not enabled.
+func (es *EmbeddedServer) listenerTLSConfig(nextProtos ...string) *tls.Config {
+	if es.tls == nil {
+		return nil
 	}
+	return es.tls.ServerConfig(nextProtos...)
+}
 
-	// Close connection
+// abortStart tears down what Start set up before it failed: the client connection, the gRPC
+// server and its listener.
+func (es *EmbeddedServer) abortStart() {
 	if es.conn != nil {
-		if err := es.conn.Close(); err != nil {
-			log.Ctx(es.ctx).Warn().Err(err).Msg("error closing connection")
-		}
+		_ = es.conn.Close()
+		es.conn = nil
 	}
-
-	// Cancel context to stop server
 	es.cancel()
-
-	// Wait for server to stop
 	es.wg.Wait()
+	es.closeGRPCListener()
+}
 
-	// Close datastore
-	if es.datastore != nil {
-		if err := es.datastore.Close(); err != nil {
-			log.Ctx(es.ctx).Warn().Err(err).Msg("error closing datastore")
-		}
+// closeGRPCListener closes the gRPC listener and the client connections accepted on it.
+func (es *EmbeddedServer) closeGRPCListener() {
+	if es.front == nil {
+		return
+	}
+	if err := es.front.Close(); err != nil {
+		log.Ctx(es.ctx).Warn().Err(err).Msg("error closing gRPC listener")
 	}
+	es.front = nil
+}
 
-	es.started = false
-	log.Ctx(es.ctx).Info().Msg("embedded SpiceDB server stopped")
+// startWatcher starts watching the schema files for changes, reloading the schema when they change.
+// Returns nil if there are no files, they are embedded and can't change, or they can't be watched.
+func (es *EmbeddedServer) startWatcher(ctx context.Context, files []string) *FileWatcher {
+	if len(files) == 0 {
+		return nil
+	}
+	if isEmbedFS(es.config.SchemaFS) {
+		log.Ctx(ctx).Info().Strs("files", files).Msg("schema files are embedded; hot reload disabled")
+		return nil
+	}
 
-	return nil
+	watcherOpts := []WatcherOption{
+		WithWatchMode(es.config.WatchMode, es.config.WatchPollInterval),
+		WithReloadBackoff(es.config.WatchFailureThreshold, es.config.WatchBackoff, es.config.WatchBackoffMax),
+	}
+	if es.config.SchemaFS != nil {
+		watcherOpts = append(watcherOpts, WithWatchFS(es.config.SchemaFS))
+	}
+	watcher, err := NewFileWatcherWithChanges(files, es.config.WatchDebounce, func(changed []string) error {
+		return writeError(es.reloadFromFiles(ctx, ReloadTriggerWatcher, changed))
+	}, watcherOpts...)
+	if err != nil {
+		// File watching is an optional convenience; don't fail server startup if it can't be created.
+		log.Ctx(ctx).Warn().Err(err).Strs("files", files).Msg("failed to create file watcher; hot reload disabled")
+		return nil
+	}
+	if err := watcher.Start(); err != nil {
+		// Ensure we don't leak file descriptors if Start partially succeeded.
+		_ = watcher.Stop()
+		log.Ctx(ctx).Warn().Err(err).Strs("files", files).Msg("failed to start file watcher; hot reload disabled")
+		return nil
+	}
+	log.Ctx(ctx).Info().Strs("files", files).Str("mode", string(watcher.Mode())).Msg("watching schema files for changes")
+	return watcher
 }
 
 // HealthCheckHTTPAddr returns the bound address for the HTTP health check server, if enabled and started.
@@ -251,6 +497,24 @@ func (es *EmbeddedServer) HealthCheckHTTPAddr() string {
 	return es.healthSrv.Addr()
 }
 
+// GRPCAddr returns the bound address of the gRPC server once started, such as "[::]:54321" when
+// GRPCAddress has port 0, or "unix:///run/spicedb.sock".
+// Returns empty string if the server is not started, or serves gRPC in memory.
+func (es *EmbeddedServer) GRPCAddr() string {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	return es.front.Addr()
+}
+
+// HTTPAddr returns the bound address of the HTTP gateway once started, such as "127.0.0.1:54321"
+// when HTTPAddress has port 0.
+// Returns empty string if the HTTP gateway is disabled or not yet started.
+func (es *EmbeddedServer) HTTPAddr() string {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	return es.gatewaySrv.Addr()
+}
+
 // Client returns a gRPC client connection to the server.
 func (es *EmbeddedServer) Client(ctx context.Context) (*grpc.ClientConn, error) {
 	es.mu.RLock()
@@ -259,6 +523,9 @@ func (es *EmbeddedServer) Client(ctx context.Context) (*grpc.ClientConn, error)
 	if !es.started {
 		return nil, fmt.Errorf("server is not started")
 	}
+	if es.stopping {
+		return nil, fmt.Errorf("server is stopping")
+	}
 
 	if es.conn == nil {
 		return nil, fmt.Errorf("no connection available")
@@ -269,11 +536,20 @@ func (es *EmbeddedServer) Client(ctx context.Context) (*grpc.ClientConn, error)
 
 // ReloadSchema manually reloads schema files.
 func (es *EmbeddedServer) ReloadSchema(ctx context.Context) error {
+	return es.reloadFromFiles(ctx, ReloadTriggerManual, nil)
+}
+
+// reloadFromFiles reloads the schema files and notifies all reload callbacks.
+func (es *EmbeddedServer) reloadFromFiles(ctx context.Context, trigger ReloadTrigger, changed []string) error {
 	es.mu.RLock()
 	if !es.started {
 		es.mu.RUnlock()
 		return fmt.Errorf("server is not started")
 	}
+	if es.stopping {
+		es.mu.RUnlock()
+		return fmt.Errorf("server is stopping")
+	}
 
 	if es.reloader == nil {
 		es.mu.RUnlock()
@@ -281,26 +557,118 @@ func (es *EmbeddedServer) ReloadSchema(ctx context.Context) error {
 	}
 
 	reloader := es.reloader
+	watcher := es.watcher
 	es.mu.RUnlock()
 
 	// Perform reload outside lock to avoid blocking other operations
-	err := reloader.Reload(ctx)
+	result, event := es.reloadSchema(ctx, reloader, trigger, changed)
+	err := event.Err
+	es.watchDependencies(ctx, watcher, result)
+	if watcher != nil && (trigger == ReloadTriggerManual || trigger == ReloadTriggerSchemaFiles) && schemaWritten(err) {
+		// Don't reload the files again when the watcher sees the changes that were just loaded
+		watcher.MarkLoaded()
+	}
 
 	// Get callbacks under lock, then invoke outside lock
 	es.mu.RLock()
 	callbacks := make([]func(error), len(es.reloadCallbacks))
 	copy(callbacks, es.reloadCallbacks)
+	resultCallbacks := make([]func(*ReloadResult, error), len(es.resultCallbacks))
+	copy(resultCallbacks, es.resultCallbacks)
 	es.mu.RUnlock()
 
 	for _, callback := range callbacks {
 		callback(err)
 	}
+	for _, callback := range resultCallbacks {
+		callback(result, err)
+	}
+	es.emitReloadEvent(event)
 
 	return err
 }
 
+// schemaWritten reports whether a reload which returned err wrote the schema: it succeeded, or only
+// assertions of the validation files failed.
+func schemaWritten(err error) bool {
+	var validationErr *ValidationError
+	return err == nil || errors.As(err, &validationErr)
+}
+
+// writeError returns the error of a reload if it did not write the schema. Failed assertions are
+// reported to the reload callbacks and events; they don't count as failed reloads towards the
+// watcher's circuit breaker.
+func writeError(err error) error {
+	if schemaWritten(err) {
+		return nil
+	}
+	return err
+}
+
+// reloadSchema reloads the schema files with reloader and records the written schema in the
+// history, returning the reload result and the event describing it.
+func (es *EmbeddedServer) reloadSchema(ctx context.Context, reloader *SchemaReloader, trigger ReloadTrigger, changed []string) (*ReloadResult, ReloadEvent) {
+	es.schemaMu.Lock()
+	defer es.schemaMu.Unlock()
+
+	startedAt := time.Now()
+	result, err := reloader.ReloadWithResult(ctx)
+	version := es.recordReload(ctx, result)
+	return result, newReloadEvent(trigger, changed, startedAt, result, version, err)
+}
+
+// watchDependencies has the watcher follow the files the reload read besides the schema files, such
+// as schema files referenced by validation files.
+func (es *EmbeddedServer) watchDependencies(ctx context.Context, watcher *FileWatcher, result *ReloadResult) {
+	if watcher == nil || result == nil {
+		return
+	}
+	if err := watcher.SetDependencies(result.Dependencies); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Strs("files", result.Dependencies).Msg("failed to watch schema dependencies")
+	}
+}
+
+// ValidateSchema reads and compiles the configured schema files and URLs locally, without writing
+// the schema. Compilation errors are returned as a *SchemaError pointing at the originating file and
+// line. The server does not need to be started.
+func (es *EmbeddedServer) ValidateSchema(ctx context.Context) error {
+	es.mu.RLock()
+	files := es.config.SchemaFiles
+	es.mu.RUnlock()
+
+	return internalschema.ValidateSchemaSources(ctx, es.config.SchemaFS, files, es.urlSources, es.config.SchemaVars)
+}
+
+// isEmbedFS returns whether fsys is an embed.FS, whose files are compiled into the binary and never
+// change.
+func isEmbedFS(fsys fs.FS) bool {
+	switch fsys.(type) {
+	case embed.FS, *embed.FS:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidationReport returns the results of the assertions and expected relations declared in YAML
+// validation files, as evaluated by the most recent successful schema reload.
+// Returns nil if the server is not started or the files declare no assertions.
+func (es *EmbeddedServer) ValidationReport() *ValidationReport {
+	es.mu.RLock()
+	reloader := es.reloader
+	es.mu.RUnlock()
+
+	if reloader == nil {
+		return nil
+	}
+	return reloader.LastValidationReport()
+}
+
 // OnSchemaReloaded registers a callback function that will be called whenever
 // the schema is reloaded (either automatically via file watching or manually).
+// If the schema was written but assertions in the validation files failed, the callback
+// receives a *ValidationError carrying the per-assertion results.
+// Use OnSchemaReloadEvent for the trigger, changed files and timing of each reload.
 func (es *EmbeddedServer) OnSchemaReloaded(callback func(error)) {
 	es.mu.Lock()
 	defer es.mu.Unlock()
@@ -308,6 +676,16 @@ func (es *EmbeddedServer) OnSchemaReloaded(callback func(error)) {
 	es.reloadCallbacks = append(es.reloadCallbacks, callback)
 }
 
+// OnSchemaReloadedWithResult registers a callback function that will be called whenever the schema
+// is reloaded, with the diff against the previously stored schema and the assertion results as well
+// as the reload error. Reloads blocked by DestructiveChangesBlock fail with a *DestructiveChangeError.
+func (es *EmbeddedServer) OnSchemaReloadedWithResult(callback func(*ReloadResult, error)) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.resultCallbacks = append(es.resultCallbacks, callback)
+}
+
 // dialWithRetry attempts to connect to the gRPC server with exponential backoff.
 func (es *EmbeddedServer) dialWithRetry(ctx context.Context) (*grpc.ClientConn, error) {
 	const (
@@ -320,7 +698,7 @@ func (es *EmbeddedServer) dialWithRetry(ctx context.Context) (*grpc.ClientConn,
 	backoff := initialBackoff
 
 	for i := 0; i < maxRetries; i++ {
-		conn, err := es.server.GRPCDialContext(ctx, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		conn, err := es.dialGRPC(ctx)
 		if err == nil {
 			return conn, nil
 		}
@@ -342,3 +720,8 @@ func (es *EmbeddedServer) dialWithRetry(ctx context.Context) (*grpc.ClientConn,
 
 	return nil, fmt.Errorf("failed after %d retries: %w", maxRetries, lastErr)
 }
+
+// dialGRPC opens the server's client connection to the gRPC server, in-process.
+func (es *EmbeddedServer) dialGRPC(ctx context.Context) (*grpc.ClientConn, error) {
+	return es.server.GRPCDialContext(ctx, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
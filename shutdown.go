@@ -0,0 +1,284 @@
+package embedspicedb
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/authzed/spicedb/pkg/cmd/server"
+	"google.golang.org/grpc"
+
+	log "github.com/akoserwal/embedspicedb/internal/logging"
+)
+
+// DefaultShutdownTimeout is how long Stop lets in-flight calls and watch streams finish before
+// terminating them.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// terminatedStopTimeout bounds how long Shutdown waits for the gRPC server to stop once the calls
+// still running were terminated.
+const terminatedStopTimeout = 5 * time.Second
+
+// ShutdownReport describes how Shutdown stopped the server.
+type ShutdownReport struct {
+	// Duration is how long the shutdown took.
+	Duration time.Duration
+
+	// Forced is true if calls were still running when the shutdown context was done, and were
+	// terminated.
+	Forced bool
+
+	// Connections is the number of client connections to GRPCAddr closed while calls were still
+	// running on them. The connection returned by Client is in-process, and isn't counted.
+	Connections int
+
+	// Calls lists the methods of the calls terminated, whichever connection they were made over:
+	// external clients', the one returned by Client, or the HTTP gateway's
+	// (e.g. "/authzed.api.v1.WatchService/Watch").
+	Calls []string
+}
+
+// Stop stops the server, letting in-flight calls and watch streams finish for up to
+// DefaultShutdownTimeout before terminating them. See Shutdown.
+func (es *EmbeddedServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultShutdownTimeout)
+	defer cancel()
+
+	_, err := es.Shutdown(ctx)
+	return err
+}
+
+// Shutdown stops the server gracefully. It stops reloading the schema, closes the listeners so no
+// new connections or calls are accepted, and waits for the calls, watch streams and HTTP gateway
+// requests in flight to finish. If ctx is done first, the remaining ones are terminated and the
+// report lists them, and Shutdown returns the context's error.
+//
+// The server is locked only while Shutdown starts and completes, so callbacks and other methods
+// keep working while calls drain; Client returns an error once Shutdown started. Shutting down a
+// server which is not started, or is already shutting down, does nothing and returns an empty
+// report.
+func (es *EmbeddedServer) Shutdown(ctx context.Context) (*ShutdownReport, error) {
+	startedAt := time.Now()
+
+	es.mu.Lock()
+	if !es.started || es.stopping {
+		es.mu.Unlock()
+		return &ShutdownReport{}, nil
+	}
+	es.stopping = true
+	watcher, poller := es.watcher, es.urlPoller
+	es.watcher, es.urlPoller = nil, nil
+	healthSrv, gatewaySrv, front, conn := es.healthSrv, es.gatewaySrv, es.front, es.conn
+	es.mu.Unlock()
+
+	log.Ctx(es.ctx).Info().Msg("stopping embedded SpiceDB server")
+
+	// Stop reloading the schema. The watcher and poller are stopped without holding es.mu, which
+	// the reloads they may be running take.
+	if watcher != nil {
+		if err := watcher.Stop(); err != nil {
+			log.Ctx(es.ctx).Warn().Err(err).Msg("error stopping file watcher")
+		}
+	}
+	if poller != nil {
+		poller.Stop()
+	}
+
+	// Health checks are short, but a server which doesn't answer them is shutting down anyway. If
+	// they outlast ctx, their connections are closed.
+	if err := healthSrv.Shutdown(ctx); err != nil {
+		log.Ctx(es.ctx).Warn().Err(err).Msg("error stopping health check server")
+		if err := healthSrv.Close(); err != nil {
+			log.Ctx(es.ctx).Warn().Err(err).Msg("error closing health check server")
+		}
+	}
+
+	// Stop accepting connections and calls, and drain the ones in flight. The gateway keeps its
+	// requests running until they finish or are terminated below, rather than when ctx is done, so
+	// the calls they make are still reported.
+	if front != nil {
+		front.StopAccepting()
+	}
+	terminateCtx, terminate := context.WithCancel(context.Background())
+	defer terminate()
+	gatewayDone := make(chan error, 1)
+	go func() { gatewayDone <- gatewaySrv.Shutdown(terminateCtx) }()
+
+	// SpiceDB stops gracefully, waiting for the calls in flight, once its context is canceled
+	es.cancel()
+	serverDone := make(chan struct{})
+	go func() {
+		es.wg.Wait()
+		close(serverDone)
+	}()
+
+	report := &ShutdownReport{}
+	var shutdownErr error
+	select {
+	case <-serverDone:
+	case <-ctx.Done():
+		shutdownErr = ctx.Err()
+		report.Forced = true
+		// Canceling the calls and closing the client connections ends them, which lets the server stop
+		report.Calls = es.calls.terminate()
+		terminate()
+		if front != nil {
+			report.Connections = front.Terminate()
+		}
+		if conn != nil {
+			_ = conn.Close()
+		}
+		select {
+		case <-serverDone:
+		case <-time.After(terminatedStopTimeout):
+			shutdownErr = fmt.Errorf("gRPC server did not stop after its calls were terminated: %w", shutdownErr)
+		}
+		log.Ctx(es.ctx).Warn().
+			Int("connections", report.Connections).
+			Strs("calls", report.Calls).
+			Msg("terminated calls still running at the shutdown deadline")
+	}
+
+	select {
+	case <-gatewayDone:
+	case <-ctx.Done():
+		terminate()
+		<-gatewayDone
+	}
+
+	if !report.Forced && conn != nil {
+		if err := conn.Close(); err != nil {
+			log.Ctx(es.ctx).Warn().Err(err).Msg("error closing connection")
+		}
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	select {
+	case <-serverDone:
+		es.closeGRPCListener()
+
+		// Close datastore, unless it was supplied by (and is still owned by) the caller
+		if es.datastore != nil && es.ownsDatastore {
+			if err := es.datastore.Close(); err != nil {
+				log.Ctx(es.ctx).Warn().Err(err).Msg("error closing datastore")
+			}
+		}
+	default:
+		// The datastore may still be in use; leave it, and the server, to the process exiting
+		log.Ctx(es.ctx).Error().Msg("gRPC server did not stop; abandoning it")
+	}
+
+	es.healthSrv = nil
+	es.gatewaySrv = nil
+	es.front = nil
+	es.conn = nil
+	es.started = false
+	es.stopping = false
+
+	report.Duration = time.Since(startedAt)
+	log.Ctx(es.ctx).Info().
+		Dur("duration", report.Duration).
+		Bool("forced", report.Forced).
+		Msg("embedded SpiceDB server stopped")
+
+	return report, shutdownErr
+}
+
+// callTracker records the calls in flight on the gRPC server, whichever connection they arrived
+// on, so Shutdown can terminate them and report those it terminated.
+type callTracker struct {
+	mu    sync.Mutex
+	next  uint64
+	calls map[uint64]trackedCall // GUARDED_BY(mu)
+}
+
+// trackedCall is a call in flight, with the function canceling its handler's context.
+type trackedCall struct {
+	method string
+	cancel context.CancelFunc
+}
+
+func newCallTracker() *callTracker {
+	return &callTracker{calls: make(map[uint64]trackedCall)}
+}
+
+// serverOptions returns the options adding the interceptors tracking the calls to the SpiceDB
+// server's middleware chains. They run last, so the context they cancel is the handler's own.
+func (t *callTracker) serverOptions() []server.ConfigOption {
+	return []server.ConfigOption{
+		server.WithUnaryMiddlewareModification(server.MiddlewareModification[grpc.UnaryServerInterceptor]{
+			Operation: server.OperationAppend,
+			Middlewares: []server.ReferenceableMiddleware[grpc.UnaryServerInterceptor]{{
+				Name:       callTrackerMiddlewareName,
+				Middleware: t.unaryInterceptor,
+			}},
+		}),
+		server.WithStreamingMiddlewareModification(server.MiddlewareModification[grpc.StreamServerInterceptor]{
+			Operation: server.OperationAppend,
+			Middlewares: []server.ReferenceableMiddleware[grpc.StreamServerInterceptor]{{
+				Name:       callTrackerMiddlewareName,
+				Middleware: t.streamInterceptor,
+			}},
+		}),
+	}
+}
+
+const callTrackerMiddlewareName = "embedspicedb-calltracker"
+
+func (t *callTracker) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := t.track(info.FullMethod, cancel)
+	defer done()
+	return handler(ctx, req)
+}
+
+func (t *callTracker) streamInterceptor(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	done := t.track(info.FullMethod, cancel)
+	defer done()
+	return handler(srv, &trackedStream{ServerStream: stream, ctx: ctx})
+}
+
+// trackedStream is a server stream whose context can be canceled by the call tracker.
+type trackedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *trackedStream) Context() context.Context {
+	return s.ctx
+}
+
+// track records a call to method, returning the function recording its end.
+func (t *callTracker) track(method string, cancel context.CancelFunc) func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id := t.next
+	t.next++
+	t.calls[id] = trackedCall{method: method, cancel: cancel}
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.calls, id)
+	}
+}
+
+// terminate cancels the contexts of the calls in flight, returning their methods, sorted. The calls
+// end once their handlers return.
+func (t *callTracker) terminate() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	methods := make([]string, 0, len(t.calls))
+	for _, call := range t.calls {
+		call.cancel()
+		methods = append(methods, call.method)
+	}
+	slices.Sort(methods)
+	return methods
+}
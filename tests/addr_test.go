@@ -0,0 +1,96 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestEmbeddedServer_BoundAddresses(t *testing.T) {
+	schemaFile := createTempSchemaFile(t)
+
+	// Servers binding port 0 run side by side without picking ports up front.
+	servers := make([]*EmbeddedServer, 2)
+	for i := range servers {
+		server, err := New(Config{
+			SchemaFiles:  []string{schemaFile},
+			GRPCAddress:  "127.0.0.1:0",
+			HTTPEnabled:  true,
+			HTTPAddress:  "127.0.0.1:0",
+			PresharedKey: "test-key",
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+
+		assert.Empty(t, server.GRPCAddr(), "not started")
+		assert.Empty(t, server.HTTPAddr(), "not started")
+		require.NoError(t, server.Start(context.Background()))
+		servers[i] = server
+	}
+	assert.NotEqual(t, servers[0].GRPCAddr(), servers[1].GRPCAddr())
+	assert.NotEqual(t, servers[0].HTTPAddr(), servers[1].HTTPAddr())
+
+	server := servers[0]
+	for _, addr := range []string{server.GRPCAddr(), server.HTTPAddr()} {
+		host, port, err := net.SplitHostPort(addr)
+		require.NoError(t, err)
+		assert.Equal(t, "127.0.0.1", host)
+		assert.NotEqual(t, "0", port)
+	}
+
+	t.Run("gRPC", func(t *testing.T) {
+		assert.NoError(t, readSchemaOver(t, server.GRPCAddr(), insecure.NewCredentials()))
+	})
+
+	t.Run("HTTP gateway", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://"+server.HTTPAddr()+"/v1/schema/read", strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer test-key")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.Contains(t, string(body), "definition document")
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		require.NoError(t, server.Stop())
+		assert.Empty(t, server.GRPCAddr())
+		assert.Empty(t, server.HTTPAddr())
+	})
+}
+
+func TestEmbeddedServer_BoundAddressesOtherListeners(t *testing.T) {
+	t.Run("unix domain socket", func(t *testing.T) {
+		grpcSocket := filepath.Join(socketDir(t), "grpc.sock")
+		server, err := New(Config{GRPCAddress: "unix://" + grpcSocket})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+		require.NoError(t, server.Start(context.Background()))
+
+		assert.Equal(t, "unix://"+grpcSocket, server.GRPCAddr())
+		assert.Empty(t, server.HTTPAddr(), "HTTP gateway disabled")
+	})
+
+	t.Run("in memory", func(t *testing.T) {
+		server, err := New(Config{GRPCInMemory: true})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+		require.NoError(t, server.Start(context.Background()))
+
+		assert.Empty(t, server.GRPCAddr())
+	})
+}
@@ -0,0 +1,120 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+	"github.com/akoserwal/embedspicedb/internal/datastore/memdb"
+
+	"github.com/authzed/spicedb/pkg/datastore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// closeTrackingDatastore wraps a datastore and records whether it has been closed.
+type closeTrackingDatastore struct {
+	datastore.Datastore
+	closed atomic.Bool
+}
+
+func (ds *closeTrackingDatastore) Close() error {
+	ds.closed.Store(true)
+	return ds.Datastore.Close()
+}
+
+func newCloseTrackingDatastore(t *testing.T) *closeTrackingDatastore {
+	t.Helper()
+
+	ds, err := memdb.NewMemdbDatastore(0, 0, 1*time.Hour)
+	require.NoError(t, err)
+	return &closeTrackingDatastore{Datastore: ds}
+}
+
+func TestNew_SuppliedDatastore(t *testing.T) {
+	ds := newCloseTrackingDatastore(t)
+	t.Cleanup(func() { _ = ds.Datastore.Close() })
+
+	server, err := New(Config{
+		GRPCAddress: getFreePort(t),
+		Datastore:   ds,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+
+	status, err := server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "healthy", status.Checks["datastore"])
+
+	require.NoError(t, server.Stop())
+	assert.False(t, ds.closed.Load(), "a supplied datastore must be left open for the caller")
+}
+
+func TestNew_DatastoreFactory(t *testing.T) {
+	ds := newCloseTrackingDatastore(t)
+
+	var received Config
+	server, err := New(Config{
+		GRPCAddress: getFreePort(t),
+		GCWindow:    2 * time.Hour,
+		DatastoreFactory: func(_ context.Context, config Config) (datastore.Datastore, error) {
+			received = config
+			return ds, nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, received.GCWindow)
+	assert.Equal(t, "dev-key", received.PresharedKey, "the factory receives the defaulted configuration")
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, server.Stop())
+	assert.True(t, ds.closed.Load(), "a datastore created by the factory is owned by the server")
+}
+
+func TestNew_DatastoreFactoryError(t *testing.T) {
+	factoryErr := errors.New("datastore unavailable")
+
+	server, err := New(Config{
+		DatastoreFactory: func(context.Context, Config) (datastore.Datastore, error) {
+			return nil, factoryErr
+		},
+	})
+	require.ErrorIs(t, err, factoryErr)
+	assert.Nil(t, server)
+
+	server, err = New(Config{
+		DatastoreFactory: func(context.Context, Config) (datastore.Datastore, error) {
+			return nil, nil
+		},
+	})
+	require.Error(t, err)
+	assert.Nil(t, server)
+}
+
+func TestNew_SuppliedDatastoreConflicts(t *testing.T) {
+	ds := newCloseTrackingDatastore(t)
+	t.Cleanup(func() { _ = ds.Close() })
+
+	server, err := New(Config{
+		Datastore: ds,
+		DatastoreFactory: func(context.Context, Config) (datastore.Datastore, error) {
+			return ds, nil
+		},
+	})
+	require.Error(t, err)
+	assert.Nil(t, server)
+
+	// DatastoreType is ignored when a datastore is supplied.
+	server, err = New(Config{
+		Datastore:     ds,
+		DatastoreType: "postgres",
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, server)
+}
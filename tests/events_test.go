@@ -0,0 +1,132 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnSchemaReloadEvent(t *testing.T) {
+	tmpFile := createTempSchemaFile(t)
+	server, err := New(Config{
+		SchemaFiles:   []string{tmpFile},
+		GRPCAddress:   getFreePort(t),
+		WatchDebounce: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	var legacyCalls atomic.Int32
+	server.OnSchemaReloaded(func(error) { legacyCalls.Add(1) })
+
+	nextEvent := func(t *testing.T) ReloadEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload event received")
+			return ReloadEvent{}
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+
+	startup := nextEvent(t)
+	assert.Equal(t, ReloadTriggerStartup, startup.Trigger)
+	assert.Empty(t, startup.ChangedFiles)
+	assert.Equal(t, []string{tmpFile}, startup.Files)
+	assert.NoError(t, startup.Err)
+	assert.NotEmpty(t, startup.SchemaHash)
+	assert.NotEmpty(t, startup.Revision)
+	assert.Equal(t, 1, startup.Version)
+	assert.False(t, startup.StartedAt.IsZero())
+	assert.Positive(t, startup.Duration)
+	assert.Zero(t, legacyCalls.Load(), "the initial load is not reported to OnSchemaReloaded")
+
+	t.Run("watcher", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(tmpFile, []byte(`definition user {}
+
+definition document {
+  relation owner: user
+  permission read = owner
+}`), 0644))
+
+		event := nextEvent(t)
+		assert.Equal(t, ReloadTriggerWatcher, event.Trigger)
+		assert.Equal(t, []string{tmpFile}, event.ChangedFiles)
+		assert.NoError(t, event.Err)
+		assert.Equal(t, 2, event.Version)
+		assert.NotEqual(t, startup.SchemaHash, event.SchemaHash)
+		require.NotNil(t, event.Diff)
+		assert.Len(t, event.Warnings, 1, "removing document#reader is reported as a warning")
+		assert.Contains(t, event.Warnings[0], "document#reader")
+	})
+
+	t.Run("manual", func(t *testing.T) {
+		require.NoError(t, server.ReloadSchema(ctx))
+
+		event := nextEvent(t)
+		assert.Equal(t, ReloadTriggerManual, event.Trigger)
+		assert.Empty(t, event.ChangedFiles)
+		assert.Equal(t, 2, event.Version, "an unchanged schema keeps its version")
+		assert.Empty(t, event.Warnings)
+		assert.EqualValues(t, 2, legacyCalls.Load(), "OnSchemaReloaded callbacks are still invoked")
+	})
+}
+
+func TestOnSchemaReloadEvent_Failure(t *testing.T) {
+	tmpFile := createTempFile(t, "schema.zed", "definition document {")
+	server, err := New(Config{
+		SchemaFiles:   []string{tmpFile},
+		GRPCAddress:   getFreePort(t),
+		WatchDebounce: time.Hour, // reload manually
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	var events []ReloadEvent
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events = append(events, event) })
+	require.NoError(t, server.Start(context.Background()))
+
+	require.Len(t, events, 1)
+	var schemaErr *SchemaError
+	require.ErrorAs(t, events[0].Err, &schemaErr)
+	assert.Equal(t, ReloadTriggerStartup, events[0].Trigger)
+	assert.NotEmpty(t, events[0].SchemaHash)
+	assert.Empty(t, events[0].Revision)
+	assert.Zero(t, events[0].Version)
+	assert.Empty(t, server.SchemaHistory())
+}
+
+func TestOnSchemaReloadEvent_Rollback(t *testing.T) {
+	server, tmpFile := startHistoryServer(t, Config{})
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	var events []ReloadEvent
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events = append(events, event) })
+
+	v, err := server.RollbackSchema(ctx, 1)
+	require.NoError(t, err)
+
+	require.Len(t, events, 1)
+	assert.Equal(t, ReloadTriggerRollback, events[0].Trigger)
+	assert.Equal(t, v.Version, events[0].Version)
+	assert.Equal(t, v.Hash, events[0].SchemaHash)
+	assert.Equal(t, v.Revision, events[0].Revision)
+	assert.NoError(t, events[0].Err)
+}
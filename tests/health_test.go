@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	. "github.com/akoserwal/embedspicedb"
 	"net/http"
+	"os"
 	"sync"
 	"testing"
 	"time"
@@ -286,3 +287,66 @@ func TestHealthCheck_ConcurrentAccess(t *testing.T) {
 func removeFile(path string) {
 	// File removal is handled by test cleanup, but this provides a consistent interface
 }
+
+func TestHealthCheck_WatcherCircuit(t *testing.T) {
+	tmpFile := createTempSchemaFile(t)
+	server, err := New(Config{
+		SchemaFiles:           []string{tmpFile},
+		GRPCAddress:           getFreePort(t),
+		WatchDebounce:         50 * time.Millisecond,
+		WatchFailureThreshold: 1,
+		WatchBackoff:          time.Hour,
+		WatchBackoffMax:       time.Hour,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	<-events // startup
+
+	status, err := server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "healthy", status.Status)
+	assert.Equal(t, "closed", status.Checks["watcher"])
+	require.NotNil(t, status.Watcher)
+	assert.Equal(t, CircuitClosed, status.Watcher.Circuit)
+
+	// Saving the schema unchanged does not reload it.
+	schema, err := os.ReadFile(tmpFile)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(tmpFile, schema, 0644))
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected %s reload", event.Trigger)
+	case <-time.After(400 * time.Millisecond):
+	}
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte("definition document {"), 0644))
+	select {
+	case event := <-events:
+		require.Error(t, event.Err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event received")
+	}
+
+	status, err = server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "degraded", status.Status)
+	assert.Contains(t, status.Checks["watcher"], "open (1 consecutive failures")
+	require.NotNil(t, status.Watcher)
+	assert.Equal(t, CircuitOpen, status.Watcher.Circuit)
+	assert.NotEmpty(t, status.Watcher.LastError)
+
+	// A successful manual reload closes the circuit.
+	require.NoError(t, os.WriteFile(tmpFile, schema, 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	status, err = server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "healthy", status.Status)
+	assert.Equal(t, "closed", status.Checks["watcher"])
+}
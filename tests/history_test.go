@@ -0,0 +1,185 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const historyOwnerSchema = `definition user {}
+
+definition document {
+  relation reader: user
+  relation owner: user
+  permission read = reader + owner
+}`
+
+func startHistoryServer(t *testing.T, config Config) (*EmbeddedServer, string) {
+	t.Helper()
+
+	tmpFile := createTempSchemaFile(t)
+	config.SchemaFiles = []string{tmpFile}
+	config.GRPCAddress = getFreePort(t)
+	config.WatchDebounce = time.Hour // reload manually
+
+	server, err := New(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	require.NoError(t, server.Start(context.Background()))
+	return server, tmpFile
+}
+
+func TestSchemaHistory(t *testing.T) {
+	server, tmpFile := startHistoryServer(t, Config{})
+	ctx := context.Background()
+
+	history := server.SchemaHistory()
+	require.Len(t, history, 1, "the initial load is recorded")
+	assert.Equal(t, 1, history[0].Version)
+	assert.Equal(t, []string{tmpFile}, history[0].Files)
+	assert.NotEmpty(t, history[0].Revision)
+	assert.NotEmpty(t, history[0].Hash)
+	assert.Zero(t, history[0].RollbackOf)
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	history = server.SchemaHistory()
+	require.Len(t, history, 2)
+	assert.Equal(t, 2, history[1].Version)
+	assert.Equal(t, historyOwnerSchema, history[1].Schema)
+	assert.NotEqual(t, history[0].Hash, history[1].Hash)
+	assert.False(t, history[1].AppliedAt.Before(history[0].AppliedAt))
+
+	// Reloading an unchanged schema does not add a version.
+	require.NoError(t, server.ReloadSchema(ctx))
+	assert.Len(t, server.SchemaHistory(), 2)
+
+	// Failed reloads are not recorded.
+	require.NoError(t, os.WriteFile(tmpFile, []byte("definition document {"), 0644))
+	require.Error(t, server.ReloadSchema(ctx))
+	assert.Len(t, server.SchemaHistory(), 2)
+}
+
+func TestRollbackSchema(t *testing.T) {
+	server, tmpFile := startHistoryServer(t, Config{})
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	v, err := server.RollbackSchema(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, v.Version)
+	assert.Equal(t, 1, v.RollbackOf)
+	assert.Equal(t, server.SchemaHistory()[0].Hash, v.Hash)
+	assert.NotEmpty(t, v.Revision)
+
+	conn, err := server.Client(ctx)
+	require.NoError(t, err)
+	resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	require.NoError(t, err)
+	assert.NotContains(t, resp.SchemaText, "owner")
+
+	_, err = server.RollbackSchema(ctx, 42)
+	require.ErrorIs(t, err, ErrSchemaVersionNotFound)
+	assert.Len(t, server.SchemaHistory(), 3)
+}
+
+func TestSchemaHistory_Bounded(t *testing.T) {
+	server, tmpFile := startHistoryServer(t, Config{SchemaHistorySize: 2})
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema+"\n\ndefinition folder {}"), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	history := server.SchemaHistory()
+	require.Len(t, history, 2)
+	assert.Equal(t, 2, history[0].Version)
+	assert.Equal(t, 3, history[1].Version)
+
+	_, err := server.RollbackSchema(ctx, 1)
+	require.ErrorIs(t, err, ErrSchemaVersionNotFound, "dropped versions can no longer be restored")
+}
+
+func TestRollbackSchema_DestructiveChangePolicy(t *testing.T) {
+	server, tmpFile := startHistoryServer(t, Config{DestructiveChangePolicy: DestructiveChangesBlock})
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	// Version 1 lacks the owner relation and the read permission's use of it
+	_, err := server.RollbackSchema(ctx, 1)
+	var destructiveErr *DestructiveChangeError
+	require.ErrorAs(t, err, &destructiveErr)
+	assert.Len(t, server.SchemaHistory(), 2, "blocked rollbacks are not recorded")
+
+	conn, err := server.Client(ctx)
+	require.NoError(t, err)
+	resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, resp.SchemaText, "owner", "the current schema is kept")
+}
+
+func TestSchemaHistory_HTTPEndpoints(t *testing.T) {
+	server, tmpFile := startHistoryServer(t, Config{HealthCheckEnabled: true, PresharedKey: "test-key"})
+	ctx := context.Background()
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte(historyOwnerSchema), 0644))
+	require.NoError(t, server.ReloadSchema(ctx))
+
+	baseURL := "http://" + server.HealthCheckHTTPAddr()
+	client := &http.Client{Timeout: 5 * time.Second}
+	do := func(method, path, key string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, baseURL+path, nil)
+		require.NoError(t, err)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	for _, key := range []string{"", "wrong-key"} {
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/schema/history", key).StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/schema/rollback?version=1", key).StatusCode)
+	}
+	assert.Len(t, server.SchemaHistory(), 2, "unauthenticated rollbacks are refused")
+
+	resp := do(http.MethodGet, "/schema/history", "test-key")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var history []SchemaVersion
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history, 2)
+	assert.Equal(t, server.SchemaHistory()[1].Hash, history[1].Hash)
+
+	rollback := do(http.MethodPost, "/schema/rollback?version=1", "test-key")
+	assert.Equal(t, http.StatusOK, rollback.StatusCode)
+
+	var v SchemaVersion
+	require.NoError(t, json.NewDecoder(rollback.Body).Decode(&v))
+	assert.Equal(t, 3, v.Version)
+	assert.Equal(t, 1, v.RollbackOf)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/schema/rollback?version=42", "test-key").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/schema/rollback?version=latest", "test-key").StatusCode)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodGet, "/schema/rollback?version=1", "test-key").StatusCode)
+}
@@ -0,0 +1,55 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedServer_GRPCInMemory(t *testing.T) {
+	schemaFile := createTempSchemaFile(t)
+
+	// Every server uses the default GRPCAddress; none of them binds it.
+	for i := range 3 {
+		t.Run(fmt.Sprintf("server %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			server, err := New(Config{
+				SchemaFiles:  []string{schemaFile},
+				GRPCInMemory: true,
+			})
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = server.Stop() })
+
+			ctx := context.Background()
+			require.NoError(t, server.Start(ctx))
+
+			conn, err := server.Client(ctx)
+			require.NoError(t, err)
+			resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+			require.NoError(t, err)
+			assert.Contains(t, resp.SchemaText, "definition document")
+
+			status, err := server.HealthCheck(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, "healthy", status.Status)
+		})
+	}
+}
+
+func TestConfigValidate_GRPCInMemory(t *testing.T) {
+	config := DefaultConfig()
+	config.GRPCInMemory = true
+	config.GRPCAddress = "not an address"
+	assert.NoError(t, config.Validate(), "GRPCAddress is ignored")
+
+	// The HTTP gateway calls the server over the in-memory connection.
+	config.HTTPEnabled = true
+	assert.NoError(t, config.Validate())
+}
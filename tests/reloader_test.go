@@ -2,10 +2,13 @@ package embedspicedb_test
 
 import (
 	"context"
+	"fmt"
 	. "github.com/akoserwal/embedspicedb"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
 	"github.com/stretchr/testify/assert"
@@ -451,3 +454,720 @@ func TestSchemaReloader_CombinedSchemas(t *testing.T) {
 		}
 	})
 }
+
+func readDocumentReaders(t *testing.T, ctx context.Context, conn *grpc.ClientConn) []string {
+	t.Helper()
+
+	stream, err := v1.NewPermissionsServiceClient(conn).ReadRelationships(ctx, &v1.ReadRelationshipsRequest{
+		Consistency:        &v1.Consistency{Requirement: &v1.Consistency_FullyConsistent{FullyConsistent: true}},
+		RelationshipFilter: &v1.RelationshipFilter{ResourceType: "document"},
+	})
+	require.NoError(t, err)
+
+	var found []string
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		found = append(found, resp.Relationship.Resource.ObjectId+"#"+resp.Relationship.Relation+"@"+resp.Relationship.Subject.Object.ObjectId)
+	}
+	return found
+}
+
+func TestSchemaReloader_SeedRelationships(t *testing.T) {
+	const seedSchema = `schema: |
+  definition user {}
+  definition document {
+    relation reader: user
+    permission read = reader
+  }
+`
+
+	for _, tc := range []struct {
+		name     string
+		policy   SeedPolicy
+		expected []string
+	}{
+		{
+			name:     "touch keeps relationships removed from the file",
+			policy:   SeedPolicyTouch,
+			expected: []string{"doc1#reader@alice", "doc2#reader@bob", "doc3#reader@carol"},
+		},
+		{
+			name:     "replace deletes relationships removed from the file",
+			policy:   SeedPolicyReplace,
+			expected: []string{"doc1#reader@alice", "doc3#reader@carol"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			yamlFile := filepath.Join(t.TempDir(), "playground.yaml")
+			require.NoError(t, os.WriteFile(yamlFile, []byte(seedSchema+`relationships: |
+  document:doc1#reader@user:alice
+  document:doc2#reader@user:bob
+`), 0644))
+
+			server, err := New(Config{
+				SchemaFiles:       []string{yamlFile},
+				GRPCAddress:       getFreePort(t),
+				PresharedKey:      "test-key",
+				WatchDebounce:     time.Hour, // reload manually
+				SeedRelationships: true,
+				SeedPolicy:        tc.policy,
+			})
+			require.NoError(t, err)
+			defer server.Stop()
+
+			ctx := context.Background()
+			require.NoError(t, server.Start(ctx))
+
+			conn, err := server.Client(ctx)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"doc1#reader@alice", "doc2#reader@bob"}, readDocumentReaders(t, ctx, conn))
+
+			require.NoError(t, os.WriteFile(yamlFile, []byte(seedSchema+`relationships: |
+  document:doc1#reader@user:alice
+  document:doc3#reader@user:carol
+`), 0644))
+			require.NoError(t, server.ReloadSchema(ctx))
+
+			assert.ElementsMatch(t, tc.expected, readDocumentReaders(t, ctx, conn))
+		})
+	}
+
+	t.Run("relationships are ignored unless seeding is enabled", func(t *testing.T) {
+		yamlFile := filepath.Join(t.TempDir(), "playground.yaml")
+		require.NoError(t, os.WriteFile(yamlFile, []byte(seedSchema+`relationships: |
+  document:doc1#reader@user:alice
+`), 0644))
+
+		server, err := New(Config{
+			SchemaFiles:  []string{yamlFile},
+			GRPCAddress:  getFreePort(t),
+			PresharedKey: "test-key",
+		})
+		require.NoError(t, err)
+		defer server.Stop()
+
+		ctx := context.Background()
+		require.NoError(t, server.Start(ctx))
+
+		conn, err := server.Client(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, readDocumentReaders(t, ctx, conn))
+	})
+
+	t.Run("invalid policy is rejected", func(t *testing.T) {
+		_, err := New(Config{
+			SeedRelationships: true,
+			SeedPolicy:        "upsert",
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "SeedPolicy")
+	})
+}
+
+func TestSchemaReloader_Assertions(t *testing.T) {
+	const playground = `schema: |
+  definition user {}
+  definition document {
+    relation reader: user
+    permission read = reader
+  }
+relationships: |
+  document:doc1#reader@user:alice
+assertions:
+  assertTrue:
+    - document:doc1#read@user:alice
+  assertFalse:
+    - document:doc1#read@user:%s
+validation:
+  document:doc1#read:
+    - "[user:alice] is <document:doc1#reader>"
+`
+
+	yamlFile := filepath.Join(t.TempDir(), "playground.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(fmt.Sprintf(playground, "bob")), 0644))
+
+	server, err := New(Config{
+		SchemaFiles:       []string{yamlFile},
+		GRPCAddress:       getFreePort(t),
+		PresharedKey:      "test-key",
+		WatchDebounce:     time.Hour, // reload manually
+		SeedRelationships: true,
+	})
+	require.NoError(t, err)
+	defer server.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+
+	report := server.ValidationReport()
+	require.NotNil(t, report)
+	assert.Equal(t, 3, report.Passed)
+	assert.Zero(t, report.Failed)
+
+	status, err := server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "passed (3/3)", status.Checks["assertions"])
+	assert.Equal(t, "healthy", status.Status)
+
+	var callbackErr error
+	server.OnSchemaReloaded(func(err error) { callbackErr = err })
+
+	// alice is a reader, so asserting she cannot read fails.
+	require.NoError(t, os.WriteFile(yamlFile, []byte(fmt.Sprintf(playground, "alice")), 0644))
+	err = server.ReloadSchema(ctx)
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.ErrorAs(t, callbackErr, &validationErr)
+	assert.Equal(t, 1, validationErr.Report.Failed)
+
+	failures := validationErr.Report.Failures()
+	require.Len(t, failures, 1)
+	assert.Equal(t, "assertFalse", failures[0].Kind)
+	assert.Equal(t, "document:doc1#read@user:alice", failures[0].Assertion)
+	assert.Equal(t, yamlFile, failures[0].File)
+
+	status, err = server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "failed (2/3 passed)", status.Checks["assertions"])
+	assert.Equal(t, "degraded", status.Status)
+}
+
+func TestSchemaReloader_FailedAssertionsDoNotOpenCircuit(t *testing.T) {
+	const playground = `schema: |
+  definition user {}
+  definition document {
+    relation reader: user
+    permission read = reader
+  }
+relationships: |
+  document:doc1#reader@user:alice
+assertions:
+  assertFalse:
+    - document:doc1#read@user:%s
+`
+
+	yamlFile := filepath.Join(t.TempDir(), "playground.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(fmt.Sprintf(playground, "bob")), 0644))
+
+	server, err := New(Config{
+		SchemaFiles:           []string{yamlFile},
+		GRPCAddress:           getFreePort(t),
+		WatchDebounce:         50 * time.Millisecond,
+		WatchFailureThreshold: 1,
+		WatchBackoff:          time.Hour,
+		WatchBackoffMax:       time.Hour,
+		SeedRelationships:     true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, (<-events).Err)
+
+	// alice is a reader, so asserting she cannot read fails, but the schema is still written.
+	require.NoError(t, os.WriteFile(yamlFile, []byte(fmt.Sprintf(playground, "alice")), 0644))
+	select {
+	case event := <-events:
+		var validationErr *ValidationError
+		require.ErrorAs(t, event.Err, &validationErr)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event received")
+	}
+
+	status, err := server.HealthCheck(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, status.Watcher)
+	assert.Equal(t, CircuitClosed, status.Watcher.Circuit)
+	assert.Zero(t, status.Watcher.ConsecutiveFailures)
+}
+
+func TestSchemaReloader_ExpectedRelations(t *testing.T) {
+	yamlFile := filepath.Join(t.TempDir(), "playground.yaml")
+	require.NoError(t, os.WriteFile(yamlFile, []byte(`schema: |
+  definition user {}
+  definition document {
+    relation reader: user
+    permission read = reader
+  }
+relationships: |
+  document:doc1#reader@user:alice
+  document:doc1#reader@user:bob
+validation:
+  document:doc1#read:
+    - "[user:alice] is <document:doc1#reader>"
+    - "[user:carol] is <document:doc1#reader>"
+`), 0644))
+
+	server, err := New(Config{
+		SchemaFiles:       []string{yamlFile},
+		GRPCAddress:       getFreePort(t),
+		PresharedKey:      "test-key",
+		SeedRelationships: true,
+	})
+	require.NoError(t, err)
+	defer server.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+
+	report := server.ValidationReport()
+	require.NotNil(t, report)
+	require.Len(t, report.Results, 1)
+	assert.False(t, report.Results[0].Passed)
+	assert.Equal(t, "document:doc1#read", report.Results[0].Assertion)
+	assert.Contains(t, report.Results[0].Message, "missing subjects user:carol")
+	assert.Contains(t, report.Results[0].Message, "unexpected subjects user:bob")
+}
+
+func TestValidateSchema(t *testing.T) {
+	t.Run("valid schema", func(t *testing.T) {
+		tmpFile := createTempSchemaFile(t)
+		defer os.Remove(tmpFile)
+
+		server, err := New(Config{SchemaFiles: []string{tmpFile}})
+		require.NoError(t, err)
+
+		// Validation does not require a running server.
+		assert.NoError(t, server.ValidateSchema(context.Background()))
+	})
+
+	t.Run("error points at the originating file and line", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		userFile := filepath.Join(tmpDir, "user.zed")
+		documentFile := filepath.Join(tmpDir, "document.zed")
+		require.NoError(t, os.WriteFile(userFile, []byte("definition user {}\n\ndefinition team {\n  relation member: user\n}\n"), 0644))
+		require.NoError(t, os.WriteFile(documentFile, []byte("definition document {\n  relation reader: user\n  permission read = reader +\n}\n"), 0644))
+
+		server, err := New(Config{SchemaFiles: []string{userFile, documentFile}})
+		require.NoError(t, err)
+
+		err = server.ValidateSchema(context.Background())
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, documentFile, schemaErr.File)
+		assert.Equal(t, 4, schemaErr.Line)
+		assert.NotEmpty(t, schemaErr.Message)
+	})
+
+	t.Run("error in YAML schema points at the YAML line", func(t *testing.T) {
+		yamlFile := filepath.Join(t.TempDir(), "schema.yaml")
+		require.NoError(t, os.WriteFile(yamlFile, []byte("---\nschema: |\n  definition user {}\n  definition document {\n    relation reader: usr user\n  }\n"), 0644))
+
+		server, err := New(Config{SchemaFiles: []string{yamlFile}})
+		require.NoError(t, err)
+
+		err = server.ValidateSchema(context.Background())
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, yamlFile, schemaErr.File)
+		assert.Equal(t, 5, schemaErr.Line)
+	})
+
+	t.Run("reload does not write an invalid schema", func(t *testing.T) {
+		tmpFile := createTempSchemaFile(t)
+		defer os.Remove(tmpFile)
+
+		server, err := New(Config{
+			SchemaFiles:   []string{tmpFile},
+			GRPCAddress:   getFreePort(t),
+			PresharedKey:  "test-key",
+			WatchDebounce: time.Hour, // reload manually
+		})
+		require.NoError(t, err)
+		defer server.Stop()
+
+		ctx := context.Background()
+		require.NoError(t, server.Start(ctx))
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte("definition user {\n"), 0644))
+
+		err = server.ReloadSchema(ctx)
+		var schemaErr *SchemaError
+		require.ErrorAs(t, err, &schemaErr)
+		assert.Equal(t, tmpFile, schemaErr.File)
+
+		conn, err := server.Client(ctx)
+		require.NoError(t, err)
+		resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+		require.NoError(t, err)
+		assert.Contains(t, resp.SchemaText, "definition document")
+	})
+}
+
+func TestSchemaReloader_DestructiveChanges(t *testing.T) {
+	const reducedSchema = `definition user {}
+
+definition document {
+  relation owner: user
+}`
+
+	startServer := func(t *testing.T, policy DestructiveChangePolicy) (*EmbeddedServer, string) {
+		t.Helper()
+
+		tmpFile := createTempSchemaFile(t)
+		server, err := New(Config{
+			SchemaFiles:             []string{tmpFile},
+			GRPCAddress:             getFreePort(t),
+			PresharedKey:            "test-key",
+			WatchDebounce:           time.Hour, // reload manually
+			DestructiveChangePolicy: policy,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+
+		require.NoError(t, server.Start(context.Background()))
+		return server, tmpFile
+	}
+
+	t.Run("block leaves the stored schema untouched", func(t *testing.T) {
+		server, tmpFile := startServer(t, DestructiveChangesBlock)
+		ctx := context.Background()
+
+		var result *ReloadResult
+		server.OnSchemaReloadedWithResult(func(r *ReloadResult, _ error) { result = r })
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte(reducedSchema), 0644))
+		err := server.ReloadSchema(ctx)
+
+		var destructiveErr *DestructiveChangeError
+		require.ErrorAs(t, err, &destructiveErr)
+		require.NotNil(t, result)
+		assert.Same(t, destructiveErr.Diff, result.Diff)
+		assert.ElementsMatch(t, []SchemaChange{
+			{Kind: SchemaChangeAdded, Element: SchemaElementRelation, Definition: "document", Name: "owner"},
+			{Kind: SchemaChangeRemoved, Element: SchemaElementPermission, Definition: "document", Name: "read", Destructive: true},
+			{Kind: SchemaChangeRemoved, Element: SchemaElementRelation, Definition: "document", Name: "reader", Destructive: true},
+		}, result.Diff.Changes)
+
+		conn, err := server.Client(ctx)
+		require.NoError(t, err)
+		resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+		require.NoError(t, err)
+		assert.Contains(t, resp.SchemaText, "reader")
+
+		// Additive changes are still written.
+		require.NoError(t, os.WriteFile(tmpFile, []byte(`definition user {}
+
+definition document {
+  relation reader: user
+  relation owner: user
+  permission read = reader + owner
+}`), 0644))
+		require.NoError(t, server.ReloadSchema(ctx))
+		assert.Empty(t, result.Diff.Destructive())
+	})
+
+	t.Run("warn writes destructive changes", func(t *testing.T) {
+		server, tmpFile := startServer(t, DestructiveChangesWarn)
+		ctx := context.Background()
+
+		var result *ReloadResult
+		server.OnSchemaReloadedWithResult(func(r *ReloadResult, _ error) { result = r })
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte(reducedSchema), 0644))
+		require.NoError(t, server.ReloadSchema(ctx))
+		require.NotNil(t, result)
+		assert.Len(t, result.Diff.Destructive(), 2)
+	})
+
+	t.Run("narrowing allowed types is destructive", func(t *testing.T) {
+		server, tmpFile := startServer(t, DestructiveChangesBlock)
+		ctx := context.Background()
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte(`definition user {}
+definition team {}
+
+definition document {
+  relation reader: user | team
+  permission read = reader
+}`), 0644))
+		require.NoError(t, server.ReloadSchema(ctx))
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte(`definition user {}
+definition team {}
+
+definition document {
+  relation reader: team
+  permission read = reader
+}`), 0644))
+		err := server.ReloadSchema(ctx)
+
+		var destructiveErr *DestructiveChangeError
+		require.ErrorAs(t, err, &destructiveErr)
+		require.Len(t, destructiveErr.Diff.Changes, 1)
+		assert.Equal(t, "removed allowed types user", destructiveErr.Diff.Changes[0].Detail)
+	})
+
+	// reloadDiff writes schema to the schema file, reloads it and returns the reload's diff.
+	reloadDiff := func(t *testing.T, server *EmbeddedServer, tmpFile, schema string) (*SchemaDiff, error) {
+		t.Helper()
+		var result *ReloadResult
+		server.OnSchemaReloadedWithResult(func(r *ReloadResult, _ error) { result = r })
+		require.NoError(t, os.WriteFile(tmpFile, []byte(schema), 0644))
+		err := server.ReloadSchema(context.Background())
+		require.NotNil(t, result)
+		return result.Diff, err
+	}
+
+	t.Run("changed permission expressions are reported", func(t *testing.T) {
+		server, tmpFile := startServer(t, DestructiveChangesBlock)
+
+		_, err := reloadDiff(t, server, tmpFile, `definition user {}
+
+definition document {
+  relation reader: user
+  relation owner: user
+  permission read = reader
+}`)
+		require.NoError(t, err)
+
+		diff, err := reloadDiff(t, server, tmpFile, `definition user {}
+
+definition document {
+  relation reader: user
+  relation owner: user
+  permission read = owner
+}`)
+		require.NoError(t, err)
+		assert.Equal(t, []SchemaChange{
+			{Kind: SchemaChangeChanged, Element: SchemaElementPermission, Definition: "document", Name: "read", Detail: "changed expression"},
+		}, diff.Changes)
+
+		// Moving a permission within the schema doesn't change it.
+		diff, err = reloadDiff(t, server, tmpFile, `definition user {}
+
+definition document {
+  relation reader: user
+
+  // owners read too
+  relation owner: user
+
+  permission read =   owner
+}`)
+		require.NoError(t, err)
+		assert.True(t, diff.IsEmpty(), "unexpected changes %v", diff.Changes)
+	})
+
+	t.Run("caveat changes", func(t *testing.T) {
+		server, tmpFile := startServer(t, DestructiveChangesBlock)
+		const schema = `definition user {}
+
+caveat on_weekday(%s) {
+  %s
+}
+
+definition document {
+  relation reader: user with on_weekday
+  permission read = reader
+}`
+
+		_, err := reloadDiff(t, server, tmpFile, fmt.Sprintf(schema, "day int, strict bool", "day < 5"))
+		require.NoError(t, err)
+
+		diff, err := reloadDiff(t, server, tmpFile, fmt.Sprintf(schema, "day int, strict bool", "day < 6"))
+		require.NoError(t, err, "changed expressions are not destructive")
+		assert.Equal(t, []SchemaChange{
+			{Kind: SchemaChangeChanged, Element: SchemaElementCaveat, Definition: "on_weekday", Detail: "changed expression"},
+		}, diff.Changes)
+
+		diff, err = reloadDiff(t, server, tmpFile, fmt.Sprintf(schema, "day int", "day < 6"))
+		var destructiveErr *DestructiveChangeError
+		require.ErrorAs(t, err, &destructiveErr, "removed parameters are destructive")
+		assert.Equal(t, []SchemaChange{
+			{Kind: SchemaChangeChanged, Element: SchemaElementCaveat, Definition: "on_weekday", Detail: "removed parameter strict", Destructive: true},
+		}, diff.Changes)
+
+		diff, err = reloadDiff(t, server, tmpFile, fmt.Sprintf(schema, "day int, strict string", "day < 6"))
+		require.ErrorAs(t, err, &destructiveErr, "changed parameter types are destructive")
+		assert.Equal(t, []SchemaChange{
+			{Kind: SchemaChangeChanged, Element: SchemaElementCaveat, Definition: "on_weekday", Detail: "changed type of parameter strict", Destructive: true},
+		}, diff.Changes)
+	})
+}
+
+func TestSchemaReloader_DirectoriesAndPatterns(t *testing.T) {
+	dir := t.TempDir()
+	writeSchema := func(name, schema string) string {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(schema), 0644))
+		return path
+	}
+	userFile := writeSchema("users/user.zed", "definition user {}")
+	documentFile := writeSchema("documents/document.zed", "definition document {\n  relation reader: user\n}")
+
+	server, err := New(Config{
+		SchemaFiles:   []string{filepath.Join(dir, "**", "*.zed")},
+		GRPCAddress:   getFreePort(t),
+		WatchDebounce: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	nextEvent := func(t *testing.T) ReloadEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			require.NoError(t, event.Err)
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload event received")
+			return ReloadEvent{}
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	assert.Equal(t, []string{documentFile, userFile}, nextEvent(t).Files, "files are loaded in lexical order")
+
+	readSchema := func(t *testing.T) string {
+		t.Helper()
+		conn, err := server.Client(ctx)
+		require.NoError(t, err)
+		resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+		require.NoError(t, err)
+		return resp.SchemaText
+	}
+
+	// A file created in a new directory is picked up by the watcher.
+	folderFile := writeSchema("folders/nested/folder.zed", "definition folder {\n  relation viewer: user\n}")
+	event := nextEvent(t)
+	assert.Contains(t, event.ChangedFiles, folderFile)
+	assert.Equal(t, []string{documentFile, folderFile, userFile}, event.Files)
+	assert.Contains(t, readSchema(t), "definition folder")
+
+	// Files which don't match the pattern are ignored.
+	writeSchema("folders/README.md", "# schemas")
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected reload of %v", event.ChangedFiles)
+	case <-time.After(400 * time.Millisecond):
+	}
+
+	// A deleted file drops out of the schema.
+	require.NoError(t, os.Remove(folderFile))
+	event = nextEvent(t)
+	assert.Equal(t, []string{folderFile}, event.ChangedFiles)
+	assert.Equal(t, []string{documentFile, userFile}, event.Files)
+	assert.NotContains(t, readSchema(t), "definition folder")
+}
+
+func TestValidateSchema_Directory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.zed"), []byte("definition user {}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "document.zed"), []byte("definition document {\n  relation reader: user\n}"), 0644))
+
+	server, err := New(Config{SchemaFiles: []string{dir}})
+	require.NoError(t, err)
+	assert.NoError(t, server.ValidateSchema(context.Background()))
+
+	server, err = New(Config{SchemaFiles: []string{filepath.Join(dir, "missing", "*.zed")}})
+	require.NoError(t, err)
+	assert.ErrorContains(t, server.ValidateSchema(context.Background()), "no schema files match")
+
+	_, err = New(Config{SchemaFiles: []string{filepath.Join(dir, "[a-", "*.zed")}})
+	assert.Error(t, err, "invalid patterns are rejected by Validate")
+}
+
+func TestSchemaReloader_SchemaFileDependencies(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	schemaFile := write("schema.zed", "definition user {}")
+	otherFile := filepath.Join(dir, "other.zed")
+	yamlFile := write("validation.yaml", "schemaFile: schema.zed\n")
+
+	server, err := New(Config{
+		SchemaFiles:   []string{yamlFile},
+		GRPCAddress:   getFreePort(t),
+		WatchDebounce: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	nextEvent := func(t *testing.T) ReloadEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload event received")
+			return ReloadEvent{}
+		}
+	}
+	expectNoEvent := func(t *testing.T) {
+		t.Helper()
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected reload of %v", event.ChangedFiles)
+		case <-time.After(400 * time.Millisecond):
+		}
+	}
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, nextEvent(t).Err)
+
+	t.Run("editing the referenced file reloads", func(t *testing.T) {
+		write("schema.zed", "definition user {}\n\ndefinition document {}")
+		event := nextEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, []string{schemaFile}, event.ChangedFiles)
+		assert.Equal(t, []string{yamlFile}, event.Files)
+	})
+
+	t.Run("references are followed when they change", func(t *testing.T) {
+		write("validation.yaml", "schemaFile: other.zed\n")
+		event := nextEvent(t)
+		assert.Error(t, event.Err, "other.zed does not exist yet")
+
+		// The missing file is watched, so creating it reloads.
+		write("other.zed", "definition user {}\n\ndefinition folder {}")
+		event = nextEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, []string{otherFile}, event.ChangedFiles)
+
+		// The previously referenced file is no longer watched.
+		write("schema.zed", "definition user {}")
+		expectNoEvent(t)
+	})
+}
+
+func TestSchemaReloader_ReferencedFileInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schema.zed"), []byte("definition user {}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "validation.yaml"), []byte("schemaFile: schema.zed\n"), 0644))
+
+	server, err := New(Config{
+		SchemaFiles: []string{dir},
+		GRPCAddress: getFreePort(t),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	var startup ReloadEvent
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { startup = event })
+	require.NoError(t, server.Start(context.Background()))
+
+	// schema.zed is both in the directory and referenced by validation.yaml; it is only loaded once.
+	require.NoError(t, startup.Err)
+	assert.Len(t, server.SchemaHistory(), 1)
+}
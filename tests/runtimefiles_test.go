@@ -0,0 +1,130 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedServer_RuntimeSchemaFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	userFile := write("user.zed", "definition user {}")
+	documentFile := write("document.zed", "definition document {\n  relation reader: user\n}")
+	folderFile := write("folder.zed", "definition folder {\n  relation reader: user\n}")
+
+	server, err := New(Config{
+		SchemaFiles:   []string{userFile},
+		GRPCAddress:   getFreePort(t),
+		WatchDebounce: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	nextEvent := func(t *testing.T) ReloadEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reload event received")
+			return ReloadEvent{}
+		}
+	}
+	expectNoEvent := func(t *testing.T) {
+		t.Helper()
+		select {
+		case event := <-events:
+			t.Fatalf("unexpected %s reload of %v", event.Trigger, event.ChangedFiles)
+		case <-time.After(400 * time.Millisecond):
+		}
+	}
+	currentSchema := func() string {
+		history := server.SchemaHistory()
+		require.NotEmpty(t, history)
+		return history[len(history)-1].Schema
+	}
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, nextEvent(t).Err)
+
+	t.Run("adding a file reloads and watches it", func(t *testing.T) {
+		require.NoError(t, server.AddSchemaFiles(ctx, documentFile))
+		event := nextEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, ReloadTriggerSchemaFiles, event.Trigger)
+		assert.Equal(t, []string{documentFile}, event.ChangedFiles)
+		assert.Equal(t, []string{userFile, documentFile}, server.SchemaFiles())
+		assert.Contains(t, currentSchema(), "definition document")
+
+		write("document.zed", "definition document {\n  relation reader: user\n  relation writer: user\n}")
+		event = nextEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, ReloadTriggerWatcher, event.Trigger)
+		assert.Equal(t, []string{documentFile}, event.ChangedFiles)
+	})
+
+	t.Run("adding a configured file does nothing", func(t *testing.T) {
+		require.NoError(t, server.AddSchemaFiles(ctx, dir+"/./document.zed"))
+		expectNoEvent(t)
+		assert.Equal(t, []string{userFile, documentFile}, server.SchemaFiles())
+	})
+
+	t.Run("removing a file reloads and stops watching it", func(t *testing.T) {
+		require.NoError(t, server.RemoveSchemaFiles(ctx, documentFile))
+		event := nextEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, []string{documentFile}, event.ChangedFiles)
+		assert.Equal(t, []string{userFile}, server.SchemaFiles())
+		assert.NotContains(t, currentSchema(), "definition document")
+
+		write("document.zed", "definition document {}")
+		expectNoEvent(t)
+	})
+
+	t.Run("removing a file which is not configured fails", func(t *testing.T) {
+		assert.ErrorContains(t, server.RemoveSchemaFiles(ctx, userFile, folderFile), "is not configured")
+		assert.Equal(t, []string{userFile}, server.SchemaFiles())
+		expectNoEvent(t)
+	})
+
+	t.Run("replacing the files", func(t *testing.T) {
+		require.NoError(t, server.SetSchemaFiles(ctx, []string{userFile, folderFile}))
+		event := nextEvent(t)
+		require.NoError(t, event.Err)
+		assert.Equal(t, []string{folderFile}, event.ChangedFiles)
+		assert.Contains(t, currentSchema(), "definition folder")
+
+		assert.Error(t, server.SetSchemaFiles(ctx, []string{""}))
+		assert.Equal(t, []string{userFile, folderFile}, server.SchemaFiles())
+	})
+}
+
+func TestEmbeddedServer_RuntimeSchemaFilesBeforeStart(t *testing.T) {
+	schemaFile := createTempSchemaFile(t)
+
+	server, err := New(Config{GRPCAddress: getFreePort(t)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	// Before Start, only the configuration changes; Start loads the files.
+	require.NoError(t, server.AddSchemaFiles(context.Background(), schemaFile))
+	require.NoError(t, server.ValidateSchema(context.Background()))
+	require.NoError(t, server.Start(context.Background()))
+	assert.Len(t, server.SchemaHistory(), 1)
+}
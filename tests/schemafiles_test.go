@@ -0,0 +1,99 @@
+package embedspicedb_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akoserwal/embedspicedb/internal/schemafiles"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createSchemaTree creates the given files, relative to a new temporary directory.
+func createSchemaTree(t *testing.T, files ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("definition user {}"), 0o644))
+	}
+	return dir
+}
+
+func TestResolveSchemaFiles(t *testing.T) {
+	dir := createSchemaTree(t,
+		"root.zed",
+		"b/document.zed",
+		"a/user.zed",
+		"a/nested/folder.zed",
+		"a/validation.yaml",
+		"a/notes.txt",
+		".hidden/secret.zed",
+		"a/.skipped.zed",
+	)
+	at := func(files ...string) []string {
+		for i, file := range files {
+			files[i] = filepath.Join(dir, filepath.FromSlash(file))
+		}
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		entries []string
+		want    []string
+	}{
+		{
+			name:    "file",
+			entries: at("b/document.zed"),
+			want:    at("b/document.zed"),
+		},
+		{
+			name:    "missing file is kept",
+			entries: at("missing.zed"),
+			want:    at("missing.zed"),
+		},
+		{
+			name:    "directory",
+			entries: at("a"),
+			want:    at("a/nested/folder.zed", "a/user.zed", "a/validation.yaml"),
+		},
+		{
+			name:    "single level glob",
+			entries: at("*/*.zed"),
+			want:    at("a/user.zed", "b/document.zed"),
+		},
+		{
+			name:    "recursive glob",
+			entries: at("**/*.zed"),
+			want:    at("a/nested/folder.zed", "a/user.zed", "b/document.zed", "root.zed"),
+		},
+		{
+			name:    "glob without matches",
+			entries: at("missing/**/*.zed"),
+			want:    nil,
+		},
+		{
+			name:    "entry order is kept and duplicates are dropped",
+			entries: at("b/document.zed", "**/*.zed"),
+			want:    at("b/document.zed", "a/nested/folder.zed", "a/user.zed", "root.zed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := schemafiles.Resolve(tt.entries)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, files)
+		})
+	}
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := schemafiles.Resolve(at("[a-/*.zed"))
+		require.Error(t, err)
+	})
+}
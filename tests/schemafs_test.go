@@ -0,0 +1,151 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"embed"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed testdata/embedded
+var embeddedSchemas embed.FS
+
+func TestReadSchemaFileFS(t *testing.T) {
+	schema, err := ReadSchemaFileFS(embeddedSchemas, "testdata/embedded/validation.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, schema, "definition document", "schemaFile is resolved within the FS")
+
+	_, err = ReadSchemaFileFS(embeddedSchemas, "testdata/embedded/missing.zed")
+	assert.Error(t, err)
+}
+
+func TestEmbeddedServer_EmbeddedSchemaFS(t *testing.T) {
+	server, err := New(Config{
+		SchemaFS:          embeddedSchemas,
+		SchemaFiles:       []string{"testdata/embedded/validation.yaml"},
+		GRPCAddress:       getFreePort(t),
+		SeedRelationships: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	var startup ReloadEvent
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { startup = event })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, startup.Err)
+	assert.Equal(t, []string{"testdata/embedded/validation.yaml"}, startup.Files)
+
+	conn, err := server.Client(ctx)
+	require.NoError(t, err)
+	resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	require.NoError(t, err)
+	assert.Contains(t, resp.SchemaText, "definition document")
+
+	report := server.ValidationReport()
+	require.NotNil(t, report, "the assertions of the embedded validation file are evaluated")
+	assert.Equal(t, 1, report.Passed)
+
+	assert.NoError(t, server.ValidateSchema(ctx))
+	assert.NoError(t, server.ReloadSchema(ctx))
+
+	status, err := server.HealthCheck(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, status.Watcher, "embedded schema files are not watched")
+}
+
+func TestEmbeddedServer_SchemaFSDirectory(t *testing.T) {
+	fsys := fstest.MapFS{
+		"schemas/user.zed":     {Data: []byte("definition user {}")},
+		"schemas/document.zed": {Data: []byte("definition document {\n  relation reader: user\n}")},
+		"schemas/.hidden.zed":  {Data: []byte("definition hidden {")},
+	}
+
+	server, err := New(Config{SchemaFS: fsys, SchemaFiles: []string{"schemas/"}})
+	require.NoError(t, err)
+	assert.NoError(t, server.ValidateSchema(context.Background()))
+
+	server, err = New(Config{SchemaFS: fsys, SchemaFiles: []string{"schemas/*.zed"}})
+	require.NoError(t, err)
+	assert.NoError(t, server.ValidateSchema(context.Background()))
+
+	server, err = New(Config{SchemaFS: fsys, SchemaFiles: []string{"other/*.zed"}})
+	require.NoError(t, err)
+	assert.ErrorContains(t, server.ValidateSchema(context.Background()), "no schema files match")
+}
+
+func TestEmbeddedServer_SchemaFSPolling(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schema.zed"), []byte("definition user {}"), 0644))
+
+	server, err := New(Config{
+		SchemaFS:          os.DirFS(dir),
+		SchemaFiles:       []string{"schema.zed"},
+		GRPCAddress:       getFreePort(t),
+		WatchDebounce:     50 * time.Millisecond,
+		WatchPollInterval: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, (<-events).Err)
+
+	// File systems other than embed.FS may change, so they are polled.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "schema.zed"), []byte("definition user {}\n\ndefinition document {}"), 0644))
+	select {
+	case event := <-events:
+		require.NoError(t, event.Err)
+		assert.Equal(t, ReloadTriggerWatcher, event.Trigger)
+		assert.Equal(t, []string{"schema.zed"}, event.ChangedFiles)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event received")
+	}
+}
+
+func TestConfigValidate_SchemaFS(t *testing.T) {
+	fsys := fstest.MapFS{}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name:    "parent reference",
+			config:  Config{SchemaFS: fsys, SchemaFiles: []string{"../schema.zed"}},
+			wantErr: "SchemaFiles[0] is invalid",
+		},
+		{
+			name:    "absolute path",
+			config:  Config{SchemaFS: fsys, SchemaFiles: []string{"/schema.zed"}},
+			wantErr: "SchemaFiles[0] is invalid",
+		},
+		{
+			name:    "file system notifications",
+			config:  Config{SchemaFS: fsys, SchemaFiles: []string{"schema.zed"}, WatchMode: WatchModeFSNotify},
+			wantErr: "not supported with SchemaFS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.WithDefaults()
+			assert.ErrorContains(t, tt.config.Validate(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSchemaFiles writes the given files, keyed by slash-separated path, to a new directory.
+func writeSchemaFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestSchemaReloader_Imports(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"schema.zed":      "import \"common/user.zed\"\nimport \"document.zed\"\n\ndefinition folder {\n  relation document: document\n}",
+		"document.zed":    "import \"common/user.zed\"\n\ndefinition document {\n  relation reader: user\n}",
+		"common/user.zed": "/** user is a person */\ndefinition user {}",
+	})
+	schemaFile := filepath.Join(dir, "schema.zed")
+	documentFile := filepath.Join(dir, "document.zed")
+
+	schema, err := ReadSchemaFile(schemaFile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(schema, "definition user"), "files imported twice are included once")
+	assert.NotContains(t, schema, "import")
+	assert.Less(t, strings.Index(schema, "definition user"), strings.Index(schema, "definition document"), "imported files come first")
+
+	server, err := New(Config{
+		SchemaFiles:   []string{schemaFile},
+		GRPCAddress:   getFreePort(t),
+		WatchDebounce: 100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	events := make(chan ReloadEvent, 10)
+	server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+	ctx := context.Background()
+	require.NoError(t, server.ValidateSchema(ctx))
+	require.NoError(t, server.Start(ctx))
+	require.NoError(t, (<-events).Err)
+
+	// Imported files are watched like files referenced by validation files.
+	require.NoError(t, os.WriteFile(documentFile, []byte("import \"common/user.zed\"\n\ndefinition document {\n  relation reader: user\n  relation writer: user\n}"), 0644))
+	select {
+	case event := <-events:
+		require.NoError(t, event.Err)
+		assert.Equal(t, []string{documentFile}, event.ChangedFiles)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload event received")
+	}
+	history := server.SchemaHistory()
+	assert.Contains(t, history[len(history)-1].Schema, "relation writer: user")
+}
+
+func TestSchemaReloader_SharedDefinitions(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"document.zed": "definition user {}\n\ndefinition document {\n  relation reader: user\n}",
+		"folder.zed":   "// user is also declared by document.zed\ndefinition user {}\n\ndefinition folder {\n  relation document: document\n}",
+	})
+
+	server, err := New(Config{
+		SchemaFiles: []string{dir},
+		GRPCAddress: getFreePort(t),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+	require.NoError(t, server.Start(context.Background()))
+
+	history := server.SchemaHistory()
+	require.Len(t, history, 1)
+	assert.Equal(t, 1, strings.Count(history[0].Schema, "definition user"), "identical definitions are deduplicated")
+	assert.Contains(t, history[0].Schema, "definition folder")
+}
+
+func TestSchemaReloader_CommentedImports(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"schema.zed": "import \"user.zed\"\n/*\nimport \"old.zed\"\n*/\n// import \"missing.zed\"\n\ndefinition document {\n  relation reader: user\n}",
+		"user.zed":   "definition user {}",
+		"old.zed":    "definition user {\n  relation manager: user\n}",
+	})
+
+	schema, err := ReadSchemaFile(filepath.Join(dir, "schema.zed"))
+	require.NoError(t, err)
+	assert.NotContains(t, schema, "relation manager", "imports in comments are ignored")
+	assert.Equal(t, 1, strings.Count(schema, "definition user"))
+}
+
+func TestValidateSchema_CaveatSharingDefinitionName(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"a.zed": "definition user {}",
+		"b.zed": "caveat user(allowed bool) {\n  allowed\n}",
+	})
+	server, err := New(Config{SchemaFiles: []string{dir}})
+	require.NoError(t, err)
+
+	err = server.ValidateSchema(context.Background())
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "conflicts with", "left to the compiler to report")
+}
+
+func TestValidateSchema_ImportErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantFile string
+		wantLine int
+		wantMsg  string
+	}{
+		{
+			name: "conflicting definitions",
+			files: map[string]string{
+				"a.zed": "definition user {}\n\ndefinition document {\n  relation reader: user\n}",
+				"b.zed": "definition user {}\n\ndefinition document {\n  relation writer: user\n}",
+			},
+			wantFile: "b.zed",
+			wantLine: 3,
+			wantMsg:  "definition document conflicts with the one declared at ",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.zed": "import \"b.zed\"\n\ndefinition user {}",
+				"b.zed": "definition document {}\n\nimport \"a.zed\"",
+			},
+			wantFile: "b.zed",
+			wantLine: 3,
+			wantMsg:  "import cycle",
+		},
+		{
+			name: "missing import",
+			files: map[string]string{
+				"a.zed": "definition user {}\n\nimport \"missing.zed\"",
+			},
+			wantFile: "a.zed",
+			wantLine: 3,
+			wantMsg:  "failed to import",
+		},
+		{
+			name: "import outside the directory",
+			files: map[string]string{
+				"a.zed": "import \"../user.zed\"",
+			},
+			wantFile: "a.zed",
+			wantLine: 1,
+			wantMsg:  "is not local",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeSchemaFiles(t, tt.files)
+			server, err := New(Config{SchemaFiles: []string{dir}})
+			require.NoError(t, err)
+
+			err = server.ValidateSchema(context.Background())
+			var schemaErr *SchemaError
+			require.True(t, errors.As(err, &schemaErr), "expected a SchemaError, got %v", err)
+			assert.Equal(t, filepath.Join(dir, tt.wantFile), schemaErr.File)
+			assert.Equal(t, tt.wantLine, schemaErr.Line)
+			assert.Contains(t, schemaErr.Message, tt.wantMsg)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const templatedSchema = `definition user {}
+
+definition document {
+  relation {{ .relation }}: user
+{{- if .sharing }}
+  relation shared_with: user
+{{- end }}
+  permission read = {{ .relation }}
+}`
+
+func TestRenderSchemaFile(t *testing.T) {
+	schemaFile := createTempFile(t, "schema.zed", templatedSchema)
+
+	rendered, err := RenderSchemaFile(nil, schemaFile, map[string]any{"relation": "viewer", "sharing": true})
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "relation viewer: user")
+	assert.Contains(t, rendered, "relation shared_with: user")
+	assert.Contains(t, rendered, "permission read = viewer")
+
+	rendered, err = RenderSchemaFile(nil, schemaFile, map[string]any{"relation": "reader", "sharing": false})
+	require.NoError(t, err)
+	assert.NotContains(t, rendered, "shared_with")
+
+	t.Setenv("EMBEDSPICEDB_TEST_RELATION", "owner")
+	envFile := createTempFile(t, "schema.zed", "definition user {}\n\ndefinition document {\n  relation {{ env \"EMBEDSPICEDB_TEST_RELATION\" }}: user\n}")
+	rendered, err = RenderSchemaFile(nil, envFile, nil)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "relation owner: user")
+}
+
+func TestEmbeddedServer_SchemaVars(t *testing.T) {
+	schemaFile := createTempFile(t, "schema.zed", templatedSchema)
+
+	server, err := New(Config{
+		SchemaFiles: []string{schemaFile},
+		SchemaVars:  map[string]any{"relation": "viewer", "sharing": true},
+		GRPCAddress: getFreePort(t),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	ctx := context.Background()
+	require.NoError(t, server.ValidateSchema(ctx))
+	require.NoError(t, server.Start(ctx))
+
+	history := server.SchemaHistory()
+	require.Len(t, history, 1)
+	assert.Contains(t, history[0].Schema, "relation shared_with: user", "the rendered schema is written")
+	assert.NotContains(t, history[0].Schema, "{{")
+}
+
+func TestEmbeddedServer_SchemaVarsSkipURLs(t *testing.T) {
+	t.Setenv("EMBEDSPICEDB_TEST_SECRET", "hunter2")
+	handler := &schemaHandler{}
+	handler.set("// {{ env \"EMBEDSPICEDB_TEST_SECRET\" }}\ndefinition folder {}\n", "", time.Time{})
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	server, err := New(Config{
+		SchemaFiles: []string{createTempFile(t, "schema.zed", templatedSchema)},
+		SchemaURLs:  []string{ts.URL + "/folder.zed"},
+		SchemaVars:  map[string]any{"relation": "viewer", "sharing": false},
+		GRPCAddress: getFreePort(t),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+	require.NoError(t, server.Start(context.Background()))
+
+	history := server.SchemaHistory()
+	require.Len(t, history, 1)
+	assert.Contains(t, history[0].Schema, "relation viewer: user", "schema files are rendered")
+	assert.Contains(t, history[0].Schema, `{{ env "EMBEDSPICEDB_TEST_SECRET" }}`, "schema URLs are not")
+	assert.NotContains(t, history[0].Schema, "hunter2")
+}
+
+func TestEmbeddedServer_SchemaVarsErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		schema     string
+		vars       map[string]any
+		wantLine   int
+		wantColumn int
+		wantMsg    string
+		wantRender bool
+	}{
+		{
+			name:       "missing variable",
+			schema:     templatedSchema,
+			vars:       map[string]any{"sharing": false},
+			wantLine:   4,
+			wantColumn: 15,
+			wantMsg:    `map has no entry for key "relation"`,
+		},
+		{
+			name:     "template syntax",
+			schema:   "definition user {}\n\ndefinition document {\n  relation {{ .relation: user\n}",
+			vars:     map[string]any{"relation": "viewer"},
+			wantLine: 4,
+			wantMsg:  "expected :=",
+		},
+		{
+			name:       "rendered schema",
+			schema:     "definition user {}\n\ndefinition document {\n  relation viewer: {{ .subject }}\n}",
+			vars:       map[string]any{"subject": "group"},
+			wantLine:   4,
+			wantMsg:    "group",
+			wantRender: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schemaFile := createTempFile(t, "schema.zed", tt.schema)
+			server, err := New(Config{SchemaFiles: []string{schemaFile}, SchemaVars: tt.vars})
+			require.NoError(t, err)
+
+			err = server.ValidateSchema(context.Background())
+			var schemaErr *SchemaError
+			require.True(t, errors.As(err, &schemaErr), "expected a SchemaError, got %v", err)
+			assert.Equal(t, schemaFile, schemaErr.File)
+			assert.Equal(t, tt.wantLine, schemaErr.Line)
+			if tt.wantColumn != 0 {
+				assert.Equal(t, tt.wantColumn, schemaErr.Column)
+			}
+			assert.Contains(t, schemaErr.Message, tt.wantMsg)
+			if tt.wantRender {
+				assert.Contains(t, schemaErr.Rendered, "relation viewer: group", "the rendered schema is available for debugging")
+			} else {
+				assert.Empty(t, schemaErr.Rendered)
+			}
+		})
+	}
+}
+
+func TestEmbeddedServer_SchemaVarsDisabled(t *testing.T) {
+	schemaFile := createTempFile(t, "schema.zed", templatedSchema)
+	server, err := New(Config{SchemaFiles: []string{schemaFile}})
+	require.NoError(t, err)
+
+	var schemaErr *SchemaError
+	assert.True(t, errors.As(server.ValidateSchema(context.Background()), &schemaErr), "without SchemaVars, files are compiled as is")
+}
@@ -0,0 +1,207 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schemaHandler serves a schema, answering conditional requests with http.ServeContent.
+type schemaHandler struct {
+	mu          sync.Mutex
+	body        string
+	etag        string
+	modTime     time.Time
+	status      int
+	requests    int
+	notModified int
+}
+
+func (h *schemaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.requests++
+	if h.status != 0 {
+		w.WriteHeader(h.status)
+		return
+	}
+	if h.etag != "" {
+		w.Header().Set("ETag", h.etag)
+	}
+	recorder := &statusRecorder{ResponseWriter: w}
+	http.ServeContent(recorder, r, "", h.modTime, strings.NewReader(h.body))
+	if recorder.status == http.StatusNotModified {
+		h.notModified++
+	}
+}
+
+func (h *schemaHandler) set(body, etag string, modTime time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.body, h.etag, h.modTime = body, etag, modTime
+}
+
+func (h *schemaHandler) notModifiedCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.notModified
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.status = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+const urlDocumentSchema = `definition user {}
+
+definition document {
+  relation reader: user
+  permission read = reader
+}`
+
+func TestSchemaURLs_ConditionalPolling(t *testing.T) {
+	initial := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name    string
+		initial func(h *schemaHandler)
+		update  func(h *schemaHandler)
+	}{
+		{
+			name:    "etag",
+			initial: func(h *schemaHandler) { h.set("definition user {}", `"v1"`, time.Time{}) },
+			update:  func(h *schemaHandler) { h.set(urlDocumentSchema, `"v2"`, time.Time{}) },
+		},
+		{
+			name:    "last-modified",
+			initial: func(h *schemaHandler) { h.set("definition user {}", "", initial) },
+			update:  func(h *schemaHandler) { h.set(urlDocumentSchema, "", initial.Add(time.Minute)) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &schemaHandler{}
+			tt.initial(handler)
+			ts := httptest.NewServer(handler)
+			t.Cleanup(ts.Close)
+			schemaURL := ts.URL + "/schema.zed"
+
+			server, err := New(Config{
+				SchemaURLs:            []string{schemaURL},
+				SchemaURLPollInterval: 50 * time.Millisecond,
+				GRPCAddress:           getFreePort(t),
+			})
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = server.Stop() })
+
+			events := make(chan ReloadEvent, 10)
+			server.OnSchemaReloadEvent(func(event ReloadEvent) { events <- event })
+
+			ctx := context.Background()
+			require.NoError(t, server.Start(ctx))
+			startup := <-events
+			require.NoError(t, startup.Err)
+			assert.Equal(t, []string{schemaURL}, startup.Files)
+
+			// Polls of the unchanged schema are answered with 304 Not Modified and don't reload.
+			require.Eventually(t, func() bool { return handler.notModifiedCount() >= 3 }, 5*time.Second, 20*time.Millisecond)
+			select {
+			case event := <-events:
+				t.Fatalf("unexpected %s reload", event.Trigger)
+			default:
+			}
+
+			tt.update(handler)
+			select {
+			case event := <-events:
+				require.NoError(t, event.Err)
+				assert.Equal(t, ReloadTriggerURL, event.Trigger)
+				assert.Equal(t, []string{schemaURL}, event.ChangedFiles)
+			case <-time.After(5 * time.Second):
+				t.Fatal("no reload event received")
+			}
+
+			conn, err := server.Client(ctx)
+			require.NoError(t, err)
+			resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+			require.NoError(t, err)
+			assert.Contains(t, resp.SchemaText, "definition document")
+		})
+	}
+}
+
+func TestSchemaURLs_CombinedWithFiles(t *testing.T) {
+	handler := &schemaHandler{}
+	handler.set("schema: |-\n  definition document {\n    relation reader: user\n  }\n", "", time.Time{})
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	schemaURL := ts.URL + "/document.yaml"
+
+	userFile := filepath.Join(t.TempDir(), "user.zed")
+	require.NoError(t, os.WriteFile(userFile, []byte("definition user {}"), 0644))
+
+	server, err := New(Config{
+		SchemaFiles: []string{userFile},
+		SchemaURLs:  []string{schemaURL},
+		GRPCAddress: getFreePort(t),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	ctx := context.Background()
+	require.NoError(t, server.ValidateSchema(ctx), "the URL is fetched without starting the server")
+	require.NoError(t, server.Start(ctx))
+
+	history := server.SchemaHistory()
+	require.Len(t, history, 1)
+	assert.Equal(t, []string{userFile, schemaURL}, history[0].Files)
+	assert.Contains(t, history[0].Schema, "definition user")
+	assert.Contains(t, history[0].Schema, "definition document")
+
+	// Errors in the fetched schema point at the URL.
+	handler.set("schema: |-\n  definition document {\n    relation reader: missing\n  }\n", "", time.Time{})
+	err = server.ValidateSchema(ctx)
+	var schemaErr *SchemaError
+	require.True(t, errors.As(err, &schemaErr), "expected a SchemaError, got %v", err)
+	assert.Equal(t, schemaURL, schemaErr.File)
+}
+
+func TestSchemaURLs_FetchError(t *testing.T) {
+	handler := &schemaHandler{status: http.StatusInternalServerError}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	server, err := New(Config{SchemaURLs: []string{ts.URL + "/schema.zed"}})
+	require.NoError(t, err)
+	assert.ErrorContains(t, server.ValidateSchema(context.Background()), "unexpected status 500")
+}
+
+func TestConfigValidate_SchemaURLs(t *testing.T) {
+	for _, schemaURL := range []string{"ftp://example.com/schema.zed", "https:///schema.zed", "schema.zed"} {
+		t.Run(schemaURL, func(t *testing.T) {
+			config := DefaultConfig()
+			config.SchemaURLs = []string{schemaURL}
+			assert.ErrorContains(t, config.Validate(), "SchemaURLs[0]")
+		})
+	}
+}
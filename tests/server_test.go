@@ -3,6 +3,7 @@ package embedspicedb_test
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -616,6 +617,21 @@ func TestCreateDatastore(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "sqlite",
+			config: Config{
+				DatastoreType: "sqlite",
+				DatastoreURI:  filepath.Join(t.TempDir(), "spicedb.db"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "sqlite without path",
+			config: Config{
+				DatastoreType: "sqlite",
+			},
+			wantErr: true,
+		},
 		{
 			name: "postgres not available",
 			config: Config{
@@ -0,0 +1,89 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestEmbeddedServer_Shutdown(t *testing.T) {
+	server, err := New(Config{
+		SchemaFiles: []string{createTempSchemaFile(t)},
+		GRPCAddress: "127.0.0.1:0",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	report, err := server.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &ShutdownReport{}, report, "not started")
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	conn, err := server.Client(ctx)
+	require.NoError(t, err)
+	_, err = v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	require.NoError(t, err)
+
+	report, err = server.Shutdown(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.Forced, "no calls were running")
+	assert.Empty(t, report.Calls)
+	assert.Zero(t, report.Connections)
+	assert.Empty(t, server.GRPCAddr())
+
+	_, err = server.Client(ctx)
+	assert.Error(t, err)
+	assert.NoError(t, server.Stop(), "already stopped")
+}
+
+func TestEmbeddedServer_ShutdownTerminatesWatchStreams(t *testing.T) {
+	server, err := New(Config{
+		SchemaFiles: []string{createTempSchemaFile(t)},
+		GRPCAddress: "127.0.0.1:0",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+
+	// Watch streams which stay open until they are terminated, on the server's own connection and
+	// on an external client's
+	conn, err := server.Client(ctx)
+	require.NoError(t, err)
+	stream, err := v1.NewWatchServiceClient(conn).Watch(ctx, &v1.WatchRequest{})
+	require.NoError(t, err)
+
+	external, err := grpc.NewClient(server.GRPCAddr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = external.Close() })
+	externalStream, err := v1.NewWatchServiceClient(external).Watch(ctx, &v1.WatchRequest{})
+	require.NoError(t, err)
+	// A call on the same connection, made once the stream is open, lets the stream reach the server
+	_, err = v1.NewSchemaServiceClient(external).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	require.NoError(t, err)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer cancel()
+	report, err := server.Shutdown(shutdownCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.True(t, report.Forced)
+	assert.Equal(t, 1, report.Connections, "the external client's connection was closed")
+	assert.Equal(t, []string{"/authzed.api.v1.WatchService/Watch", "/authzed.api.v1.WatchService/Watch"}, report.Calls, "both streams are listed")
+	assert.Less(t, report.Duration, 5*time.Second)
+
+	_, err = stream.Recv()
+	assert.Error(t, err, "the stream was terminated")
+	_, err = externalStream.Recv()
+	assert.Error(t, err, "the external stream was terminated")
+}
@@ -0,0 +1,294 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// testCert is a certificate and its key, signed by a test CA or self-signed.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate for localhost, signed by ca or, if ca is nil, a self-signed CA.
+func newTestCert(t *testing.T, name string, ca *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+	}
+	parent, parentKey := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+		parent, parentKey = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key}
+}
+
+// write writes the certificate and key as PEM files in dir, returning their paths.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key, Leaf: c.cert}
+}
+
+func (c *testCert) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// readSchemaOver reads the schema with a client dialing address with creds.
+func readSchemaOver(t *testing.T, address string, creds credentials.TransportCredentials) error {
+	t.Helper()
+	conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(creds))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+	return err
+}
+
+func TestEmbeddedServer_TLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	server, err := New(Config{
+		SchemaFiles:        []string{createTempSchemaFile(t)},
+		GRPCAddress:        "127.0.0.1:0",
+		HTTPEnabled:        true,
+		HTTPAddress:        "127.0.0.1:0",
+		HealthCheckEnabled: true,
+		TLSCertFile:        certFile,
+		TLSKeyFile:         keyFile,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	require.Len(t, server.SchemaHistory(), 1, "the server's own connection loaded the schema")
+	grpcAddress := server.GRPCAddr()
+
+	t.Run("gRPC", func(t *testing.T) {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: ca.pool()})
+		assert.NoError(t, readSchemaOver(t, grpcAddress, creds))
+		assert.Error(t, readSchemaOver(t, grpcAddress, insecure.NewCredentials()), "plaintext is refused")
+	})
+
+	t.Run("health check", func(t *testing.T) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool()}}}
+		resp, err := client.Get("https://" + server.HealthCheckHTTPAddr() + "/healthz")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotNil(t, resp.TLS)
+	})
+}
+
+func TestEmbeddedServer_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	server, err := New(Config{
+		SchemaFiles:     []string{createTempSchemaFile(t)},
+		GRPCAddress:     "127.0.0.1:0",
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: caFile,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+	grpcAddress := server.GRPCAddr()
+
+	t.Run("the server's own connection is accepted", func(t *testing.T) {
+		conn, err := server.Client(ctx)
+		require.NoError(t, err)
+		resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+		require.NoError(t, err)
+		assert.Contains(t, resp.SchemaText, "definition document")
+	})
+
+	t.Run("clients with a certificate signed by the client CA are accepted", func(t *testing.T) {
+		client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+		creds := credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: []tls.Certificate{client.tlsCertificate()},
+		})
+		assert.NoError(t, readSchemaOver(t, grpcAddress, creds))
+	})
+
+	t.Run("clients without a certificate are refused", func(t *testing.T) {
+		creds := credentials.NewTLS(&tls.Config{RootCAs: ca.pool()})
+		assert.Error(t, readSchemaOver(t, grpcAddress, creds))
+	})
+
+	t.Run("clients with a certificate signed by another CA are refused", func(t *testing.T) {
+		otherCA := newTestCert(t, "other-ca", nil, 0)
+		client := newTestCert(t, "client", otherCA, x509.ExtKeyUsageClientAuth)
+		creds := credentials.NewTLS(&tls.Config{
+			RootCAs: ca.pool(),
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				cert := client.tlsCertificate()
+				return &cert, nil
+			},
+		})
+		assert.Error(t, readSchemaOver(t, grpcAddress, creds))
+	})
+}
+
+func TestEmbeddedServer_TLSCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, 0)
+	certFile, keyFile := newTestCert(t, "first", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+
+	server, err := New(Config{
+		SchemaFiles: []string{createTempSchemaFile(t)},
+		GRPCAddress: "127.0.0.1:0",
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+	require.NoError(t, server.Start(context.Background()))
+	grpcAddress := server.GRPCAddr()
+
+	servedCertificate := func() string {
+		conn, err := tls.Dial("tcp", grpcAddress, &tls.Config{RootCAs: ca.pool(), NextProtos: []string{"h2"}})
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}
+	require.Equal(t, "first", servedCertificate())
+
+	newTestCert(t, "second", ca, x509.ExtKeyUsageServerAuth).write(t, dir, "server")
+	assert.Eventually(t, func() bool { return servedCertificate() == "second" }, 5*time.Second, 100*time.Millisecond)
+
+	// The server's own connection is in-process, and unaffected by the rotation.
+	require.NoError(t, server.ReloadSchema(context.Background()))
+}
+
+func TestEmbeddedServer_TLSConfig(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, 0)
+	serverCert := newTestCert(t, "server", ca, x509.ExtKeyUsageServerAuth)
+
+	server, err := New(Config{
+		SchemaFiles: []string{createTempSchemaFile(t)},
+		GRPCAddress: "127.0.0.1:0",
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{serverCert.tlsCertificate()},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    ca.pool(),
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+	require.NoError(t, server.Start(context.Background()))
+	require.Len(t, server.SchemaHistory(), 1, "the server's own connection loaded the schema")
+	grpcAddress := server.GRPCAddr()
+
+	client := newTestCert(t, "client", ca, x509.ExtKeyUsageClientAuth)
+	creds := credentials.NewTLS(&tls.Config{
+		RootCAs:      ca.pool(),
+		Certificates: []tls.Certificate{client.tlsCertificate()},
+	})
+	assert.NoError(t, readSchemaOver(t, grpcAddress, creds))
+}
+
+func TestConfigValidate_TLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{
+			name:    "certificate without key",
+			modify:  func(c *Config) { c.TLSCertFile = "server.crt" },
+			wantErr: "TLSCertFile and TLSKeyFile must be set together",
+		},
+		{
+			name:    "client CA without certificate",
+			modify:  func(c *Config) { c.TLSClientCAFile = "ca.crt" },
+			wantErr: "TLSClientCAFile requires TLSCertFile and TLSKeyFile",
+		},
+		{
+			name: "files and TLSConfig",
+			modify: func(c *Config) {
+				c.TLSCertFile, c.TLSKeyFile = "server.crt", "server.key"
+				c.TLSConfig = &tls.Config{Certificates: []tls.Certificate{{}}}
+			},
+			wantErr: "TLSConfig can't be combined",
+		},
+		{
+			name:    "TLSConfig without certificates",
+			modify:  func(c *Config) { c.TLSConfig = &tls.Config{} },
+			wantErr: "TLSConfig must set Certificates or GetCertificate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			tt.modify(&config)
+			assert.ErrorContains(t, config.Validate(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package embedspicedb_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/akoserwal/embedspicedb"
+
+	v1 "github.com/authzed/authzed-go/proto/authzed/api/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// socketDir returns a directory for sockets whose path is short enough for the socket path limit,
+// which t.TempDir can exceed.
+func socketDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "sock")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+// unixHTTPClient returns an HTTP client sending every request to the socket at path.
+func unixHTTPClient(path string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func TestEmbeddedServer_UnixSockets(t *testing.T) {
+	dir := socketDir(t)
+	grpcSocket := filepath.Join(dir, "grpc.sock")
+	httpSocket := filepath.Join(dir, "http.sock")
+	healthSocket := filepath.Join(dir, "health.sock")
+
+	server, err := New(Config{
+		SchemaFiles:        []string{createTempSchemaFile(t)},
+		GRPCAddress:        "unix://" + grpcSocket,
+		HTTPEnabled:        true,
+		HTTPAddress:        "unix://" + httpSocket,
+		HealthCheckEnabled: true,
+		HealthCheckAddress: "unix://" + healthSocket,
+		PresharedKey:       "test-key",
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+
+	ctx := context.Background()
+	require.NoError(t, server.Start(ctx))
+
+	for _, path := range []string{grpcSocket, httpSocket, healthSocket} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, fs.ModeSocket, info.Mode().Type(), path)
+		assert.Equal(t, fs.FileMode(0o600), info.Mode().Perm(), path)
+	}
+	assert.Equal(t, "unix://"+healthSocket, server.HealthCheckHTTPAddr())
+
+	t.Run("gRPC", func(t *testing.T) {
+		conn, err := grpc.NewClient("unix://"+grpcSocket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		defer conn.Close()
+
+		resp, err := v1.NewSchemaServiceClient(conn).ReadSchema(ctx, &v1.ReadSchemaRequest{})
+		require.NoError(t, err)
+		assert.Contains(t, resp.SchemaText, "definition document")
+	})
+
+	t.Run("HTTP gateway", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://gateway/v1/schema/read", strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer test-key")
+		resp, err := unixHTTPClient(httpSocket).Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.Contains(t, string(body), "definition document")
+	})
+
+	t.Run("health check", func(t *testing.T) {
+		resp, err := unixHTTPClient(healthSocket).Get("http://health/healthz")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("sockets are removed on Stop", func(t *testing.T) {
+		require.NoError(t, server.Stop())
+		for _, path := range []string{grpcSocket, httpSocket, healthSocket} {
+			_, err := os.Stat(path)
+			assert.ErrorIs(t, err, fs.ErrNotExist, path)
+		}
+	})
+}
+
+func TestEmbeddedServer_UnixSocketMode(t *testing.T) {
+	grpcSocket := filepath.Join(socketDir(t), "grpc.sock")
+
+	server, err := New(Config{
+		GRPCAddress: "unix://" + grpcSocket,
+		SocketMode:  0o660,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = server.Stop() })
+	require.NoError(t, server.Start(context.Background()))
+
+	info, err := os.Stat(grpcSocket)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o660), info.Mode().Perm())
+}
+
+func TestEmbeddedServer_StaleUnixSocket(t *testing.T) {
+	dir := socketDir(t)
+
+	t.Run("a socket nothing listens on is replaced", func(t *testing.T) {
+		grpcSocket := filepath.Join(dir, "stale.sock")
+		ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: grpcSocket, Net: "unix"})
+		require.NoError(t, err)
+		ln.SetUnlinkOnClose(false)
+		require.NoError(t, ln.Close())
+
+		server, err := New(Config{GRPCAddress: "unix://" + grpcSocket})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+		require.NoError(t, server.Start(context.Background()))
+	})
+
+	t.Run("a socket in use is kept", func(t *testing.T) {
+		grpcSocket := filepath.Join(dir, "busy.sock")
+		ln, err := net.Listen("unix", grpcSocket)
+		require.NoError(t, err)
+		defer ln.Close()
+
+		server, err := New(Config{GRPCAddress: "unix://" + grpcSocket})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+		assert.ErrorContains(t, server.Start(context.Background()), "is already in use")
+	})
+
+	t.Run("other files are never replaced", func(t *testing.T) {
+		grpcSocket := filepath.Join(dir, "file.sock")
+		require.NoError(t, os.WriteFile(grpcSocket, []byte("data"), 0o644))
+
+		server, err := New(Config{GRPCAddress: "unix://" + grpcSocket})
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = server.Stop() })
+		assert.ErrorContains(t, server.Start(context.Background()), "is not a socket")
+
+		data, err := os.ReadFile(grpcSocket)
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(data))
+	})
+}
+
+func TestConfigValidate_UnixSockets(t *testing.T) {
+	config := DefaultConfig()
+	config.GRPCAddress = "unix:///run/spicedb.sock"
+	config.HTTPEnabled = true
+	config.HTTPAddress = "unix://gateway.sock"
+	assert.NoError(t, config.Validate())
+
+	config.GRPCAddress = "unix://"
+	assert.ErrorContains(t, config.Validate(), "socket path must not be empty")
+
+	config.GRPCAddress = "unix:///run/spicedb.sock"
+	config.SocketMode = fs.ModeDir | 0o700
+	assert.ErrorContains(t, config.Validate(), "SocketMode")
+}
@@ -1,10 +1,14 @@
 package embedspicedb_test
 
 import (
+	"errors"
+	"fmt"
 	. "github.com/akoserwal/embedspicedb"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -402,3 +406,411 @@ func TestFileWatcher_ContextCancellation(t *testing.T) {
 		time.Sleep(100 * time.Millisecond)
 	})
 }
+
+func TestFileWatcher_ChangedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile1 := filepath.Join(tmpDir, "test1.zed")
+	tmpFile2 := filepath.Join(tmpDir, "test2.zed")
+	require.NoError(t, os.WriteFile(tmpFile1, []byte("content1"), 0644))
+	require.NoError(t, os.WriteFile(tmpFile2, []byte("content2"), 0644))
+
+	changes := make(chan []string, 1)
+	watcher, err := NewFileWatcherWithChanges([]string{tmpFile1, tmpFile2}, 100*time.Millisecond, func(changed []string) error {
+		changes <- changed
+		return nil
+	})
+	require.NoError(t, err)
+	defer watcher.Stop()
+	require.NoError(t, watcher.Start())
+
+	// Wait a bit for watcher to be ready
+	time.Sleep(50 * time.Millisecond)
+
+	// Both writes fall within one debounce window
+	require.NoError(t, os.WriteFile(tmpFile2, []byte("updated2"), 0644))
+	require.NoError(t, os.WriteFile(tmpFile1, []byte("updated1"), 0644))
+
+	select {
+	case changed := <-changes:
+		assert.Equal(t, []string{tmpFile1, tmpFile2}, changed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("reload function was not called")
+	}
+}
+
+// startChangeWatcher starts a watcher on file which reports each reload's changed files.
+func startChangeWatcher(t *testing.T, file string, opts ...WatcherOption) <-chan []string {
+	t.Helper()
+
+	changes := make(chan []string, 10)
+	watcher, err := NewFileWatcherWithChanges([]string{file}, 100*time.Millisecond, func(changed []string) error {
+		changes <- changed
+		return nil
+	}, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = watcher.Stop() })
+	require.NoError(t, watcher.Start())
+
+	// Wait a bit for watcher to be ready
+	time.Sleep(50 * time.Millisecond)
+	return changes
+}
+
+func expectReload(t *testing.T, changes <-chan []string, file string) {
+	t.Helper()
+	select {
+	case changed := <-changes:
+		assert.Equal(t, []string{file}, changed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("reload function was not called")
+	}
+}
+
+func expectNoReload(t *testing.T, changes <-chan []string) {
+	t.Helper()
+	select {
+	case changed := <-changes:
+		t.Fatalf("unexpected reload of %v", changed)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestFileWatcher_EditorSaveStrategies(t *testing.T) {
+	strategies := map[string]func(t *testing.T, path string, content []byte){
+		"in-place write": func(t *testing.T, path string, content []byte) {
+			require.NoError(t, os.WriteFile(path, content, 0644))
+		},
+
+		// vim with `backupcopy=no`: probe the directory, move the original to a backup, write a new
+		// file and drop the backup. The swap file is written throughout the edit.
+		"vim backup and rewrite": func(t *testing.T, path string, content []byte) {
+			dir, name := filepath.Split(path)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "."+name+".swp"), []byte("swap"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "4913"), nil, 0644))
+			require.NoError(t, os.Remove(filepath.Join(dir, "4913")))
+			require.NoError(t, os.Rename(path, path+"~"))
+			require.NoError(t, os.WriteFile(path, content, 0644))
+			require.NoError(t, os.Remove(path+"~"))
+		},
+
+		// JetBrains IDEs' safe write: write a temporary file, move the original aside, move the
+		// temporary file into place and drop the original.
+		"jetbrains safe write": func(t *testing.T, path string, content []byte) {
+			require.NoError(t, os.WriteFile(path+"___jb_tmp___", content, 0644))
+			require.NoError(t, os.Rename(path, path+"___jb_old___"))
+			require.NoError(t, os.Rename(path+"___jb_tmp___", path))
+			require.NoError(t, os.Remove(path+"___jb_old___"))
+		},
+
+		// Atomic writers: write a randomly named file next to the original and rename it over.
+		"atomic rename over": func(t *testing.T, path string, content []byte) {
+			tmp, err := os.CreateTemp(filepath.Dir(path), "schema-")
+			require.NoError(t, err)
+			_, err = tmp.Write(content)
+			require.NoError(t, err)
+			require.NoError(t, tmp.Close())
+			require.NoError(t, os.Rename(tmp.Name(), path))
+		},
+
+		"remove and recreate": func(t *testing.T, path string, content []byte) {
+			require.NoError(t, os.Remove(path))
+			require.NoError(t, os.WriteFile(path, content, 0644))
+		},
+	}
+
+	for _, mode := range []WatchMode{WatchModeFSNotify, WatchModePoll} {
+		for name, save := range strategies {
+			t.Run(string(mode)+"/"+name, func(t *testing.T) {
+				tmpFile := createTempFile(t, "schema.zed", "initial")
+				changes := startChangeWatcher(t, tmpFile, WithWatchMode(mode, 20*time.Millisecond))
+
+				// Hot reload must keep working after the first save replaced the file.
+				for i := range 3 {
+					save(t, tmpFile, []byte(fmt.Sprintf("save %d", i)))
+					expectReload(t, changes, tmpFile)
+				}
+				expectNoReload(t, changes)
+			})
+		}
+	}
+}
+
+func TestFileWatcher_IgnoresEditorTempFiles(t *testing.T) {
+	tmpFile := createTempFile(t, "schema.zed", "initial")
+	changes := startChangeWatcher(t, tmpFile)
+
+	dir := filepath.Dir(tmpFile)
+	for _, name := range []string{".schema.zed.swp", ".schema.zed.swpx", "schema.zed~", "4913", "#schema.zed#", ".#schema.zed", "schema.zed.bak"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("noise"), 0644))
+	}
+
+	// Permission changes alone don't change the schema.
+	require.NoError(t, os.Chmod(tmpFile, 0600))
+
+	expectNoReload(t, changes)
+}
+
+func TestFileWatcher_RemovedFile(t *testing.T) {
+	tmpFile := createTempFile(t, "schema.zed", "initial")
+	changes := startChangeWatcher(t, tmpFile)
+
+	// A removed file is not reloaded until it is recreated.
+	require.NoError(t, os.Remove(tmpFile))
+	expectNoReload(t, changes)
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte("recreated"), 0644))
+	expectReload(t, changes, tmpFile)
+}
+
+func TestFileWatcher_SymlinkSwap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on Windows")
+	}
+
+	// Lay the directory out like a Kubernetes ConfigMap volume: schema.zed -> ..data/schema.zed,
+	// with ..data a symlink to the current timestamped directory.
+	dir := t.TempDir()
+	writeVersion := func(version, content string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, version), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, version, "schema.zed"), []byte(content), 0644))
+	}
+	writeVersion("..v1", "initial")
+	require.NoError(t, os.Symlink("..v1", filepath.Join(dir, "..data")))
+	tmpFile := filepath.Join(dir, "schema.zed")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "schema.zed"), tmpFile))
+
+	changes := startChangeWatcher(t, tmpFile)
+
+	// Atomically swap ..data to a new version.
+	writeVersion("..v2", "updated")
+	require.NoError(t, os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "..v1")))
+
+	expectReload(t, changes, tmpFile)
+}
+
+func TestFileWatcher_Directory(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "user.zed")
+	require.NoError(t, os.WriteFile(existing, []byte("definition user {}"), 0644))
+
+	changes := startChangeWatcher(t, dir)
+
+	t.Run("new file", func(t *testing.T) {
+		created := filepath.Join(dir, "document.zed")
+		require.NoError(t, os.WriteFile(created, []byte("definition document {}"), 0644))
+		expectReload(t, changes, created)
+	})
+
+	t.Run("new file in new subdirectory", func(t *testing.T) {
+		created := filepath.Join(dir, "sub", "folder.yaml")
+		require.NoError(t, os.Mkdir(filepath.Dir(created), 0755))
+		require.NoError(t, os.WriteFile(created, []byte("schema: definition folder {}"), 0644))
+		expectReload(t, changes, created)
+	})
+
+	t.Run("modified file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(existing, []byte("definition user {}\n"), 0644))
+		expectReload(t, changes, existing)
+	})
+
+	t.Run("deleted file", func(t *testing.T) {
+		require.NoError(t, os.Remove(existing))
+		expectReload(t, changes, existing)
+	})
+
+	t.Run("other files are ignored", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".document.zed.swp"), []byte("swap"), 0644))
+		require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "schema.zed"), []byte("definition user {}"), 0644))
+		expectNoReload(t, changes)
+	})
+}
+
+func TestFileWatcher_Polling(t *testing.T) {
+	t.Run("mode", func(t *testing.T) {
+		tmpFile := createTempFile(t, "schema.zed", "initial")
+
+		watcher, err := NewFileWatcher([]string{tmpFile}, 100*time.Millisecond, func() error { return nil }, WithWatchMode(WatchModePoll, 0))
+		require.NoError(t, err)
+		defer watcher.Stop()
+		require.NoError(t, watcher.Start())
+		assert.Equal(t, WatchModePoll, watcher.Mode())
+	})
+
+	t.Run("content change within the same modification time", func(t *testing.T) {
+		tmpFile := createTempFile(t, "schema.zed", "initial")
+		info, err := os.Stat(tmpFile)
+		require.NoError(t, err)
+
+		changes := startChangeWatcher(t, tmpFile, WithWatchMode(WatchModePoll, 20*time.Millisecond))
+
+		// Same size and modification time: only the content hash tells the files apart.
+		require.NoError(t, os.WriteFile(tmpFile, []byte("updated"), 0644))
+		require.NoError(t, os.Chtimes(tmpFile, info.ModTime(), info.ModTime()))
+		expectReload(t, changes, tmpFile)
+	})
+
+	t.Run("unchanged files and permission changes are ignored", func(t *testing.T) {
+		tmpFile := createTempFile(t, "schema.zed", "initial")
+		changes := startChangeWatcher(t, tmpFile, WithWatchMode(WatchModePoll, 20*time.Millisecond))
+
+		require.NoError(t, os.Chmod(tmpFile, 0600))
+		expectNoReload(t, changes)
+	})
+
+	t.Run("directory", func(t *testing.T) {
+		dir := t.TempDir()
+		existing := filepath.Join(dir, "user.zed")
+		require.NoError(t, os.WriteFile(existing, []byte("definition user {}"), 0644))
+
+		changes := startChangeWatcher(t, dir, WithWatchMode(WatchModePoll, 20*time.Millisecond))
+
+		created := filepath.Join(dir, "sub", "document.zed")
+		require.NoError(t, os.Mkdir(filepath.Dir(created), 0755))
+		require.NoError(t, os.WriteFile(created, []byte("definition document {}"), 0644))
+		expectReload(t, changes, created)
+
+		require.NoError(t, os.Remove(existing))
+		expectReload(t, changes, existing)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+		expectNoReload(t, changes)
+	})
+
+	t.Run("auto mode falls back to polling", func(t *testing.T) {
+		// The parent directory does not exist, so it cannot be watched.
+		tmpFile := filepath.Join(t.TempDir(), "missing", "schema.zed")
+
+		changes := make(chan []string, 10)
+		watcher, err := NewFileWatcherWithChanges([]string{tmpFile}, 100*time.Millisecond, func(changed []string) error {
+			changes <- changed
+			return nil
+		}, WithWatchMode(WatchModeAuto, 20*time.Millisecond))
+		require.NoError(t, err)
+		defer watcher.Stop()
+		require.NoError(t, watcher.Start())
+		assert.Equal(t, WatchModePoll, watcher.Mode())
+
+		require.NoError(t, os.Mkdir(filepath.Dir(tmpFile), 0755))
+		require.NoError(t, os.WriteFile(tmpFile, []byte("created"), 0644))
+		expectReload(t, changes, tmpFile)
+	})
+
+	t.Run("fsnotify mode does not fall back", func(t *testing.T) {
+		tmpFile := filepath.Join(t.TempDir(), "missing", "schema.zed")
+
+		watcher, err := NewFileWatcher([]string{tmpFile}, 100*time.Millisecond, func() error { return nil }, WithWatchMode(WatchModeFSNotify, 0))
+		require.NoError(t, err)
+		defer watcher.Stop()
+		assert.Error(t, watcher.Start())
+	})
+}
+
+func TestFileWatcher_SkipsUnchangedContent(t *testing.T) {
+	t.Run("rewrites", func(t *testing.T) {
+		tmpFile := createTempFile(t, "schema.zed", "initial")
+		changes := startChangeWatcher(t, tmpFile)
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte("updated"), 0644))
+		expectReload(t, changes, tmpFile)
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte("updated"), 0644))
+		expectNoReload(t, changes)
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte("initial"), 0644))
+		expectReload(t, changes, tmpFile)
+	})
+
+	t.Run("touch while polling", func(t *testing.T) {
+		tmpFile := createTempFile(t, "schema.zed", "initial")
+		changes := startChangeWatcher(t, tmpFile, WithWatchMode(WatchModePoll, 20*time.Millisecond))
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte("updated"), 0644))
+		expectReload(t, changes, tmpFile)
+
+		later := time.Now().Add(time.Hour)
+		require.NoError(t, os.Chtimes(tmpFile, later, later))
+		expectNoReload(t, changes)
+	})
+
+	t.Run("marked as loaded", func(t *testing.T) {
+		tmpFile := createTempFile(t, "schema.zed", "initial")
+
+		changes := make(chan []string, 10)
+		watcher, err := NewFileWatcherWithChanges([]string{tmpFile}, 100*time.Millisecond, func(changed []string) error {
+			changes <- changed
+			return nil
+		})
+		require.NoError(t, err)
+		defer watcher.Stop()
+		require.NoError(t, watcher.Start())
+		watcher.MarkLoaded()
+
+		require.NoError(t, os.WriteFile(tmpFile, []byte("initial"), 0644))
+		expectNoReload(t, changes)
+	})
+}
+
+func TestFileWatcher_Backoff(t *testing.T) {
+	tmpFile := createTempFile(t, "schema.zed", "initial")
+
+	var broken atomic.Bool
+	broken.Store(true)
+	changes := make(chan []string, 10)
+	watcher, err := NewFileWatcherWithChanges([]string{tmpFile}, 50*time.Millisecond, func(changed []string) error {
+		changes <- changed
+		if broken.Load() {
+			return errors.New("broken schema")
+		}
+		return nil
+	}, WithReloadBackoff(2, 600*time.Millisecond, time.Second))
+	require.NoError(t, err)
+	defer watcher.Stop()
+	require.NoError(t, watcher.Start())
+
+	assert.Equal(t, CircuitClosed, watcher.Status().Circuit)
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte("broken 1"), 0644))
+	expectReload(t, changes, tmpFile)
+	status := watcher.Status()
+	assert.Equal(t, CircuitClosed, status.Circuit, "a single failure does not open the circuit")
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	assert.Equal(t, "broken schema", status.LastError)
+
+	require.NoError(t, os.WriteFile(tmpFile, []byte("broken 2"), 0644))
+	expectReload(t, changes, tmpFile)
+	status = watcher.Status()
+	assert.Equal(t, CircuitOpen, status.Circuit)
+	assert.Equal(t, 2, status.ConsecutiveFailures)
+	require.NotNil(t, status.RetryAt)
+	assert.WithinDuration(t, time.Now().Add(600*time.Millisecond), *status.RetryAt, 200*time.Millisecond)
+
+	// Changes are held back until the backoff expires, then reloaded.
+	require.NoError(t, os.WriteFile(tmpFile, []byte("broken 3"), 0644))
+	expectNoReload(t, changes)
+	expectReload(t, changes, tmpFile)
+
+	// The failed trial reopens the circuit for twice as long, capped at the maximum.
+	status = watcher.Status()
+	assert.Equal(t, CircuitOpen, status.Circuit)
+	assert.Equal(t, 3, status.ConsecutiveFailures)
+	require.NotNil(t, status.RetryAt)
+	assert.WithinDuration(t, time.Now().Add(time.Second), *status.RetryAt, 200*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		return watcher.Status().Circuit == CircuitHalfOpen
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// A successful trial closes the circuit.
+	broken.Store(false)
+	require.NoError(t, os.WriteFile(tmpFile, []byte("fixed"), 0644))
+	expectReload(t, changes, tmpFile)
+	status = watcher.Status()
+	assert.Equal(t, CircuitClosed, status.Circuit)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Empty(t, status.LastError)
+	assert.Nil(t, status.RetryAt)
+}
@@ -1,6 +1,7 @@
 package embedspicedb
 
 import (
+	"io/fs"
 	"time"
 
 	internalwatch "github.com/akoserwal/embedspicedb/internal/watch"
@@ -10,7 +11,64 @@ import (
 // It is kept in the root package for backwards compatibility, while the implementation lives in `internal/watch`.
 type FileWatcher = internalwatch.FileWatcher
 
+// WatcherOption configures optional FileWatcher behavior.
+type WatcherOption = internalwatch.Option
+
+// WatchMode selects how schema files are watched for changes.
+type WatchMode = internalwatch.Mode
+
+const (
+	// WatchModeAuto uses file system notifications, falling back to polling when they cannot be set up.
+	WatchModeAuto = internalwatch.ModeAuto
+
+	// WatchModeFSNotify uses file system notifications only.
+	WatchModeFSNotify = internalwatch.ModeFSNotify
+
+	// WatchModePoll periodically compares the modification time, size and content hash of the files.
+	WatchModePoll = internalwatch.ModePoll
+)
+
+// WatcherStatus describes the outcome of a FileWatcher's recent reloads.
+type WatcherStatus = internalwatch.Status
+
+// CircuitState is the state of the circuit breaker guarding a FileWatcher's reloads.
+type CircuitState = internalwatch.CircuitState
+
+const (
+	// CircuitClosed means reloads run as soon as changes settle.
+	CircuitClosed = internalwatch.CircuitClosed
+
+	// CircuitOpen means consecutive reloads failed and further reloads are held back until the backoff expires.
+	CircuitOpen = internalwatch.CircuitOpen
+
+	// CircuitHalfOpen means the backoff expired and the next reload is a trial.
+	CircuitHalfOpen = internalwatch.CircuitHalfOpen
+)
+
 // NewFileWatcher creates a new file watcher.
-func NewFileWatcher(files []string, debounce time.Duration, reloadFunc func() error) (*FileWatcher, error) {
-	return internalwatch.NewFileWatcher(files, debounce, reloadFunc)
+func NewFileWatcher(files []string, debounce time.Duration, reloadFunc func() error, opts ...WatcherOption) (*FileWatcher, error) {
+	return internalwatch.NewFileWatcher(files, debounce, reloadFunc, opts...)
+}
+
+// NewFileWatcherWithChanges creates a new file watcher whose reload function receives the absolute
+// paths of the files which changed since the previous reload.
+func NewFileWatcherWithChanges(files []string, debounce time.Duration, reloadFunc func(changed []string) error, opts ...WatcherOption) (*FileWatcher, error) {
+	return internalwatch.NewFileWatcherWithChanges(files, debounce, reloadFunc, opts...)
+}
+
+// WithWatchMode sets how the watcher detects changes, and the interval between polls when polling.
+func WithWatchMode(mode WatchMode, pollInterval time.Duration) WatcherOption {
+	return internalwatch.WithMode(mode, pollInterval)
+}
+
+// WithReloadBackoff sets the number of consecutive failed reloads after which the watcher holds
+// back reloads, and the initial and maximum backoff.
+func WithReloadBackoff(threshold int, initial, maxBackoff time.Duration) WatcherOption {
+	return internalwatch.WithBackoff(threshold, initial, maxBackoff)
+}
+
+// WithWatchFS watches schema files within fsys, such as an os.DirFS or a file system mounted from
+// elsewhere, by polling them.
+func WithWatchFS(fsys fs.FS) WatcherOption {
+	return internalwatch.WithFS(fsys)
 }